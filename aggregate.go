@@ -0,0 +1,94 @@
+package depot
+
+import "reflect"
+
+// Aggregate is a computation over the entities matching a query.
+type Aggregate int8
+
+const (
+	AggregateCount Aggregate = iota
+	AggregateSum
+	AggregateAvg
+)
+
+// CheckAggregate fails with ErrUnsupported for an unknown aggregate and with
+// ErrInvalidFieldPath when a sum or average names a field the entity lacks.
+func CheckAggregate(entity interface{}, agg Aggregate, field string) (err error) {
+	var (
+		s Struct
+		v = reflect.ValueOf(entity)
+	)
+	switch agg {
+	case AggregateCount:
+		return
+	case AggregateSum, AggregateAvg:
+	default:
+		return ErrUnsupported
+	}
+	if s, v, err = GetStruct(v); err != nil {
+		return
+	}
+	if IsPath(field) {
+		return CheckPath(v.Type(), field)
+	}
+	if _, ok := fieldIndex(s, field); !ok {
+		return ErrInvalidFieldPath
+	}
+	return
+}
+
+// Aggregator computes an aggregate over stored items one at a time, for the
+// backends that have no aggregation of their own. Sums and averages skip the
+// items whose field is not a number.
+type Aggregator struct {
+	Aggregate Aggregate
+	Field     string
+	count     int64
+	sum       float64
+}
+
+// Add counts the item m or adds its field to the sum.
+func (a *Aggregator) Add(m map[string]interface{}) {
+	if a.Aggregate == AggregateCount {
+		a.count++
+		return
+	}
+	if n, ok := NumberValue(StoredValue(m, a.Field)); ok {
+		a.sum += n
+		a.count++
+	}
+}
+
+// AddCount counts n items at once.
+func (a *Aggregator) AddCount(n int64) {
+	a.count += n
+}
+
+// Result returns the aggregate of the items added so far. The average of no
+// items is 0.
+func (a *Aggregator) Result() float64 {
+	switch a.Aggregate {
+	case AggregateSum:
+		return a.sum
+	case AggregateAvg:
+		if a.count == 0 {
+			return 0
+		}
+		return a.sum / float64(a.count)
+	}
+	return float64(a.count)
+}
+
+// NumberValue returns the stored value v as a float64 and whether it is a
+// number at all.
+func NumberValue(v interface{}) (float64, bool) {
+	switch n := Normalize(v).(type) {
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
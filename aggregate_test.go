@@ -0,0 +1,62 @@
+package depot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckAggregate(t *testing.T) {
+	assert.NoError(t, CheckAggregate(&selectEntity{}, AggregateCount, ""))
+	assert.NoError(t, CheckAggregate(&selectEntity{}, AggregateSum, "status"))
+	assert.NoError(t, CheckAggregate(&selectEntity{}, AggregateAvg, "data.count"))
+	assert.ErrorIs(t, CheckAggregate(&selectEntity{}, AggregateSum, ""), ErrInvalidFieldPath)
+	assert.ErrorIs(t, CheckAggregate(&selectEntity{}, AggregateSum, "Skip"), ErrInvalidFieldPath)
+	assert.ErrorIs(t, CheckAggregate(&selectEntity{}, AggregateAvg, "status.x"), ErrInvalidFieldPath)
+	assert.ErrorIs(t, CheckAggregate(&selectEntity{}, Aggregate(9), "status"), ErrUnsupported)
+}
+
+func TestAggregator(t *testing.T) {
+	items := []map[string]interface{}{
+		{"n": 1},
+		{"n": int64(2)},
+		{"n": 4.5},
+		{"n": "x"},
+		{},
+	}
+	for _, tc := range []struct {
+		agg  Aggregate
+		want float64
+	}{
+		{AggregateCount, 5},
+		{AggregateSum, 7.5},
+		{AggregateAvg, 2.5},
+	} {
+		a := Aggregator{Aggregate: tc.agg, Field: "n"}
+		for _, it := range items {
+			a.Add(it)
+		}
+		assert.Equal(t, tc.want, a.Result(), "aggregate %d", tc.agg)
+	}
+
+	a := Aggregator{Aggregate: AggregateAvg, Field: "n"}
+	assert.Equal(t, float64(0), a.Result())
+	a = Aggregator{Aggregate: AggregateCount}
+	a.AddCount(3)
+	a.Add(nil)
+	assert.Equal(t, float64(4), a.Result())
+}
+
+func TestNumberValue(t *testing.T) {
+	var p *int
+	n, ok := NumberValue(uint8(3))
+	assert.True(t, ok)
+	assert.Equal(t, float64(3), n)
+	n, ok = NumberValue(float32(1.5))
+	assert.True(t, ok)
+	assert.Equal(t, 1.5, n)
+	_, ok = NumberValue("3")
+	assert.False(t, ok)
+	_, ok = NumberValue(p)
+	assert.False(t, ok)
+}
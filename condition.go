@@ -0,0 +1,198 @@
+package depot
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// CheckConditions returns a *ConditionError naming the fields of existing that
+// do not satisfy the conditions, or nil when they all do.
+func CheckConditions(conditions []EntityCondition, existing map[string]interface{}) error {
+	if failed := FailedConditions(conditions, existing); len(failed) > 0 {
+		return &ConditionError{Fields: failed}
+	}
+	return nil
+}
+
+// UpdateConditions returns the updates that are conditions as EntityConditions.
+// The update of a composite condition holds it already resolved.
+func UpdateConditions(updates []Update) (conditions []EntityCondition) {
+	for _, u := range updates {
+		if ec, ok := u.Value.(EntityCondition); ok {
+			conditions = append(conditions, ec)
+		} else if c, ok := u.Op.(Condition); ok {
+			conditions = append(conditions, EntityCondition{Name: u.Name, Value: u.Value, Op: c})
+		}
+	}
+	return
+}
+
+// FailedConditions returns the names of the fields whose conditions the stored
+// fields in existing do not satisfy. A nil existing fails every condition.
+func FailedConditions(conditions []EntityCondition, existing map[string]interface{}) (failed []string) {
+	for _, c := range conditions {
+		if existing == nil || !c.Matches(existing) {
+			failed = append(failed, c.Fields()...)
+		}
+	}
+	return
+}
+
+// Matches reports whether the stored fields in existing satisfy c.
+func (c EntityCondition) Matches(existing map[string]interface{}) bool {
+	switch c.Op.(type) {
+	case *OrCondition:
+		for _, sub := range c.Conditions {
+			if sub.Matches(existing) {
+				return true
+			}
+		}
+		return false
+	case *AndCondition:
+		for _, sub := range c.Conditions {
+			if !sub.Matches(existing) {
+				return false
+			}
+		}
+		return true
+	case *NotCondition:
+		return !c.Conditions[0].Matches(existing)
+	default:
+		return ConditionMatches(c.Op, StoredValue(existing, c.Name), c.Value)
+	}
+}
+
+// Negate returns the condition that matches when c does not, with the negation
+// pushed down to the compared fields for the backends that have no NOT. It
+// fails with ErrUnsupported for Exists and Contains, which have no opposite
+// there.
+func (c EntityCondition) Negate() (n EntityCondition, err error) {
+	n = c
+	switch o := c.Op.(type) {
+	case *NotCondition:
+		return c.Conditions[0], nil
+	case *OrCondition, *AndCondition:
+		n.Op, n.Conditions = And(), nil
+		if _, ok := o.(*AndCondition); ok {
+			n.Op = Or()
+		}
+		for _, sub := range c.Conditions {
+			var ns EntityCondition
+			if ns, err = sub.Negate(); err != nil {
+				return
+			}
+			n.Conditions = append(n.Conditions, ns)
+		}
+	case *EqualCondition:
+		n.Op = NotEqual(c.Name)
+	case *NotEqualCondition:
+		n.Op = Equal(c.Name)
+	case *LTCondition:
+		n.Op = GreaterThanOrEqual(c.Name)
+	case *LTECondition:
+		n.Op = GreaterThan(c.Name)
+	case *GTCondition:
+		n.Op = LessThanOrEqual(c.Name)
+	case *GTECondition:
+		n.Op = LessThan(c.Name)
+	case *InCondition:
+		n.Op = NotIn(c.Name, o.List()...)
+	case *NotInCondition:
+		n.Op = In(c.Name, o.List()...)
+	case *BeginsWithCondition:
+		n = EntityCondition{Op: Or(), Conditions: []EntityCondition{
+			{Name: c.Name, Value: c.Value, Op: LessThan(c.Name)},
+			{Name: c.Name, Value: PrefixEnd(c.Value), Op: GreaterThanOrEqual(c.Name)},
+		}}
+	case *BetweenCondition:
+		n = EntityCondition{Op: Or(), Conditions: []EntityCondition{
+			{Name: c.Name, Value: o.From(), Op: LessThan(c.Name)},
+			{Name: c.Name, Value: o.To(), Op: GreaterThan(c.Name)},
+		}}
+	case nil:
+		n.Op = NotEqual(c.Name)
+	default:
+		err = ErrUnsupported
+	}
+	return
+}
+
+// ConditionMatches reports whether the stored value v satisfies op when compared
+// with value. A missing stored value never matches.
+func ConditionMatches(op Condition, v, value interface{}) bool {
+	a, b := Normalize(v), Normalize(value)
+	if a == nil {
+		return false
+	}
+	switch o := op.(type) {
+	case *ExistsCondition:
+		return true
+	case *InCondition:
+		return ValueIn(a, normalizeList(o.List()))
+	case *NotInCondition:
+		return !ValueIn(a, normalizeList(o.List()))
+	case *NotEqualCondition:
+		return ValuesNotEqual(a, b)
+	case *LTCondition:
+		return ValuesLessThan(a, b)
+	case *LTECondition:
+		return ValuesLessThanOrEqual(a, b)
+	case *GTCondition:
+		return ValuesGreaterThan(a, b)
+	case *GTECondition:
+		return ValuesGreaterThanOrEqual(a, b)
+	case *BeginsWithCondition:
+		s, ok := a.(string)
+		prefix, isString := b.(string)
+		return ok && isString && strings.HasPrefix(s, prefix)
+	case *ContainsCondition:
+		return ValueContains(a, b)
+	case *BetweenCondition:
+		return ValuesGreaterThanOrEqual(a, Normalize(o.From())) && ValuesLessThanOrEqual(a, Normalize(o.To()))
+	default:
+		return ValuesEqual(a, b)
+	}
+}
+
+// Normalize dereferences pointers and converts named scalar types to their
+// underlying kind so the comparison helpers can be applied to them.
+func Normalize(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	default:
+		return rv.Interface()
+	}
+}
+
+// PrefixEnd returns prefix followed by a code point that sorts after the
+// strings beginning with it, which bounds a prefix match on the backends that
+// have none.
+func PrefixEnd(prefix interface{}) interface{} {
+	return fmt.Sprintf("%v\uf8ff", prefix)
+}
+
+func normalizeList(list []interface{}) (out []interface{}) {
+	for _, v := range list {
+		out = append(out, Normalize(v))
+	}
+	return
+}
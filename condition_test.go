@@ -0,0 +1,126 @@
+package depot
+
+import (
+	"testing"
+
+	"github.com/aws/smithy-go/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionMatches(t *testing.T) {
+	assert.True(t, ConditionMatches(Equal("a"), int64(1), 1))
+	assert.True(t, ConditionMatches(Equal("a"), "sv", WidgetStatus("sv")))
+	assert.True(t, ConditionMatches(Equal("a"), ptr.String("sv"), "sv"))
+	assert.True(t, ConditionMatches(NotEqual("a"), 1, 2))
+	assert.True(t, ConditionMatches(LessThan("a"), 1, 2))
+	assert.True(t, ConditionMatches(LessThanOrEqual("a"), 2, 2))
+	assert.True(t, ConditionMatches(GreaterThan("a"), 3, 2))
+	assert.True(t, ConditionMatches(GreaterThanOrEqual("a"), 2, 2))
+	assert.True(t, ConditionMatches(Exists("a"), 0, nil))
+	assert.True(t, ConditionMatches(In("a", 1, 2), int64(2), nil))
+	assert.True(t, ConditionMatches(NotIn("a", 1, 2), int64(3), nil))
+	assert.False(t, ConditionMatches(Equal("a"), 1, 2))
+	assert.False(t, ConditionMatches(In("a", 1, 2), 3, nil))
+
+	assert.True(t, ConditionMatches(BeginsWith("a"), "ORDER#2024-01", "ORDER#2024-"))
+	assert.False(t, ConditionMatches(BeginsWith("a"), "ORDER#2023-12", "ORDER#2024-"))
+	assert.False(t, ConditionMatches(BeginsWith("a"), 20240101, "2024"))
+	assert.True(t, ConditionMatches(Contains("a"), "a needle here", "needle"))
+	assert.True(t, ConditionMatches(Contains("a"), []string{"x", "y", "z"}, "y"))
+	assert.True(t, ConditionMatches(Contains("a"), []interface{}{int64(1), int64(2)}, []int{2, 1}))
+	assert.False(t, ConditionMatches(Contains("a"), []string{"x", "y"}, []string{"y", "w"}))
+	assert.False(t, ConditionMatches(Contains("a"), int64(12), int64(1)))
+	assert.True(t, ConditionMatches(Between("a", 1, 3), int64(3), nil))
+	assert.False(t, ConditionMatches(Between("a", 1, 3), int64(4), nil))
+
+	// A missing value never matches.
+	assert.False(t, ConditionMatches(Exists("a"), nil, nil))
+	assert.False(t, ConditionMatches(NotEqual("a"), nil, 1))
+	assert.False(t, ConditionMatches(NotIn("a", 1), (*string)(nil), nil))
+}
+
+func TestFailedConditions(t *testing.T) {
+	conditions := []EntityCondition{
+		{Name: "a", Value: 1, Op: Equal("a")},
+		{Name: "b", Value: 1, Op: GreaterThan("b")},
+		{Name: "c", Op: Exists("c")},
+	}
+	assert.Nil(t, FailedConditions(conditions, map[string]interface{}{"a": 1, "b": 2, "c": "x"}))
+	assert.Equal(t, []string{"b", "c"}, FailedConditions(conditions, map[string]interface{}{"a": 1, "b": 1}))
+	assert.Equal(t, []string{"a", "b", "c"}, FailedConditions(conditions, nil))
+}
+
+func TestConditionError(t *testing.T) {
+	err := CheckConditions([]EntityCondition{
+		{Name: "a", Value: 1, Op: Equal("a")},
+		{Name: "b", Value: 1, Op: Equal("b")},
+	}, map[string]interface{}{"a": 2, "b": 2})
+	assert.ErrorIs(t, err, ErrConditionFailed)
+	assert.EqualError(t, err, "depot: condition failed: a, b")
+	assert.EqualError(t, &ConditionError{}, "depot: condition failed")
+	assert.NoError(t, CheckConditions(nil, nil))
+}
+
+func TestUpdateConditions(t *testing.T) {
+	eq := Equal("b")
+	assert.Equal(t, []EntityCondition{{Name: "b", Value: 2, Op: eq}}, UpdateConditions([]Update{
+		{Name: "a", Value: 1, Op: Add("a")},
+		{Name: "b", Value: 2, Op: eq},
+		{Name: "c", Value: 3},
+	}))
+}
+
+func TestCompositeMatches(t *testing.T) {
+	status := EntityCondition{Name: "status", Value: "active", Op: Equal("status")}
+	count := EntityCondition{Name: "count", Value: 10, Op: GreaterThan("count")}
+	or := EntityCondition{Op: Or(), Conditions: []EntityCondition{status, count}}
+	and := EntityCondition{Op: And(), Conditions: []EntityCondition{status, count}}
+	not := EntityCondition{Op: Not(nil), Conditions: []EntityCondition{status}}
+
+	active := map[string]interface{}{"status": "active", "count": 5}
+	busy := map[string]interface{}{"status": "idle", "count": 20}
+	idle := map[string]interface{}{"status": "idle", "count": 5}
+	assert.True(t, or.Matches(active))
+	assert.True(t, or.Matches(busy))
+	assert.False(t, or.Matches(idle))
+	assert.False(t, and.Matches(active))
+	assert.True(t, and.Matches(map[string]interface{}{"status": "active", "count": 20}))
+	assert.False(t, not.Matches(active))
+	assert.True(t, not.Matches(idle))
+	assert.Equal(t, []string{"status", "count"}, or.Fields())
+	assert.Equal(t, []string{"status", "count"}, FailedConditions([]EntityCondition{or}, idle))
+}
+
+func TestNegate(t *testing.T) {
+	status := EntityCondition{Name: "status", Value: "active", Op: Equal("status")}
+	count := EntityCondition{Name: "count", Value: 10, Op: LessThan("count")}
+	n, err := EntityCondition{Op: Or(), Conditions: []EntityCondition{status, count}}.Negate()
+	assert.NoError(t, err)
+	assert.IsType(t, &AndCondition{}, n.Op)
+	if assert.Len(t, n.Conditions, 2) {
+		assert.IsType(t, &NotEqualCondition{}, n.Conditions[0].Op)
+		assert.IsType(t, &GTECondition{}, n.Conditions[1].Op)
+		assert.Equal(t, 10, n.Conditions[1].Value)
+	}
+
+	n, err = EntityCondition{Op: Not(nil), Conditions: []EntityCondition{status}}.Negate()
+	assert.NoError(t, err)
+	assert.Equal(t, status, n)
+
+	n, err = EntityCondition{Name: "count", Op: Between("count", 1, 3)}.Negate()
+	assert.NoError(t, err)
+	assert.Equal(t, EntityCondition{Op: Or(), Conditions: []EntityCondition{
+		{Name: "count", Value: 1, Op: LessThan("count")},
+		{Name: "count", Value: 3, Op: GreaterThan("count")},
+	}}, n)
+
+	n, err = EntityCondition{Name: "id", Value: "a#", Op: BeginsWith("id")}.Negate()
+	assert.NoError(t, err)
+	assert.Equal(t, EntityCondition{Op: Or(), Conditions: []EntityCondition{
+		{Name: "id", Value: "a#", Op: LessThan("id")},
+		{Name: "id", Value: "a#\uf8ff", Op: GreaterThanOrEqual("id")},
+	}}, n)
+
+	_, err = EntityCondition{Name: "status", Op: Exists("status")}.Negate()
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
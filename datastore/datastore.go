@@ -3,8 +3,12 @@ package datastore
 import (
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/datastore"
 	"github.com/andyday/depot"
@@ -13,39 +17,118 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// Service limits on the number of keys in a single multi operation.
+const (
+	batchGetSize   = 1000
+	batchWriteSize = 500
+)
+
 type DB struct {
 	datastore *datastore.Client
+	pages     depot.PageCodec
+	clock     func() time.Time
 }
 
 var _ depot.Database = &DB{}
 
-func NewDatabase(ctx context.Context, projectID, databaseID string) (c *DB, err error) {
-	c = &DB{}
+func NewDatabase(ctx context.Context, projectID, databaseID string, opts ...depot.Option) (c *DB, err error) {
+	o := depot.NewOptions(opts...)
+	c = &DB{pages: o.PageCodec, clock: o.Clock}
 	c.datastore, err = datastore.NewClientWithDatabase(ctx, projectID, databaseID)
 	return
 }
 
-func (d *DB) Put(ctx context.Context, table string, entity interface{}) (err error) {
-	var k *datastore.Key
+func (d *DB) Put(ctx context.Context, table string, entity interface{}, op ...depot.Condition) (err error) {
+	var (
+		k   *datastore.Key
+		src *datastoreEntity
+	)
+	if src, err = newDatastoreEntity(entity); err != nil {
+		return
+	}
+	// Keeping the stored created time needs a read, so it takes a transaction.
+	if len(op) > 0 || src.version != nil || (src.timestamps != nil && src.timestamps.Created != "") {
+		return d.transact(ctx, func(t *transaction) error {
+			return t.Put(table, entity, op...)
+		})
+	}
 	if k, err = LoadKey(table, entity); err != nil {
 		return
 	}
-	_, err = d.datastore.Put(ctx, k, &datastoreEntity{entity: entity})
-	return
+	if src.timestamps != nil {
+		src.timestamps.Put(d.clock(), nil)
+	}
+	if _, err = d.datastore.Put(ctx, k, src); err != nil {
+		return
+	}
+	return src.stamp()
 }
 
-func (d *DB) Get(ctx context.Context, table string, entity interface{}) (err error) {
-	var k *datastore.Key
+func (d *DB) Get(ctx context.Context, table string, entity interface{}, op ...depot.GetOp) (err error) {
+	var (
+		k   *datastore.Key
+		dst *datastoreEntity
+	)
 	if k, err = LoadKey(table, entity); err != nil {
 		return
 	}
-	if err = d.datastore.Get(ctx, k, &datastoreEntity{entity: entity}); errors.Is(err, datastore.ErrNoSuchEntity) {
+	if dst, err = selectedEntity(entity, op); err != nil {
+		return
+	}
+	// Selecting no fields looks for the key alone with a keys-only query.
+	if fields := depot.Selected(op); fields != nil && len(fields) == 0 {
+		return d.exists(ctx, k, entity, depot.ReadTime(op))
+	}
+	err = d.readAt(ctx, depot.ReadTime(op), func(tx *datastore.Transaction) error {
+		if tx != nil {
+			return tx.Get(k, dst)
+		}
+		return d.datastore.Get(ctx, k, dst)
+	})
+	if errors.Is(err, datastore.ErrNoSuchEntity) {
 		return depot.ErrEntityNotFound
 	}
 	return
 }
 
-func (d *DB) Delete(ctx context.Context, table string, entity interface{}) (err error) {
+// exists fails with depot.ErrEntityNotFound unless the key k is stored, and
+// otherwise clears the fields of entity other than its key.
+func (d *DB) exists(ctx context.Context, k *datastore.Key, entity interface{}, t time.Time) (err error) {
+	var (
+		q    = datastore.NewQuery(k.Kind).FilterField("__key__", "=", k).KeysOnly()
+		keys []*datastore.Key
+	)
+	if err = d.readAt(ctx, t, func(tx *datastore.Transaction) (err error) {
+		if tx != nil {
+			q = q.Transaction(tx)
+		}
+		keys, err = d.datastore.GetAll(ctx, q, nil)
+		return
+	}); err != nil {
+		return
+	}
+	if len(keys) == 0 {
+		return depot.ErrEntityNotFound
+	}
+	return depot.ResetEntity(entity)
+}
+
+// readAt runs fn in a read-only transaction that sees the database as it was
+// at time t, or outside of any transaction when t is zero.
+func (d *DB) readAt(ctx context.Context, t time.Time, fn func(tx *datastore.Transaction) error) (err error) {
+	if t.IsZero() {
+		return fn(nil)
+	}
+	_, err = d.datastore.RunInTransaction(ctx, fn, datastore.ReadOnly, datastore.WithReadTime(t))
+	return
+}
+
+func (d *DB) Delete(ctx context.Context, table string, entity interface{}, op ...depot.Condition) (err error) {
+	if len(op) > 0 || depot.IsVersioned(entity) {
+		return d.transact(ctx, func(t *transaction) error {
+			return t.Delete(table, entity, op...)
+		})
+	}
 	var k *datastore.Key
 	if k, err = LoadKey(table, entity); err != nil {
 		return
@@ -54,24 +137,67 @@ func (d *DB) Delete(ctx context.Context, table string, entity interface{}) (err
 }
 
 func (d *DB) Create(ctx context.Context, table string, entity interface{}) (err error) {
-	var k *datastore.Key
+	var (
+		k   *datastore.Key
+		src *datastoreEntity
+	)
 	if k, err = LoadKey(table, entity); err != nil {
 		return
 	}
-	if _, err = d.datastore.Mutate(ctx, datastore.NewInsert(k, &datastoreEntity{entity: entity})); status.Code(err) == codes.AlreadyExists {
+	if src, err = newDatastoreEntity(entity); err != nil {
+		return
+	}
+	if src.timestamps != nil {
+		src.timestamps.Create(d.clock())
+	}
+	if _, err = d.datastore.Mutate(ctx, datastore.NewInsert(k, src)); status.Code(err) == codes.AlreadyExists {
 		return depot.ErrEntityAlreadyExists
+	} else if err != nil {
+		return
 	}
-	return
+	if err = src.stamp(); err != nil || src.version == nil {
+		return
+	}
+	return depot.SetEntityVersion(entity, src.version.Next())
 }
 
 func (d *DB) Update(ctx context.Context, table string, entity interface{}, op ...depot.UpdateOp) (err error) {
+	return d.transact(ctx, func(t *transaction) error {
+		return t.Update(table, entity, op...)
+	})
+}
+
+func (d *DB) RunInTransaction(ctx context.Context, fn func(tx depot.Tx) error) (err error) {
+	if err = d.transact(ctx, func(t *transaction) error {
+		return fn(t)
+	}); status.Code(err) == codes.AlreadyExists {
+		return depot.ErrEntityAlreadyExists
+	}
+	return
+}
+
+// transact runs fn in a Datastore transaction, which may call it more than
+// once, and sets the versions written by its last call once it has committed.
+func (d *DB) transact(ctx context.Context, fn func(t *transaction) error) (err error) {
+	var t *transaction
+	if _, err = d.datastore.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		t = &transaction{tx: tx, clock: d.clock}
+		return fn(t)
+	}); err != nil {
+		return
+	}
+	return t.bumps.Apply()
+}
+
+func (t *transaction) update(table string, entity interface{}, op []depot.UpdateOp) (err error) {
 	var (
-		k       *datastore.Key
-		updates []depot.Update
-		u       depot.Update
-		prop    depot.Property
-		propMap = make(datastoreMap)
-		ok      bool
+		k        *datastore.Key
+		updates  []depot.Update
+		u        depot.Update
+		v        interface{}
+		propMap  = make(datastoreMap)
+		existing map[string]interface{}
+		src      *datastoreEntity
 	)
 	if k, err = LoadKey(table, entity); err != nil {
 		return
@@ -79,33 +205,68 @@ func (d *DB) Update(ctx context.Context, table string, entity interface{}, op ..
 	if updates, err = depot.EntityUpdates(entity, op); err != nil {
 		return
 	}
-	_, err = d.datastore.RunInTransaction(ctx, func(tx *datastore.Transaction) (err error) {
-		if err = d.datastore.Get(ctx, k, propMap); errors.Is(err, datastore.ErrNoSuchEntity) {
-			return depot.ErrEntityNotFound
-		} else if err != nil {
+	if src, err = newDatastoreEntity(entity); err != nil {
+		return
+	}
+	if err = t.tx.Get(k, propMap); err != nil && !errors.Is(err, datastore.ErrNoSuchEntity) {
+		return
+	}
+	existing = propMap.values()
+	if src.version != nil {
+		if err = depot.CheckVersion(*src.version, existing); err != nil {
 			return
 		}
-		for _, u = range updates {
-			if prop, ok = propMap[u.Name]; !ok {
-				prop = depot.Property{Name: u.Name}
+	}
+	if err = depot.CheckConditions(depot.UpdateConditions(updates), existing); err != nil {
+		return
+	}
+	if src.timestamps != nil {
+		src.timestamps.Update(t.clock())
+		updates = append(updates, src.timestamps.Updates()...)
+	}
+	for _, u = range updates {
+		v = depot.StoredValue(existing, u.Name)
+		switch u.Op.(type) {
+		case *depot.AddUpdateOp:
+			v = depot.AddValues(v, u.Value)
+		case *depot.SubtractUpdateOp:
+			v = depot.SubtractValues(v, u.Value)
+		case *depot.RemoveUpdateOp:
+			if err = depot.DeletePathValue(existing, u.Name); err != nil {
+				return
 			}
-			switch u.Op.(type) {
-			case *depot.AddUpdateOp:
-				prop.Value = depot.AddValues(prop.Value, u.Value)
-			case *depot.SubtractUpdateOp:
-				prop.Value = depot.SubtractValues(prop.Value, u.Value)
-			default:
-				prop.Value = u.Value
+			continue
+		case *depot.AppendUpdateOp:
+			v = depot.AppendValues(v, u.Value)
+		case *depot.PrependUpdateOp:
+			v = depot.PrependValues(v, u.Value)
+		case *depot.AddToSetUpdateOp:
+			v = depot.UnionValues(v, u.Value)
+		case *depot.RemoveFromSetUpdateOp:
+			v = depot.DifferenceValues(v, u.Value)
+		case *depot.SetIfAbsentUpdateOp, *depot.MaxUpdateOp, *depot.MinUpdateOp:
+			if !depot.UpdateApplies(u, v) {
+				continue
 			}
-			propMap[u.Name] = prop
+			v = u.Value
+		case depot.Condition:
+			continue
+		default:
+			v = u.Value
 		}
-
-		if err = depot.EntityFromPropertyMap(propMap, entity); err != nil {
+		if err = depot.SetPathValue(existing, u.Name, v); err != nil {
 			return
 		}
-		_, err = d.datastore.Put(ctx, k, &datastoreEntity{entity: entity})
+	}
+
+	src.removed = depot.RemovedFields(updates)
+	if err = depot.ClearFields(entity, src.removed...); err != nil {
 		return
-	})
+	}
+	if err = depot.EntityFromMap(existing, entity, false); err != nil {
+		return
+	}
+	_, err = t.put(k, src)
 	return
 }
 
@@ -113,43 +274,204 @@ func (d *DB) Query(ctx context.Context, table, kind string, entity interface{},
 	var (
 		conditions []depot.EntityCondition
 		sortField  string
-		offset     int
+		limit      int
 		q          = datastore.NewQuery(table)
+		projection []string
+		keys       *keyNames
 	)
 
 	if sortField, conditions, err = depot.EntityConditions(kind, entity, op); err != nil {
 		return
 	}
-	q = applyQueryConditions(q, conditions)
-	if q, offset, err = applyQueryDirectives(q, op, sortField); err != nil {
+	shape := depot.PageShape(table, kind, conditions, op)
+	if op, err = depot.DecodePageOps(d.pages, shape, op); err != nil {
 		return
 	}
-	qr := newQueryRunner(table, entities, offset)
-	if offset, err = qr.run(d.datastore.Run(ctx, q)); err != nil {
+	if q, err = applyQueryConditions(q, conditions); err != nil {
 		return
 	}
-	if err = qr.next(d.datastore.Run(ctx, q.Offset(offset)), false); errors.Is(err, iterator.Done) {
-		// If this is an error it means it is done at the 1st item or there was an error
-		return "", nil
+	if q, limit, err = applyQueryDirectives(q, op, sortField); err != nil {
+		return
 	}
-	if err != nil {
+	// A projection query only finds entities whose projected properties are
+	// indexed, and needs a composite index covering its filters too, so the
+	// projection is made as whole entities are loaded. A query that selects no
+	// more than the key and the properties an equality filter fixes asks for
+	// keys alone, reading the key fields from the key names and copying the
+	// fixed values from the filter.
+	if fields := depot.Selected(op); fields != nil {
+		if projection, err = depot.Projection(kind, entity, fields); err != nil {
+			return
+		}
+		if k, ok := newKeyNames(entity, fixedFields(conditions)); ok && k.covers(projection) {
+			q, keys = q.KeysOnly(), &k
+		}
+	}
+	runner := newQueryRunner(entities, limit, projection)
+	runner.keys = keys
+	if err = d.readAt(ctx, depot.ReadTime(op), func(tx *datastore.Transaction) (err error) {
+		if tx != nil {
+			q = q.Transaction(tx)
+		}
+		page, err = runner.run(d.datastore.Run(ctx, q))
+		return
+	}); err != nil {
+		return
+	}
+	return d.pages.Encode(shape, page)
+}
+
+func (d *DB) Aggregate(ctx context.Context, table, kind string, entity interface{}, agg depot.Aggregate, field string, op ...depot.QueryOp) (result float64, err error) {
+	var (
+		conditions []depot.EntityCondition
+		q          = datastore.NewQuery(table)
+		res        datastore.AggregationResult
+	)
+	if err = depot.CheckAggregate(entity, agg, field); err != nil {
+		return
+	}
+	if _, conditions, err = depot.EntityConditions(kind, entity, op); err != nil {
+		return
+	}
+	if q, err = applyQueryConditions(q, conditions); err != nil {
+		return
+	}
+	if err = d.readAt(ctx, depot.ReadTime(op), func(tx *datastore.Transaction) (err error) {
+		if tx != nil {
+			q = q.Transaction(tx)
+		}
+		res, err = d.datastore.RunAggregationQuery(ctx, aggregationQuery(q, agg, field))
+		return
+	}); err != nil {
 		return
 	}
+	return aggregateValue(res[aggregateAlias]), nil
+}
 
-	return strconv.Itoa(offset), nil
+const aggregateAlias = "depot"
+
+func aggregationQuery(q *datastore.Query, agg depot.Aggregate, field string) *datastore.AggregationQuery {
+	aq := q.NewAggregationQuery()
+	switch agg {
+	case depot.AggregateSum:
+		return aq.WithSum(field, aggregateAlias)
+	case depot.AggregateAvg:
+		return aq.WithAvg(field, aggregateAlias)
+	}
+	return aq.WithCount(aggregateAlias)
+}
+
+// aggregateValue returns the number an aggregation result holds, which is an
+// integer or a double and is null for the average of no values.
+func aggregateValue(v interface{}) float64 {
+	n, ok := v.(interface {
+		GetIntegerValue() int64
+		GetDoubleValue() float64
+	})
+	if !ok {
+		return 0
+	}
+	return float64(n.GetIntegerValue()) + n.GetDoubleValue()
 }
 
+func (d *DB) BatchGet(ctx context.Context, table string, entities interface{}) (err error) {
+	var (
+		v    reflect.Value
+		keys []*datastore.Key
+	)
+	if v, err = depot.EntitySlice(entities); err != nil {
+		return
+	}
+	if keys, err = loadKeys(table, v); err != nil {
+		return
+	}
+	found := make([]bool, v.Len())
+	for start := 0; start < len(keys); start += batchGetSize {
+		end := min(start+batchGetSize, len(keys))
+		dst := make([]datastoreEntity, end-start)
+		for i := range dst {
+			dst[i].entity = v.Index(start + i).Addr().Interface()
+		}
+		err = d.datastore.GetMulti(ctx, keys[start:end], dst)
+		var me datastore.MultiError
+		if errors.As(err, &me) {
+			for i, e := range me {
+				if e != nil && !errors.Is(e, datastore.ErrNoSuchEntity) {
+					return e
+				}
+				found[start+i] = e == nil
+			}
+		} else if err != nil {
+			return
+		} else {
+			for i := start; i < end; i++ {
+				found[i] = true
+			}
+		}
+	}
+	return depot.KeepEntities(v, found)
+}
+
+func (d *DB) BatchPut(ctx context.Context, table string, entities interface{}) (err error) {
+	var (
+		v    reflect.Value
+		keys []*datastore.Key
+	)
+	if v, err = depot.EntitySlice(entities); err != nil {
+		return
+	}
+	if keys, err = loadKeys(table, v); err != nil {
+		return
+	}
+	for start := 0; start < len(keys); start += batchWriteSize {
+		end := min(start+batchWriteSize, len(keys))
+		src := make([]datastoreEntity, end-start)
+		for i := range src {
+			src[i].entity = v.Index(start + i).Addr().Interface()
+		}
+		if _, err = d.datastore.PutMulti(ctx, keys[start:end], src); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (d *DB) BatchDelete(ctx context.Context, table string, entities interface{}) (err error) {
+	var (
+		v    reflect.Value
+		keys []*datastore.Key
+	)
+	if v, err = depot.EntitySlice(entities); err != nil {
+		return
+	}
+	if keys, err = loadKeys(table, v); err != nil {
+		return
+	}
+	for start := 0; start < len(keys); start += batchWriteSize {
+		if err = d.datastore.DeleteMulti(ctx, keys[start:min(start+batchWriteSize, len(keys))]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// queryRunner appends query results to a list. A query with a limit is run
+// with one extra result which tells whether there is another page without
+// adding it to the list.
 type queryRunner struct {
-	table       string
-	list        interface{}
 	listValue   reflect.Value
 	elementType reflect.Type
-	offset      int
+	limit       int
+	// projection, when set, names the only fields loaded into the list.
+	projection []string
+	// keys, when set, reads the key fields of the results of a keys-only
+	// query from their key names.
+	keys *keyNames
 }
 
-func newQueryRunner(table string, list interface{}, offset int) *queryRunner {
-	q := &queryRunner{table: table, list: list, offset: offset}
-	q.listValue = reflect.ValueOf(q.list)
+func newQueryRunner(list interface{}, limit int, projection []string) *queryRunner {
+	q := &queryRunner{limit: limit, projection: projection}
+	q.listValue = reflect.ValueOf(list)
 	if q.listValue.Kind() == reflect.Ptr {
 		q.listValue = q.listValue.Elem()
 	}
@@ -157,92 +479,253 @@ func newQueryRunner(table string, list interface{}, offset int) *queryRunner {
 	return q
 }
 
-func (q *queryRunner) run(it *datastore.Iterator) (offset int, err error) {
-	for {
-		if err = q.next(it, true); errors.Is(err, iterator.Done) {
-			break
+// run returns the cursor after the last entity added to the list when there is
+// another page of results after it.
+func (q *queryRunner) run(it *datastore.Iterator) (page string, err error) {
+	var cursor datastore.Cursor
+	for n := 0; ; n++ {
+		if q.limit > 0 && n == q.limit {
+			if cursor, err = it.Cursor(); err != nil {
+				return
+			}
 		}
-		if err != nil {
+		var (
+			ev = reflect.New(q.elementType)
+			k  *datastore.Key
+		)
+		if k, err = it.Next(&datastoreEntity{entity: ev.Interface(), projection: q.projection}); errors.Is(err, iterator.Done) {
+			return "", nil
+		} else if err != nil {
 			return
 		}
+		if q.limit > 0 && n == q.limit {
+			return cursor.String(), nil
+		}
+		if q.keys != nil {
+			var m map[string]interface{}
+			if m, err = q.keys.values(k.Name); err != nil {
+				return
+			}
+			if err = depot.EntityFromMap(m, ev.Interface(), false); err != nil {
+				return
+			}
+		}
+		q.listValue.Set(reflect.Append(q.listValue, ev.Elem()))
+	}
+}
+
+// fixedFields returns the values of the top-level fields the conditions hold
+// equal to one value, which they do by default.
+func fixedFields(conditions []depot.EntityCondition) map[string]interface{} {
+	fixed := make(map[string]interface{})
+	for _, c := range conditions {
+		switch c.Op.(type) {
+		case nil, *depot.EqualCondition:
+			if !depot.IsPath(c.Name) {
+				fixed[c.Name] = c.Value
+			}
+		}
 	}
-	return q.offset, nil
+	return fixed
+}
+
+// keyNames reads the values of the key fields back from the key names LoadKey
+// makes, which join them with a colon. A name only splits apart where at most
+// one of them is a string, or where the query fixes one of them.
+type keyNames struct {
+	partition, sort *keyField
+	fixed           map[string]interface{}
+}
+
+type keyField struct {
+	name string
+	t    reflect.Type
 }
 
-func (q *queryRunner) next(it *datastore.Iterator, append bool) (err error) {
-	ev := reflect.New(q.elementType)
-	if _, err = it.Next(&datastoreEntity{entity: ev.Interface()}); err != nil {
+func newKeyNames(entity interface{}, fixed map[string]interface{}) (k keyNames, ok bool) {
+	s, v, err := depot.GetStruct(reflect.ValueOf(entity))
+	if err != nil {
 		return
 	}
-	q.offset++
-	if append {
-		q.listValue.Set(reflect.Append(q.listValue, ev.Elem()))
+	for i, f := range s {
+		switch f.Mode {
+		case depot.FieldModePartition:
+			k.partition = &keyField{name: f.Name, t: v.Type().Field(i).Type}
+		case depot.FieldModeSort:
+			k.sort = &keyField{name: f.Name, t: v.Type().Field(i).Type}
+		}
 	}
+	k.fixed = fixed
+	if k.partition == nil || !parsable(k.partition.t) {
+		return k, false
+	}
+	if k.sort == nil {
+		return k, true
+	}
+	_, pf := fixed[k.partition.name]
+	_, sf := fixed[k.sort.name]
+	return k, parsable(k.sort.t) && (pf || sf || k.partition.t.Kind() != reflect.String || k.sort.t.Kind() != reflect.String)
+}
+
+// covers reports whether the key names and the fixed values hold all the
+// fields of the projection.
+func (k keyNames) covers(projection []string) bool {
+	for _, name := range projection {
+		if _, ok := k.fixed[name]; ok || name == k.partition.name || (k.sort != nil && name == k.sort.name) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// values returns the fixed values along with those of the key fields that the
+// key name holds.
+func (k keyNames) values(name string) (m map[string]interface{}, err error) {
+	m = make(map[string]interface{}, len(k.fixed)+2)
+	for f, v := range k.fixed {
+		m[f] = v
+	}
+	p, sv := name, ""
+	if k.sort != nil {
+		var i int
+		if v, ok := k.fixed[k.partition.name]; ok {
+			i = len(fmt.Sprint(v))
+		} else if v, ok := k.fixed[k.sort.name]; ok {
+			i = len(name) - len(fmt.Sprint(v)) - 1
+		} else if k.partition.t.Kind() != reflect.String {
+			i = strings.Index(name, ":")
+		} else {
+			i = strings.LastIndex(name, ":")
+		}
+		if i < 0 || i >= len(name) || name[i] != ':' {
+			return nil, depot.ErrInvalidEntityType
+		}
+		p, sv = name[:i], name[i+1:]
+		if m[k.sort.name], err = keyValue(sv, k.sort.t); err != nil {
+			return
+		}
+	}
+	m[k.partition.name], err = keyValue(p, k.partition.t)
 	return
 }
 
-// it := d.datastore.Run(ctx, q)
-// v := reflect.ValueOf(entities)
-// v = v.Elem()
-// elemType := v.Type().Elem()
-//
-// for {
-// 	ev := reflect.New(elemType)
-// 	item := datastoreEntity{kind: table, entity: ev.Interface()}
-// 	if _, err = it.Next(&item); errors.Is(err, iterator.Done) {
-// 		if cursor, err = it.Cursor(); err != nil {
-// 			return
-// 		}
-// 		return cursor.String(), nil
-// 	}
-// 	if err != nil {
-// 		return
-// 	}
-// dv.Set(reflect.Append(dv, ev))
-// 	reflect.Append(v, ev.Elem())
-// }
+func parsable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// keyValue parses s, a key field value formatted into a key name.
+func keyValue(s string, t reflect.Type) (interface{}, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return s, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(s, 10, 64)
+	default:
+		return strconv.ParseInt(s, 10, 64)
+	}
+}
 
-func applyQueryConditions(in *datastore.Query, conditions []depot.EntityCondition) (q *datastore.Query) {
+func applyQueryConditions(in *datastore.Query, conditions []depot.EntityCondition) (q *datastore.Query, err error) {
+	var f datastore.EntityFilter
 	q = in
 	for _, c := range conditions {
-		switch c.Op.(type) {
-		case *depot.EqualCondition:
-			q = q.FilterField(c.Name, "=", c.Value)
-		case *depot.NotEqualCondition:
-			q = q.FilterField(c.Name, "!=", c.Value)
-		case *depot.LTCondition:
-			q = q.FilterField(c.Name, "<", c.Value)
-		case *depot.LTECondition:
-			q = q.FilterField(c.Name, "<=", c.Value)
-		case *depot.GTCondition:
-			q = q.FilterField(c.Name, ">", c.Value)
-		case *depot.GTECondition:
-			q = q.FilterField(c.Name, ">=", c.Value)
-		case *depot.ExistsCondition:
-			q = q.FilterField(c.Name, "!=", "-DEAD-BEEF-")
-		default:
-			q = q.FilterField(c.Name, "=", c.Value)
+		if f, err = entityFilter(c); err != nil {
+			return
 		}
+		q = q.FilterEntity(f)
 	}
 	return
 }
 
-func applyQueryDirectives(in *datastore.Query, ops []depot.QueryOp, sortField string) (q *datastore.Query, offset int, err error) {
+// entityFilter returns the filter matching c. Datastore has no negation, so the
+// condition a Not wraps is negated instead.
+func entityFilter(c depot.EntityCondition) (f datastore.EntityFilter, err error) {
+	switch v := c.Op.(type) {
+	case *depot.OrCondition, *depot.AndCondition:
+		filters := make([]datastore.EntityFilter, len(c.Conditions))
+		for i, sub := range c.Conditions {
+			if filters[i], err = entityFilter(sub); err != nil {
+				return
+			}
+		}
+		if _, ok := v.(*depot.OrCondition); ok {
+			return datastore.OrFilter{Filters: filters}, nil
+		}
+		return datastore.AndFilter{Filters: filters}, nil
+	case *depot.NotCondition:
+		if c, err = c.Conditions[0].Negate(); err != nil {
+			return
+		}
+		return entityFilter(c)
+	case *depot.NotEqualCondition:
+		return propertyFilter(c.Name, "!=", c.Value), nil
+	case *depot.LTCondition:
+		return propertyFilter(c.Name, "<", c.Value), nil
+	case *depot.LTECondition:
+		return propertyFilter(c.Name, "<=", c.Value), nil
+	case *depot.GTCondition:
+		return propertyFilter(c.Name, ">", c.Value), nil
+	case *depot.GTECondition:
+		return propertyFilter(c.Name, ">=", c.Value), nil
+	case *depot.ExistsCondition:
+		return propertyFilter(c.Name, "!=", "-DEAD-BEEF-"), nil
+	case *depot.InCondition:
+		return propertyFilter(c.Name, "in", v.List()), nil
+	case *depot.NotInCondition:
+		return propertyFilter(c.Name, "not-in", v.List()), nil
+	case *depot.BeginsWithCondition:
+		return datastore.AndFilter{Filters: []datastore.EntityFilter{
+			propertyFilter(c.Name, ">=", c.Value),
+			propertyFilter(c.Name, "<", depot.PrefixEnd(c.Value)),
+		}}, nil
+	case *depot.ContainsCondition:
+		// Datastore only finds elements of lists, which an equality filter
+		// matches.
+		list := depot.ListValues(c.Value)
+		if list == nil {
+			return propertyFilter(c.Name, "=", c.Value), nil
+		}
+		filters := make([]datastore.EntityFilter, len(list))
+		for i, v := range list {
+			filters[i] = propertyFilter(c.Name, "=", v)
+		}
+		return datastore.AndFilter{Filters: filters}, nil
+	case *depot.BetweenCondition:
+		return datastore.AndFilter{Filters: []datastore.EntityFilter{
+			propertyFilter(c.Name, ">=", v.From()),
+			propertyFilter(c.Name, "<=", v.To()),
+		}}, nil
+	}
+	return propertyFilter(c.Name, "=", c.Value), nil
+}
+
+func propertyFilter(name, operator string, value interface{}) datastore.EntityFilter {
+	return datastore.PropertyFilter{FieldName: name, Operator: operator, Value: value}
+}
+
+func applyQueryDirectives(in *datastore.Query, ops []depot.QueryOp, sortField string) (q *datastore.Query, limit int, err error) {
+	var cursor datastore.Cursor
 	q = in
 	for _, op := range ops {
 		if d, ok := op.(depot.QueryDirective); ok {
 			switch v := d.(type) {
 			case *depot.LimitQueryDirective:
-				q = q.Limit(v.Limit)
+				limit = v.Limit
+				q = q.Limit(v.Limit + 1)
 			case *depot.PageQueryDirective:
-				// if cursor, err = datastore.DecodeCursor(v.Page); err != nil {
-				// 	return
-				// }
-				// q = q.Start(cursor)
-				if offset, err = strconv.Atoi(v.Page); err != nil {
-					return
+				if v.Page != "" {
+					if cursor, err = datastore.DecodeCursor(v.Page); err != nil {
+						return q, 0, fmt.Errorf("%w: %v", depot.ErrInvalidPage, err)
+					}
+					q = q.Start(cursor)
 				}
-				q = q.Offset(offset)
 			case *depot.AscQueryDirective:
 				if sortField == "" {
 					return q, 0, depot.ErrNoSortField
@@ -253,6 +736,9 @@ func applyQueryDirectives(in *datastore.Query, ops []depot.QueryOp, sortField st
 					return q, 0, depot.ErrNoSortField
 				}
 				q = q.Order("-" + sortField)
+			case *depot.ConsistentQueryDirective:
+				// Queries are strongly consistent unless made eventual, as
+				// lookups by key always are, so there is nothing to change.
 			}
 		}
 	}
@@ -286,12 +772,239 @@ func LoadKey(kind string, entity interface{}) (k *datastore.Key, err error) {
 	return &datastore.Key{Kind: kind, Name: key.String()}, nil
 }
 
+type transaction struct {
+	tx    *datastore.Transaction
+	clock func() time.Time
+	bumps depot.VersionBumps
+}
+
+var _ depot.Tx = &transaction{}
+
+func (t *transaction) Get(table string, entity interface{}, op ...depot.GetOp) (err error) {
+	var (
+		k   *datastore.Key
+		dst *datastoreEntity
+	)
+	if k, err = LoadKey(table, entity); err != nil {
+		return
+	}
+	// A transaction reads the present state it is to write over.
+	if !depot.ReadTime(op).IsZero() {
+		return depot.ErrUnsupported
+	}
+	if dst, err = selectedEntity(entity, op); err != nil {
+		return
+	}
+	if err = t.tx.Get(k, dst); errors.Is(err, datastore.ErrNoSuchEntity) {
+		return depot.ErrEntityNotFound
+	}
+	return
+}
+
+func (t *transaction) Put(table string, entity interface{}, op ...depot.Condition) (err error) {
+	var (
+		k   *datastore.Key
+		src *datastoreEntity
+	)
+	if k, err = LoadKey(table, entity); err != nil {
+		return
+	}
+	if src, err = newDatastoreEntity(entity); err != nil {
+		return
+	}
+	if err = t.check(k, src, op, src.timestamps); err != nil {
+		return
+	}
+	if err = src.stamp(); err != nil {
+		return
+	}
+	_, err = t.put(k, src)
+	return
+}
+
+func (t *transaction) Delete(table string, entity interface{}, op ...depot.Condition) (err error) {
+	var (
+		k   *datastore.Key
+		src *datastoreEntity
+	)
+	if k, err = LoadKey(table, entity); err != nil {
+		return
+	}
+	if src, err = newDatastoreEntity(entity); err != nil {
+		return
+	}
+	if err = t.check(k, src, op, nil); err != nil {
+		return
+	}
+	return t.tx.Delete(k)
+}
+
+func (t *transaction) Create(table string, entity interface{}) (err error) {
+	var (
+		k   *datastore.Key
+		src *datastoreEntity
+	)
+	if k, err = LoadKey(table, entity); err != nil {
+		return
+	}
+	if src, err = newDatastoreEntity(entity); err != nil {
+		return
+	}
+	if src.timestamps != nil {
+		src.timestamps.Create(t.clock())
+	}
+	if err = src.stamp(); err != nil {
+		return
+	}
+	if _, err = t.tx.Mutate(datastore.NewInsert(k, src)); err != nil {
+		return
+	}
+	t.bump(src)
+	return
+}
+
+func (t *transaction) Update(table string, entity interface{}, op ...depot.UpdateOp) error {
+	return t.update(table, entity, op)
+}
+
+// put writes src and bumps its version once the transaction commits.
+func (t *transaction) put(k *datastore.Key, src *datastoreEntity) (*datastore.PendingKey, error) {
+	pk, err := t.tx.Put(k, src)
+	if err == nil {
+		t.bump(src)
+	}
+	return pk, err
+}
+
+func (t *transaction) bump(src *datastoreEntity) {
+	if src.version != nil {
+		t.bumps.Add(src.entity, src.version.Next())
+	}
+}
+
+// check reads k and fails with depot.ErrVersionConflict unless it holds the
+// version of src, and with a *depot.ConditionError unless it satisfies the
+// conditions. A put passes its timestamps, which are stamped over the created
+// time k holds.
+func (t *transaction) check(k *datastore.Key, src *datastoreEntity, op []depot.Condition, ts *depot.Timestamps) (err error) {
+	var (
+		conditions []depot.EntityCondition
+		propMap    = make(datastoreMap)
+		existing   map[string]interface{}
+	)
+	if len(op) > 0 || src.version != nil || (ts != nil && ts.Created != "") {
+		if err = t.tx.Get(k, propMap); errors.Is(err, datastore.ErrNoSuchEntity) {
+			err = nil
+		} else if err != nil {
+			return
+		} else {
+			existing = propMap.values()
+		}
+	}
+	if ts != nil {
+		ts.Put(t.clock(), existing)
+	}
+	if src.version != nil {
+		if err = depot.CheckVersion(*src.version, existing); err != nil {
+			return
+		}
+	}
+	if len(op) == 0 {
+		return
+	}
+	if conditions, err = depot.EntityPreconditions(src.entity, op); err != nil {
+		return
+	}
+	return depot.CheckConditions(conditions, existing)
+}
+
+func loadKeys(kind string, v reflect.Value) (keys []*datastore.Key, err error) {
+	var k *datastore.Key
+	for i := 0; i < v.Len(); i++ {
+		if k, err = LoadKey(kind, v.Index(i).Addr().Interface()); err != nil {
+			return
+		}
+		keys = append(keys, k)
+	}
+	return
+}
+
 type datastoreEntity struct {
 	entity interface{}
+	// projection, when set, names the only fields loaded into entity.
+	projection []string
+	// version, when set, is saved as its next value in place of the one held
+	// by entity.
+	version *depot.Version
+	// timestamps, when set, are saved in place of the times held by entity.
+	timestamps *depot.Timestamps
+	// removed names the fields that are left out of the saved properties.
+	removed []string
+}
+
+func newDatastoreEntity(entity interface{}) (d *datastoreEntity, err error) {
+	var (
+		v         depot.Version
+		versioned bool
+		ts        depot.Timestamps
+	)
+	if v, versioned, err = depot.EntityVersion(entity); err != nil {
+		return
+	}
+	if ts, err = depot.EntityTimestamps(entity); err != nil {
+		return
+	}
+	d = &datastoreEntity{entity: entity}
+	if versioned {
+		d.version = &v
+	}
+	if ts.Stamped() {
+		d.timestamps = &ts
+	}
+	return
+}
+
+// stamp sets the times written by d on its entity.
+func (d *datastoreEntity) stamp() error {
+	if d.timestamps == nil {
+		return nil
+	}
+	return d.timestamps.Set(d.entity)
 }
 
+// Load sets the loaded properties on the entity. A projection is loaded with its
+// other fields cleared, and projection queries name nested properties by dotted
+// path.
 func (d *datastoreEntity) Load(properties []datastore.Property) (err error) {
-	return depot.EntityFromProperties(fromDatastoreProps(properties), d.entity)
+	if d.projection == nil {
+		return depot.EntityFromProperties(fromDatastoreProps(properties), d.entity)
+	}
+	m := make(map[string]interface{}, len(properties))
+	for _, prop := range fromDatastoreProps(properties) {
+		if depot.IsPath(prop.Name) {
+			err = depot.SetPathValue(m, prop.Name, prop.Value)
+		} else {
+			m[prop.Name] = prop.Value
+		}
+		if err != nil {
+			return
+		}
+	}
+	if err = depot.ResetEntity(d.entity); err != nil {
+		return
+	}
+	return depot.EntityFromMap(depot.ProjectMap(m, d.projection), d.entity, false)
+}
+
+// selectedEntity returns the destination that loads entity, or only the fields
+// that op selects. Datastore reads whole entities by key, so the others are
+// dropped as they load.
+func selectedEntity(entity interface{}, op []depot.GetOp) (d *datastoreEntity, err error) {
+	d = &datastoreEntity{entity: entity}
+	if fields := depot.Selected(op); fields != nil {
+		d.projection, err = depot.Projection("", entity, fields)
+	}
+	return
 }
 
 func (d *datastoreEntity) Save() (datastoreProps []datastore.Property, err error) {
@@ -299,14 +1012,61 @@ func (d *datastoreEntity) Save() (datastoreProps []datastore.Property, err error
 	if props, err = depot.EntityProperties(d.entity); err != nil {
 		return
 	}
+	if d.version != nil {
+		for i := range props {
+			if props[i].Name == d.version.Name {
+				props[i].Value = d.version.Next()
+			}
+		}
+	}
+	if d.timestamps != nil {
+		props = stampProperties(props, d.timestamps.Updates())
+	}
+	if len(d.removed) > 0 {
+		props = removeProperties(props, d.removed)
+	}
 	return toDatastoreProps(props), nil
 }
 
+// stampProperties sets the stamped times in props, adding the fields that were
+// omitted for being empty.
+func stampProperties(props []depot.Property, stamps []depot.Update) []depot.Property {
+	for _, u := range stamps {
+		found := false
+		for i := range props {
+			if props[i].Name == u.Name {
+				props[i].Value, found = u.Value, true
+			}
+		}
+		if !found {
+			props = append(props, depot.Property{Name: u.Name, Value: u.Value})
+		}
+	}
+	return props
+}
+
+func removeProperties(props []depot.Property, removed []string) (out []depot.Property) {
+	for _, prop := range props {
+		if !slices.Contains(removed, prop.Name) {
+			out = append(out, prop)
+		}
+	}
+	return
+}
+
 type datastoreMap map[string]depot.Property
 
 func (d datastoreMap) Load(properties []datastore.Property) (err error) {
 	for _, prop := range properties {
-		d[prop.Name] = depot.Property{Name: prop.Name, Value: prop.Value}
+		d[prop.Name] = depot.Property{Name: prop.Name, Value: plainValue(prop.Value)}
+	}
+	return
+}
+
+func (d datastoreMap) values() (m map[string]interface{}) {
+	m = make(map[string]interface{}, len(d))
+	for name, prop := range d {
+		m[name] = prop.Value
 	}
 	return
 }
@@ -315,12 +1075,16 @@ func (d datastoreMap) Save() (datastoreProps []datastore.Property, err error) {
 	panic("not implemented")
 }
 
+// toDatastoreProps converts the properties, leaving those holding nested
+// entities indexed so that their own properties can be.
 func toDatastoreProps(in []depot.Property) (out []datastore.Property) {
 	for _, prop := range in {
+		v := entityValue(prop.Value)
+		_, nested := v.(*datastore.Entity)
 		out = append(out, datastore.Property{
 			Name:    prop.Name,
-			Value:   prop.Value,
-			NoIndex: !prop.Index,
+			Value:   v,
+			NoIndex: !prop.Index && !nested,
 		})
 	}
 	return
@@ -330,8 +1094,48 @@ func fromDatastoreProps(in []datastore.Property) (out []depot.Property) {
 	for _, prop := range in {
 		out = append(out, depot.Property{
 			Name:  prop.Name,
-			Value: prop.Value,
+			Value: plainValue(prop.Value),
 		})
 	}
 	return
 }
+
+// entityValue stores maps and structs as nested entities, whose properties are
+// indexed so that queries can filter on them by dotted path.
+func entityValue(v interface{}) interface{} {
+	var (
+		rv    = reflect.ValueOf(v)
+		props []depot.Property
+	)
+	switch {
+	case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+		iter := rv.MapRange()
+		for iter.Next() {
+			props = append(props, depot.Property{Name: iter.Key().String(), Value: iter.Value().Interface(), Index: true})
+		}
+	case rv.Kind() == reflect.Struct && rv.Type() != reflect.TypeOf(time.Time{}):
+		var err error
+		if props, err = depot.EntityProperties(v); err != nil {
+			return v
+		}
+		for i := range props {
+			props[i].Index = true
+		}
+	default:
+		return v
+	}
+	return &datastore.Entity{Properties: toDatastoreProps(props)}
+}
+
+// plainValue turns nested entities back into maps.
+func plainValue(v interface{}) interface{} {
+	e, ok := v.(*datastore.Entity)
+	if !ok || e == nil {
+		return v
+	}
+	m := make(map[string]interface{}, len(e.Properties))
+	for _, prop := range e.Properties {
+		m[prop.Name] = plainValue(prop.Value)
+	}
+	return m
+}
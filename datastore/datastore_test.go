@@ -0,0 +1,48 @@
+package datastore
+
+import (
+	"testing"
+
+	"github.com/andyday/depot"
+	"github.com/stretchr/testify/assert"
+)
+
+type message struct {
+	TenantID string `depot:"tenantId,pk"`
+	ID       int64  `depot:"id,sk"`
+	Body     string `depot:"body"`
+}
+
+type tag struct {
+	Owner string `depot:"owner,pk"`
+	Name  string `depot:"name,sk"`
+}
+
+func TestKeyNames(t *testing.T) {
+	k, ok := newKeyNames(&message{}, nil)
+	assert.True(t, ok)
+	assert.True(t, k.covers([]string{"tenantId", "id"}))
+	assert.False(t, k.covers([]string{"tenantId", "id", "body"}))
+	m, err := k.values("a:b:7")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"tenantId": "a:b", "id": int64(7)}, m)
+
+	// Two string key fields only split apart when one is fixed.
+	_, ok = newKeyNames(&tag{}, nil)
+	assert.False(t, ok)
+	k, ok = newKeyNames(&tag{}, map[string]interface{}{"owner": "a:b"})
+	assert.True(t, ok)
+	m, err = k.values("a:b:c:d")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"owner": "a:b", "name": "c:d"}, m)
+	k, _ = newKeyNames(&tag{}, map[string]interface{}{"name": "d"})
+	m, err = k.values("a:b:c:d")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"owner": "a:b:c", "name": "d"}, m)
+
+	k, _ = newKeyNames(&message{}, nil)
+	_, err = k.values("a:x")
+	assert.Error(t, err)
+	_, err = k.values("a")
+	assert.ErrorIs(t, err, depot.ErrInvalidEntityType)
+}
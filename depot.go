@@ -2,24 +2,52 @@ package depot
 
 import (
 	"context"
+	"errors"
 )
 
 type Database interface {
-	Get(ctx context.Context, table string, entity interface{}) error
-	Put(ctx context.Context, table string, entity interface{}) error
-	Delete(ctx context.Context, table string, entity interface{}) error
+	Get(ctx context.Context, table string, entity interface{}, op ...GetOp) error
+	Put(ctx context.Context, table string, entity interface{}, op ...Condition) error
+	Delete(ctx context.Context, table string, entity interface{}, op ...Condition) error
 	Create(ctx context.Context, table string, entity interface{}) error
 	Update(ctx context.Context, table string, entity interface{}, op ...UpdateOp) error
 	Query(ctx context.Context, table, kind string, entity interface{}, entities interface{}, op ...QueryOp) (string, error)
+	Aggregate(ctx context.Context, table, kind string, entity interface{}, agg Aggregate, field string, op ...QueryOp) (float64, error)
+	BatchGet(ctx context.Context, table string, entities interface{}) error
+	BatchPut(ctx context.Context, table string, entities interface{}) error
+	BatchDelete(ctx context.Context, table string, entities interface{}) error
+	RunInTransaction(ctx context.Context, fn func(tx Tx) error) error
+}
+
+// Tx is the set of operations available inside RunInTransaction. The writes are
+// committed together when fn returns nil and discarded otherwise. Reads should
+// be made before any writes since not every backend can read its own
+// uncommitted writes. fn may run more than once when what it read changes
+// before its writes commit.
+type Tx interface {
+	Get(table string, entity interface{}, op ...GetOp) error
+	Put(table string, entity interface{}, op ...Condition) error
+	Delete(table string, entity interface{}, op ...Condition) error
+	Create(table string, entity interface{}) error
+	Update(table string, entity interface{}, op ...UpdateOp) error
 }
 
 type Table[T any] interface {
-	Put(ctx context.Context, entity T) (T, error)
-	Get(ctx context.Context, entity T) (T, error)
-	Delete(ctx context.Context, entity T) (T, error)
+	Put(ctx context.Context, entity T, op ...Condition) (T, error)
+	Get(ctx context.Context, entity T, op ...GetOp) (T, error)
+	Exists(ctx context.Context, entity T) (bool, error)
+	Delete(ctx context.Context, entity T, op ...Condition) (T, error)
 	Create(ctx context.Context, entity T) (T, error)
 	Update(ctx context.Context, entity T, op ...UpdateOp) (T, error)
 	Query(ctx context.Context, kind string, entity T, op ...QueryOp) ([]T, string, error)
+	Iterate(ctx context.Context, kind string, entity T, op ...QueryOp) *Iterator[T]
+	Keys(ctx context.Context, kind string, entity T, op ...QueryOp) ([]Key, string, error)
+	Count(ctx context.Context, kind string, entity T, op ...QueryOp) (int64, error)
+	Sum(ctx context.Context, kind string, entity T, field string, op ...QueryOp) (float64, error)
+	Avg(ctx context.Context, kind string, entity T, field string, op ...QueryOp) (float64, error)
+	BatchGet(ctx context.Context, entities []T) ([]T, error)
+	BatchPut(ctx context.Context, entities []T) error
+	BatchDelete(ctx context.Context, entities []T) error
 }
 
 type table[T any] struct {
@@ -31,22 +59,31 @@ func NewTable[T any](db Database, tbl string) Table[T] {
 	return &table[T]{db: db, table: tbl}
 }
 
-func (t *table[T]) Put(ctx context.Context, entity T) (out T, err error) {
-	if err = t.db.Put(ctx, t.table, &entity); err != nil {
+func (t *table[T]) Put(ctx context.Context, entity T, op ...Condition) (out T, err error) {
+	if err = t.db.Put(ctx, t.table, &entity, op...); err != nil {
 		return
 	}
 	return entity, nil
 }
 
-func (t *table[T]) Get(ctx context.Context, entity T) (out T, err error) {
-	if err = t.db.Get(ctx, t.table, &entity); err != nil {
+func (t *table[T]) Get(ctx context.Context, entity T, op ...GetOp) (out T, err error) {
+	if err = t.db.Get(ctx, t.table, &entity, op...); err != nil {
 		return
 	}
 	return entity, nil
 }
 
-func (t *table[T]) Delete(ctx context.Context, entity T) (out T, err error) {
-	if err = t.db.Delete(ctx, t.table, &entity); err != nil {
+// Exists reports whether an entity with the key of entity is stored, loading
+// no more of it than its key.
+func (t *table[T]) Exists(ctx context.Context, entity T) (ok bool, err error) {
+	if err = t.db.Get(ctx, t.table, &entity, Select()); errors.Is(err, ErrEntityNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (t *table[T]) Delete(ctx context.Context, entity T, op ...Condition) (out T, err error) {
+	if err = t.db.Delete(ctx, t.table, &entity, op...); err != nil {
 		return
 	}
 	return entity, nil
@@ -69,3 +106,83 @@ func (t *table[T]) Query(ctx context.Context, kind string, entityFilter T, op ..
 	nextPage, err = t.db.Query(ctx, t.table, kind, &entityFilter, &entities, op...)
 	return
 }
+
+// Iterate runs the query page by page. A Page op sets where the iteration
+// starts and a Limit op sets the page size.
+func (t *table[T]) Iterate(ctx context.Context, kind string, entityFilter T, op ...QueryOp) *Iterator[T] {
+	var (
+		page string
+		ops  []QueryOp
+	)
+	for _, o := range op {
+		if p, ok := o.(*PageQueryDirective); ok {
+			page = p.Page
+			continue
+		}
+		ops = append(ops, o)
+	}
+	return &Iterator[T]{
+		ctx:  ctx,
+		page: page,
+		fetch: func(ctx context.Context, page string) ([]T, string, error) {
+			return t.Query(ctx, kind, entityFilter, append(ops, Page(page))...)
+		},
+	}
+}
+
+// Keys runs the query loading only the keys of the entities it matches. Pages
+// work as they do for Query.
+func (t *table[T]) Keys(ctx context.Context, kind string, entityFilter T, op ...QueryOp) (keys []Key, nextPage string, err error) {
+	var entities []T
+	if nextPage, err = t.db.Query(ctx, t.table, kind, &entityFilter, &entities, append([]QueryOp{Select()}, op...)...); err != nil {
+		return
+	}
+	keys = make([]Key, len(entities))
+	for i := range entities {
+		if keys[i], err = EntityKey(&entities[i]); err != nil {
+			return nil, "", err
+		}
+	}
+	return
+}
+
+// Count returns the number of entities the query matches. Like Sum and Avg it
+// takes the conditions of a query and ignores its directives.
+func (t *table[T]) Count(ctx context.Context, kind string, entityFilter T, op ...QueryOp) (count int64, err error) {
+	var n float64
+	if n, err = t.db.Aggregate(ctx, t.table, kind, &entityFilter, AggregateCount, "", op...); err != nil {
+		return
+	}
+	return int64(n), nil
+}
+
+// Sum returns the total of the numeric field across the entities the query
+// matches.
+func (t *table[T]) Sum(ctx context.Context, kind string, entityFilter T, field string, op ...QueryOp) (float64, error) {
+	return t.db.Aggregate(ctx, t.table, kind, &entityFilter, AggregateSum, field, op...)
+}
+
+// Avg returns the mean of the numeric field across the entities the query
+// matches, or 0 when none has it.
+func (t *table[T]) Avg(ctx context.Context, kind string, entityFilter T, field string, op ...QueryOp) (float64, error) {
+	return t.db.Aggregate(ctx, t.table, kind, &entityFilter, AggregateAvg, field, op...)
+}
+
+// BatchGet loads the entities matching the keys of the given entities. Entities
+// that do not exist are left out of the result, which otherwise keeps the
+// order of the keys.
+func (t *table[T]) BatchGet(ctx context.Context, entities []T) (out []T, err error) {
+	out = append([]T(nil), entities...)
+	if err = t.db.BatchGet(ctx, t.table, &out); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (t *table[T]) BatchPut(ctx context.Context, entities []T) (err error) {
+	return t.db.BatchPut(ctx, t.table, entities)
+}
+
+func (t *table[T]) BatchDelete(ctx context.Context, entities []T) (err error) {
+	return t.db.BatchDelete(ctx, t.table, entities)
+}
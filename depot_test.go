@@ -14,6 +14,7 @@ import (
 var errTest = errors.New("test error")
 
 type Record struct {
+	ID   string `depot:"id,pk"`
 	Name string
 }
 
@@ -53,6 +54,34 @@ func (s *DepotSuite) TestGet() {
 	s.db.On("Get", s.ctx, "record", &in).Return(errTest).Once()
 	_, err = s.tbl.Get(s.ctx, in)
 	s.ErrorIs(err, errTest)
+
+	sel := depot.Select("name")
+	s.db.On("Get", s.ctx, "record", &in, sel).Return(nil).Once()
+	_, err = s.tbl.Get(s.ctx, in, sel)
+	s.NoError(err)
+}
+
+func (s *DepotSuite) TestExists() {
+	var (
+		in  = Record{ID: "record"}
+		sel = depot.Select()
+		ok  bool
+		err error
+	)
+	s.db.On("Get", s.ctx, "record", &in, sel).Return(nil).Once()
+	ok, err = s.tbl.Exists(s.ctx, in)
+	s.NoError(err)
+	s.True(ok)
+
+	s.db.On("Get", s.ctx, "record", &in, sel).Return(depot.ErrEntityNotFound).Once()
+	ok, err = s.tbl.Exists(s.ctx, in)
+	s.NoError(err)
+	s.False(ok)
+
+	s.db.On("Get", s.ctx, "record", &in, sel).Return(errTest).Once()
+	ok, err = s.tbl.Exists(s.ctx, in)
+	s.ErrorIs(err, errTest)
+	s.False(ok)
 }
 
 func (s *DepotSuite) TestPut() {
@@ -147,3 +176,170 @@ func (s *DepotSuite) TestQuery() {
 	s.Equal("next", next)
 	s.Equal(entities, out)
 }
+
+func (s *DepotSuite) TestKeys() {
+	var (
+		in     = Record{Name: "record"}
+		inList []Record
+		op     = depot.Equal("name")
+		keys   []depot.Key
+		next   string
+		err    error
+	)
+	s.db.On("Query", s.ctx, "record", "kind", &in, &inList, depot.Select(), op).
+		Return("next", nil).
+		Run(func(args mock.Arguments) {
+			arg := args.Get(4).(*[]Record)
+			*arg = []Record{{ID: "a"}, {ID: "b"}}
+		}).
+		Once()
+
+	keys, next, err = s.tbl.Keys(s.ctx, "kind", in, op)
+	s.NoError(err)
+	s.Equal("next", next)
+	s.Equal([]depot.Key{
+		{Partition: depot.KeyPart{Name: "id", Value: "a"}},
+		{Partition: depot.KeyPart{Name: "id", Value: "b"}},
+	}, keys)
+
+	s.db.On("Query", s.ctx, "record", "", &in, &inList, depot.Select()).Return("", errTest).Once()
+	_, _, err = s.tbl.Keys(s.ctx, "", in)
+	s.ErrorIs(err, errTest)
+}
+
+func (s *DepotSuite) TestAggregate() {
+	var (
+		in    = Record{Name: "record"}
+		op    = depot.Equal("name")
+		count int64
+		n     float64
+		err   error
+	)
+	s.db.On("Aggregate", s.ctx, "record", "kind", &in, depot.AggregateCount, "", op).Return(float64(3), nil).Once()
+	count, err = s.tbl.Count(s.ctx, "kind", in, op)
+	s.NoError(err)
+	s.Equal(int64(3), count)
+
+	s.db.On("Aggregate", s.ctx, "record", "kind", &in, depot.AggregateSum, "count", op).Return(float64(21), nil).Once()
+	n, err = s.tbl.Sum(s.ctx, "kind", in, "count", op)
+	s.NoError(err)
+	s.Equal(float64(21), n)
+
+	s.db.On("Aggregate", s.ctx, "record", "", &in, depot.AggregateAvg, "count").Return(float64(3.5), nil).Once()
+	n, err = s.tbl.Avg(s.ctx, "", in, "count")
+	s.NoError(err)
+	s.Equal(3.5, n)
+
+	s.db.On("Aggregate", s.ctx, "record", "", &in, depot.AggregateCount, "").Return(float64(0), errTest).Once()
+	_, err = s.tbl.Count(s.ctx, "", in)
+	s.ErrorIs(err, errTest)
+}
+
+func (s *DepotSuite) TestBatchGet() {
+	var (
+		in  = []Record{{Name: "a"}, {Name: "b"}}
+		out []Record
+		err error
+	)
+	s.db.On("BatchGet", s.ctx, "record", &in).Return(nil).Run(func(args mock.Arguments) {
+		arg := args.Get(2).(*[]Record)
+		*arg = (*arg)[:1]
+	}).Once()
+
+	out, err = s.tbl.BatchGet(s.ctx, in)
+	s.NoError(err)
+	s.Equal([]Record{{Name: "a"}}, out)
+	s.Len(in, 2)
+
+	s.db.On("BatchGet", s.ctx, "record", &in).Return(errTest).Once()
+	out, err = s.tbl.BatchGet(s.ctx, in)
+	s.ErrorIs(err, errTest)
+	s.Nil(out)
+}
+
+func (s *DepotSuite) TestBatchPut() {
+	in := []Record{{Name: "a"}, {Name: "b"}}
+	s.db.On("BatchPut", s.ctx, "record", in).Return(nil).Once()
+	s.NoError(s.tbl.BatchPut(s.ctx, in))
+
+	s.db.On("BatchPut", s.ctx, "record", in).Return(errTest).Once()
+	s.ErrorIs(s.tbl.BatchPut(s.ctx, in), errTest)
+}
+
+func (s *DepotSuite) TestBatchDelete() {
+	in := []Record{{Name: "a"}, {Name: "b"}}
+	s.db.On("BatchDelete", s.ctx, "record", in).Return(nil).Once()
+	s.NoError(s.tbl.BatchDelete(s.ctx, in))
+
+	s.db.On("BatchDelete", s.ctx, "record", in).Return(errTest).Once()
+	s.ErrorIs(s.tbl.BatchDelete(s.ctx, in), errTest)
+}
+
+func (s *DepotSuite) TestIterate() {
+	var (
+		in    = Record{Name: "record"}
+		limit = depot.Limit(2)
+		pages = map[string][]Record{
+			"":   {{Name: "a"}, {Name: "b"}},
+			"p1": {},
+			"p2": {{Name: "c"}},
+		}
+		next = map[string]string{"": "p1", "p1": "p2", "p2": ""}
+		out  []Record
+	)
+	for page := range pages {
+		s.db.On("Query", s.ctx, "record", "kind", &in, mock.Anything, limit, depot.Page(page)).
+			Return(next[page], nil).
+			Run(func(args mock.Arguments) {
+				arg := args.Get(4).(*[]Record)
+				*arg = pages[page]
+			}).
+			Once()
+	}
+
+	it := s.tbl.Iterate(s.ctx, "kind", in, limit)
+	for it.Next() {
+		out = append(out, it.Value())
+	}
+	s.NoError(it.Err())
+	s.Equal([]Record{{Name: "a"}, {Name: "b"}, {Name: "c"}}, out)
+	s.False(it.Next())
+}
+
+func (s *DepotSuite) TestIterateStartPage() {
+	in := Record{Name: "record"}
+	s.db.On("Query", s.ctx, "record", "", &in, mock.Anything, depot.Page("p1")).
+		Return("", nil).
+		Run(func(args mock.Arguments) {
+			arg := args.Get(4).(*[]Record)
+			*arg = []Record{{Name: "c"}}
+		}).
+		Once()
+
+	it := s.tbl.Iterate(s.ctx, "", in, depot.Page("p1"))
+	s.True(it.Next())
+	s.Equal(Record{Name: "c"}, it.Value())
+	s.False(it.Next())
+	s.NoError(it.Err())
+}
+
+func (s *DepotSuite) TestIterateError() {
+	in := Record{Name: "record"}
+	s.db.On("Query", s.ctx, "record", "", &in, mock.Anything, depot.Page("")).
+		Return("", errTest).
+		Once()
+
+	it := s.tbl.Iterate(s.ctx, "", in)
+	s.False(it.Next())
+	s.ErrorIs(it.Err(), errTest)
+	s.False(it.Next())
+}
+
+func (s *DepotSuite) TestIterateCanceled() {
+	ctx, cancel := context.WithCancel(s.ctx)
+	cancel()
+
+	it := s.tbl.Iterate(ctx, "", Record{})
+	s.False(it.Next())
+	s.ErrorIs(it.Err(), context.Canceled)
+}
@@ -0,0 +1,1208 @@
+package depottest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/andyday/depot"
+	"github.com/andyday/go-log"
+)
+
+func (s *Suite) TestPut() {
+	var widget Widget
+	expected := testWidget
+	_, err := s.widgets.Put(s.ctx, expected)
+	s.NoError(err)
+	widget, err = s.widgets.Get(s.ctx, testWidgetKey)
+	s.NoError(err)
+	log.Infof(s.ctx, "Widget: %+v", widget)
+	s.equals(expected, widget)
+	expected.Name = "Widget (edited)"
+	_, err = s.widgets.Put(s.ctx, expected)
+	s.NoError(err)
+	widget, err = s.widgets.Get(s.ctx, testWidgetKey)
+	s.NoError(err)
+	log.Infof(s.ctx, "Widget: %+v", widget)
+	s.equals(expected, widget)
+}
+
+func (s *Suite) TestGetNotFound() {
+	_, err := s.widgets.Get(s.ctx, testWidgetKey)
+	s.ErrorIs(err, depot.ErrEntityNotFound)
+}
+
+func (s *Suite) TestCreate() {
+	var widget Widget
+	expected := testWidget
+	_, err := s.widgets.Create(s.ctx, expected)
+	s.NoError(err)
+	widget, err = s.widgets.Get(s.ctx, testWidgetKey)
+	s.NoError(err)
+	log.Infof(s.ctx, "Widget: %+v", widget)
+	s.equals(expected, widget)
+
+	_, err = s.widgets.Create(s.ctx, expected)
+	s.ErrorIs(err, depot.ErrEntityAlreadyExists)
+}
+
+func (s *Suite) TestDelete() {
+	_, err := s.widgets.Put(s.ctx, testWidget)
+	s.NoError(err)
+	_, err = s.widgets.Delete(s.ctx, testWidgetKey)
+	s.NoError(err)
+	_, err = s.widgets.Get(s.ctx, testWidgetKey)
+	s.ErrorIs(err, depot.ErrEntityNotFound)
+
+	// Deleting an entity that does not exist is not an error.
+	_, err = s.widgets.Delete(s.ctx, testWidgetKey)
+	s.NoError(err)
+}
+
+func (s *Suite) TestPutConditions() {
+	_, err := s.widgets.Put(s.ctx, testWidget, depot.Exists("id"))
+	s.ErrorIs(err, depot.ErrConditionFailed)
+	_, err = s.widgets.Get(s.ctx, testWidgetKey)
+	s.ErrorIs(err, depot.ErrEntityNotFound)
+
+	_, err = s.widgets.Put(s.ctx, testWidget)
+	s.NoError(err)
+
+	edited := testWidget
+	edited.Name = "Widget (edited)"
+	_, err = s.widgets.Put(s.ctx, edited, depot.Equal("version"), depot.Equal("status"))
+	s.NoError(err)
+
+	edited.Name = "Widget (stale)"
+	edited.Version = 100
+	_, err = s.widgets.Put(s.ctx, edited, depot.Equal("version"))
+	s.ErrorIs(err, depot.ErrConditionFailed)
+
+	widget, err := s.widgets.Get(s.ctx, testWidgetKey)
+	s.NoError(err)
+	s.Equal("Widget (edited)", widget.Name)
+	s.Equal(int64(123), widget.Version)
+}
+
+func (s *Suite) TestDeleteConditions() {
+	_, err := s.widgets.Put(s.ctx, testWidget)
+	s.NoError(err)
+
+	key := testWidgetKey
+	key.Status = "Archived"
+	_, err = s.widgets.Delete(s.ctx, key, depot.Equal("status"))
+	s.ErrorIs(err, depot.ErrConditionFailed)
+	_, err = s.widgets.Get(s.ctx, testWidgetKey)
+	s.NoError(err)
+
+	key.Status = testWidget.Status
+	_, err = s.widgets.Delete(s.ctx, key, depot.Equal("status"))
+	s.NoError(err)
+	_, err = s.widgets.Get(s.ctx, testWidgetKey)
+	s.ErrorIs(err, depot.ErrEntityNotFound)
+
+	// Conditions are never met by an entity that does not exist.
+	_, err = s.widgets.Delete(s.ctx, testWidgetKey, depot.Exists("id"))
+	s.ErrorIs(err, depot.ErrConditionFailed)
+}
+
+func (s *Suite) TestTransactionConditions() {
+	s.putWidgets()
+
+	err := s.db.RunInTransaction(s.ctx, func(tx depot.Tx) (err error) {
+		if err = tx.Delete(WidgetTable, &Widget{TenantID: "tenant", ID: "widget1", Count: 1}, depot.Equal("count")); err != nil {
+			return
+		}
+		return tx.Put(WidgetTable, &Widget{TenantID: "tenant", ID: "widget2", Count: 5}, depot.Equal("count"))
+	})
+	s.ErrorIs(err, depot.ErrConditionFailed)
+
+	_, err = s.widgets.Get(s.ctx, Widget{TenantID: "tenant", ID: "widget1"})
+	s.NoError(err)
+	widget, err := s.widgets.Get(s.ctx, Widget{TenantID: "tenant", ID: "widget2"})
+	s.NoError(err)
+	s.Equal(int64(2), widget.Count)
+}
+
+func (s *Suite) TestBatch() {
+	s.NoError(s.widgets.BatchPut(s.ctx, testWidgets))
+
+	keys := []Widget{
+		{TenantID: "tenant", ID: "widget3"},
+		{TenantID: "tenant", ID: "missing"},
+		{TenantID: "tenant", ID: "widget1"},
+	}
+	widgets, err := s.widgets.BatchGet(s.ctx, keys)
+	s.NoError(err)
+	s.Equal([]string{"widget3", "widget1"}, widgetIDs(widgets))
+	if s.Len(widgets, 2) {
+		s.equals(testWidgets[2], widgets[0])
+		s.equals(testWidgets[0], widgets[1])
+	}
+
+	s.NoError(s.widgets.BatchDelete(s.ctx, testWidgets[:3]))
+	widgets, err = s.widgets.BatchGet(s.ctx, testWidgets)
+	s.NoError(err)
+	s.Equal([]string{"widget4", "widget5", "widget6"}, widgetIDs(widgets))
+
+	widgets, err = s.widgets.BatchGet(s.ctx, nil)
+	s.NoError(err)
+	s.Empty(widgets)
+	s.NoError(s.widgets.BatchPut(s.ctx, nil))
+	s.NoError(s.widgets.BatchDelete(s.ctx, nil))
+}
+
+func (s *Suite) TestTransaction() {
+	s.putWidgets()
+
+	err := s.db.RunInTransaction(s.ctx, func(tx depot.Tx) (err error) {
+		from := Widget{TenantID: "tenant", ID: "widget1"}
+		to := Widget{TenantID: "tenant", ID: "widget2"}
+		if err = tx.Get(WidgetTable, &from); err != nil {
+			return
+		}
+		if err = tx.Get(WidgetTable, &to); err != nil {
+			return
+		}
+		from.Count--
+		to.Count++
+		if err = tx.Put(WidgetTable, &from); err != nil {
+			return
+		}
+		if err = tx.Put(WidgetTable, &to); err != nil {
+			return
+		}
+		if err = tx.Update(WidgetTable, &Widget{TenantID: "tenant", ID: "widget5", Count: 10}, depot.Add("count")); err != nil {
+			return
+		}
+		if err = tx.Delete(WidgetTable, &Widget{TenantID: "tenant", ID: "widget6"}); err != nil {
+			return
+		}
+		return tx.Create(MessageTable, &testMessages[0])
+	})
+	s.NoError(err)
+
+	for id, count := range map[string]int64{"widget1": 0, "widget2": 3, "widget5": 15} {
+		widget, err := s.widgets.Get(s.ctx, Widget{TenantID: "tenant", ID: id})
+		s.NoError(err, id)
+		s.Equal(count, widget.Count, id)
+	}
+	_, err = s.widgets.Get(s.ctx, Widget{TenantID: "tenant", ID: "widget6"})
+	s.ErrorIs(err, depot.ErrEntityNotFound)
+	message, err := s.messages.Get(s.ctx, Message{TenantID: "tenant", ID: testMessages[0].ID})
+	s.NoError(err)
+	s.Equal(testMessages[0], message)
+}
+
+func (s *Suite) TestTransactionRollback() {
+	s.putWidgets()
+	errAbort := errors.New("abort")
+
+	err := s.db.RunInTransaction(s.ctx, func(tx depot.Tx) (err error) {
+		if err = tx.Put(WidgetTable, &testWidget); err != nil {
+			return
+		}
+		if err = tx.Update(WidgetTable, &Widget{TenantID: "tenant", ID: "widget3", Count: 10}, depot.Add("count")); err != nil {
+			return
+		}
+		return errAbort
+	})
+	s.ErrorIs(err, errAbort)
+
+	err = s.db.RunInTransaction(s.ctx, func(tx depot.Tx) (err error) {
+		if err = tx.Put(WidgetTable, &testWidget); err != nil {
+			return
+		}
+		return tx.Create(WidgetTable, &testWidgets[3])
+	})
+	s.ErrorIs(err, depot.ErrEntityAlreadyExists)
+
+	_, err = s.widgets.Get(s.ctx, testWidgetKey)
+	s.ErrorIs(err, depot.ErrEntityNotFound)
+	widget, err := s.widgets.Get(s.ctx, Widget{TenantID: "tenant", ID: "widget3"})
+	s.NoError(err)
+	s.Equal(int64(3), widget.Count)
+}
+
+func (s *Suite) TestUpdate() {
+	var widget Widget
+	expected := testWidget
+	_, err := s.widgets.Create(s.ctx, expected)
+	s.NoError(err)
+	_, err = s.widgets.Update(s.ctx, Widget{
+		TenantID:    expected.TenantID,
+		ID:          expected.ID,
+		Description: "New Description",
+		Count:       5,
+		Total:       5,
+		Version:     123,
+		UpdatedAt:   time.Now().UTC(),
+	}, depot.Add("count"), depot.Subtract("total"))
+	s.NoError(err)
+	widget, err = s.widgets.Get(s.ctx, testWidgetKey)
+	s.NoError(err)
+	s.Equal(expected.TenantID, widget.TenantID)
+	s.Equal(expected.ID, widget.ID)
+	s.Equal(expected.Name, widget.Name)
+	s.Equal("New Description", widget.Description)
+	s.Equal(int64(5), widget.Count)
+	s.Equal(int64(-5), widget.Total)
+	s.WithinDuration(expected.CreatedAt, widget.CreatedAt, time.Millisecond)
+
+	_, err = s.widgets.Update(s.ctx, Widget{
+		TenantID: expected.TenantID,
+		ID:       expected.ID,
+		Count:    2,
+		Total:    2,
+	}, depot.Add("count"), depot.Subtract("total"))
+	s.NoError(err)
+	widget, err = s.widgets.Get(s.ctx, testWidgetKey)
+	s.NoError(err)
+	s.Equal(int64(7), widget.Count)
+	s.Equal(int64(-7), widget.Total)
+	s.Equal("New Description", widget.Description)
+}
+
+func (s *Suite) TestUpdateForce() {
+	_, err := s.widgets.Create(s.ctx, testWidget)
+	s.NoError(err)
+
+	// Zero values are ignored unless the field is forced.
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: testWidget.TenantID, ID: testWidget.ID, Name: "Renamed"})
+	s.NoError(err)
+	widget, err := s.widgets.Get(s.ctx, testWidgetKey)
+	s.NoError(err)
+	s.Equal("Renamed", widget.Name)
+	s.Equal(testWidget.Description, widget.Description)
+
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: testWidget.TenantID, ID: testWidget.ID}, depot.Force("desc"))
+	s.NoError(err)
+	widget, err = s.widgets.Get(s.ctx, testWidgetKey)
+	s.NoError(err)
+	s.Equal("Renamed", widget.Name)
+	s.Empty(widget.Description)
+}
+
+func (s *Suite) TestUpdateRemove() {
+	s.putWidgets()
+	key := Widget{TenantID: testWidgets[0].TenantID, ID: testWidgets[0].ID}
+
+	widget, err := s.widgets.Update(s.ctx, Widget{TenantID: key.TenantID, ID: key.ID, Name: "Unexpired", Expiration: testWidgets[0].Expiration},
+		depot.Remove("expiration"))
+	s.NoError(err)
+	s.Nil(widget.Expiration)
+
+	widget, err = s.widgets.Get(s.ctx, key)
+	s.NoError(err)
+	s.Equal("Unexpired", widget.Name)
+	s.Nil(widget.Expiration)
+
+	// The removed field no longer places the widget in the sparse index.
+	widgets, _, err := s.widgets.Query(s.ctx, "expired", Widget{ExpirationPartition: 1})
+	s.NoError(err)
+	s.NotContains(widgetIDs(widgets), key.ID)
+	s.NotEmpty(widgets)
+}
+
+func (s *Suite) TestUpdateLists() {
+	_, err := s.widgets.Create(s.ctx, testWidget)
+	s.NoError(err)
+	key := Widget{TenantID: testWidget.TenantID, ID: testWidget.ID}
+
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: key.TenantID, ID: key.ID, Refs: []string{"ref3"}}, depot.Append("refs"))
+	s.NoError(err)
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: key.TenantID, ID: key.ID, Refs: []string{"ref0"}}, depot.Prepend("refs"))
+	s.NoError(err)
+	widget, err := s.widgets.Get(s.ctx, key)
+	s.NoError(err)
+	s.Equal([]string{"ref0", "ref1", "ref2", "ref3"}, widget.Refs)
+
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: key.TenantID, ID: key.ID, Labels: []string{"a", "b"}}, depot.AddToSet("labels"))
+	s.NoError(err)
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: key.TenantID, ID: key.ID, Labels: []string{"b", "c"}}, depot.AddToSet("labels"))
+	s.NoError(err)
+	widget, err = s.widgets.Get(s.ctx, key)
+	s.NoError(err)
+	s.ElementsMatch([]string{"a", "b", "c"}, widget.Labels)
+
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: key.TenantID, ID: key.ID, Labels: []string{"a", "z"}}, depot.RemoveFromSet("labels"))
+	s.NoError(err)
+	widget, err = s.widgets.Get(s.ctx, key)
+	s.NoError(err)
+	s.ElementsMatch([]string{"b", "c"}, widget.Labels)
+	s.Equal([]string{"ref0", "ref1", "ref2", "ref3"}, widget.Refs)
+
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: key.TenantID, ID: key.ID, Name: "Widget"}, depot.Append("name"))
+	s.ErrorIs(err, depot.ErrInvalidTransform)
+}
+
+func (s *Suite) TestUpdateExtrema() {
+	_, err := s.widgets.Create(s.ctx, Widget{TenantID: testWidget.TenantID, ID: testWidget.ID, Name: "Widget", Count: 5, Total: 5})
+	s.NoError(err)
+	key := Widget{TenantID: testWidget.TenantID, ID: testWidget.ID}
+
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: key.TenantID, ID: key.ID, Name: "Lower", Count: 3, Total: 3}, depot.Max("count"), depot.Min("total"))
+	s.NoError(err)
+	widget, err := s.widgets.Get(s.ctx, key)
+	s.NoError(err)
+	s.Equal("Lower", widget.Name)
+	s.Equal(int64(5), widget.Count)
+	s.Equal(int64(3), widget.Total)
+
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: key.TenantID, ID: key.ID, Count: 8, Total: 8}, depot.Max("count"), depot.Min("total"))
+	s.NoError(err)
+	widget, err = s.widgets.Get(s.ctx, key)
+	s.NoError(err)
+	s.Equal(int64(8), widget.Count)
+	s.Equal(int64(3), widget.Total)
+
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: key.TenantID, ID: key.ID, Name: "Ignored", Description: "First"}, depot.SetIfAbsent("name"), depot.SetIfAbsent("desc"))
+	s.NoError(err)
+	widget, err = s.widgets.Get(s.ctx, key)
+	s.NoError(err)
+	s.Equal("Lower", widget.Name)
+	s.Equal("First", widget.Description)
+}
+
+func (s *Suite) TestNestedPaths() {
+	created := testWidget
+	created.Stats = WidgetStats{Views: 1}
+	_, err := s.widgets.Create(s.ctx, created)
+	s.NoError(err)
+	key := Widget{TenantID: testWidget.TenantID, ID: testWidget.ID}
+
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: key.TenantID, ID: key.ID, Stats: WidgetStats{Views: 2}}, depot.Add("stats.views"))
+	s.NoError(err)
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: key.TenantID, ID: key.ID, Data: map[string]interface{}{"c": "x"}}, depot.Force("data.c"))
+	s.NoError(err)
+	widget, err := s.widgets.Get(s.ctx, key)
+	s.NoError(err)
+	s.Equal(int64(3), widget.Stats.Views)
+	s.Equal(map[string]interface{}{"c": "x", "e": "f"}, widget.Data)
+
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: key.TenantID, ID: key.ID, Name: "Renamed", Data: map[string]interface{}{"c": "d"}}, depot.Equal("data.c"))
+	s.ErrorIs(err, depot.ErrConditionFailed)
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: key.TenantID, ID: key.ID, Name: "Renamed", Preferences: map[string]map[string]bool{"a": {"1": true}}},
+		depot.Equal("preferences.a.1"), depot.Remove("data.e"))
+	s.NoError(err)
+	widget, err = s.widgets.Get(s.ctx, key)
+	s.NoError(err)
+	s.Equal("Renamed", widget.Name)
+	s.Equal(map[string]interface{}{"c": "x"}, widget.Data)
+	s.Equal(testWidget.Preferences, widget.Preferences)
+
+	widgets, _, err := s.widgets.Query(s.ctx, "", Widget{TenantID: key.TenantID, Data: map[string]interface{}{"c": "x"}}, depot.Equal("data.c"))
+	s.NoError(err)
+	s.Equal([]string{key.ID}, widgetIDs(widgets))
+
+	_, err = s.widgets.Update(s.ctx, key, depot.Add("stats.unknown"))
+	s.ErrorIs(err, depot.ErrInvalidFieldPath)
+}
+
+func (s *Suite) TestUpdateUpsert() {
+	_, err := s.widgets.Update(s.ctx, Widget{
+		TenantID: upsertedWidgetKey.TenantID,
+		ID:       upsertedWidgetKey.ID,
+		Name:     "Upserted",
+		Count:    2,
+	}, depot.Add("count"))
+	s.NoError(err)
+
+	widget, err := s.widgets.Get(s.ctx, upsertedWidgetKey)
+	s.NoError(err)
+	s.Equal("Upserted", widget.Name)
+	s.Equal(int64(2), widget.Count)
+
+	widgets, _, err := s.widgets.Query(s.ctx, "", upsertedWidgetKey)
+	s.NoError(err)
+	s.Equal([]string{upsertedWidgetKey.ID}, widgetIDs(widgets))
+}
+
+func (s *Suite) TestUpdateConditions() {
+	_, err := s.widgets.Create(s.ctx, testWidget)
+	s.NoError(err)
+
+	for _, tc := range []struct {
+		name    string
+		version int64
+		op      depot.UpdateOp
+	}{
+		{"equal", 123, depot.Equal("version")},
+		{"not-equal", 100, depot.NotEqual("version")},
+		{"less-than", 200, depot.LessThan("version")},
+		{"less-than-or-equal", 123, depot.LessThanOrEqual("version")},
+		{"greater-than", 100, depot.GreaterThan("version")},
+		{"greater-than-or-equal", 123, depot.GreaterThanOrEqual("version")},
+		{"exists", 1, depot.Exists("version")},
+		{"in", 0, depot.In("version", int64(100), int64(123))},
+		{"not-in", 0, depot.NotIn("version", int64(100), int64(200))},
+	} {
+		_, err = s.widgets.Update(s.ctx, Widget{
+			TenantID: testWidget.TenantID,
+			ID:       testWidget.ID,
+			Name:     tc.name,
+			Version:  tc.version,
+		}, tc.op)
+		s.NoError(err, tc.name)
+
+		widget, err := s.widgets.Get(s.ctx, testWidgetKey)
+		s.NoError(err)
+		s.Equal(tc.name, widget.Name)
+		// Condition fields are checked, never written.
+		s.Equal(int64(123), widget.Version, tc.name)
+	}
+}
+
+func (s *Suite) TestUpdateConditionsFailed() {
+	_, err := s.widgets.Create(s.ctx, testWidget)
+	s.NoError(err)
+
+	for _, tc := range []struct {
+		name    string
+		version int64
+		op      depot.UpdateOp
+	}{
+		{"equal", 100, depot.Equal("version")},
+		{"not-equal", 123, depot.NotEqual("version")},
+		{"less-than", 123, depot.LessThan("version")},
+		{"less-than-or-equal", 100, depot.LessThanOrEqual("version")},
+		{"greater-than", 123, depot.GreaterThan("version")},
+		{"greater-than-or-equal", 200, depot.GreaterThanOrEqual("version")},
+		{"exists", 1, depot.Exists("total")},
+		{"in", 0, depot.In("version", int64(100), int64(200))},
+		{"not-in", 0, depot.NotIn("version", int64(100), int64(123))},
+	} {
+		_, err = s.widgets.Update(s.ctx, Widget{
+			TenantID: testWidget.TenantID,
+			ID:       testWidget.ID,
+			Name:     tc.name,
+			Version:  tc.version,
+		}, tc.op)
+		s.ErrorIs(err, depot.ErrConditionFailed, tc.name)
+		var ce *depot.ConditionError
+		if s.ErrorAs(err, &ce, tc.name) {
+			s.Equal([]string{tc.op.Field()}, ce.Fields, tc.name)
+		}
+	}
+
+	_, err = s.widgets.Update(s.ctx, Widget{
+		TenantID: testWidget.TenantID,
+		ID:       testWidget.ID,
+		Name:     "both",
+		Version:  123,
+		Status:   "Archived",
+	}, depot.Equal("version"), depot.Equal("status"))
+	var ce *depot.ConditionError
+	if s.ErrorAs(err, &ce) {
+		s.Equal([]string{"status"}, ce.Fields)
+	}
+
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: testWidget.TenantID, ID: testWidget.ID, Name: "zero"}, depot.Equal("status"))
+	if s.ErrorAs(err, &ce) {
+		s.Equal([]string{"status"}, ce.Fields)
+	}
+
+	widget, err := s.widgets.Get(s.ctx, testWidgetKey)
+	s.NoError(err)
+	s.Equal(testWidget.Name, widget.Name)
+}
+
+// TestUpdateOnlyConditions updates an entity with neither a version nor an
+// updated field using only conditions, which leaves nothing to write.
+func (s *Suite) TestUpdateOnlyConditions() {
+	s.putMessages()
+	message := testMessages[0]
+
+	_, err := s.messages.Update(s.ctx, Message{TenantID: message.TenantID, ID: message.ID, Body: "other"}, depot.Equal("body"))
+	s.ErrorIs(err, depot.ErrConditionFailed)
+	var ce *depot.ConditionError
+	if s.ErrorAs(err, &ce) {
+		s.Equal([]string{"body"}, ce.Fields)
+	}
+
+	_, err = s.messages.Update(s.ctx, message, depot.Equal("body"))
+	s.NoError(err)
+
+	err = s.db.RunInTransaction(s.ctx, func(tx depot.Tx) error {
+		return tx.Update(MessageTable, &Message{TenantID: message.TenantID, ID: message.ID, Body: "other"}, depot.Equal("body"))
+	})
+	s.ErrorIs(err, depot.ErrConditionFailed)
+}
+
+func (s *Suite) TestVersionPut() {
+	draft := testDraftKey
+	draft.Body = "first"
+	draft, err := s.drafts.Put(s.ctx, draft)
+	s.NoError(err)
+	s.Equal(int64(1), draft.Version)
+
+	stale := draft
+	stale.Version = 0
+	stale.Body = "stale"
+	_, err = s.drafts.Put(s.ctx, stale)
+	s.ErrorIs(err, depot.ErrVersionConflict)
+
+	draft.Body = "second"
+	draft, err = s.drafts.Put(s.ctx, draft)
+	s.NoError(err)
+	s.Equal(int64(2), draft.Version)
+
+	stored, err := s.drafts.Get(s.ctx, testDraftKey)
+	s.NoError(err)
+	s.Equal(draft, stored)
+}
+
+func (s *Suite) TestVersionCreate() {
+	draft, err := s.drafts.Create(s.ctx, Draft{TenantID: testDraftKey.TenantID, ID: testDraftKey.ID, Body: "created"})
+	s.NoError(err)
+	s.Equal(int64(1), draft.Version)
+
+	stored, err := s.drafts.Get(s.ctx, testDraftKey)
+	s.NoError(err)
+	s.Equal(draft, stored)
+}
+
+func (s *Suite) TestVersionUpdate() {
+	draft, err := s.drafts.Update(s.ctx, Draft{TenantID: testDraftKey.TenantID, ID: testDraftKey.ID, Body: "upserted"})
+	s.NoError(err)
+	s.Equal(int64(1), draft.Version)
+
+	_, err = s.drafts.Update(s.ctx, Draft{TenantID: testDraftKey.TenantID, ID: testDraftKey.ID, Body: "stale"})
+	s.ErrorIs(err, depot.ErrVersionConflict)
+
+	draft, err = s.drafts.Update(s.ctx, Draft{TenantID: testDraftKey.TenantID, ID: testDraftKey.ID, Body: "updated", Version: 1})
+	s.NoError(err)
+	s.Equal(int64(2), draft.Version)
+
+	stored, err := s.drafts.Get(s.ctx, testDraftKey)
+	s.NoError(err)
+	s.Equal("updated", stored.Body)
+	s.Equal(int64(2), stored.Version)
+}
+
+func (s *Suite) TestVersionDelete() {
+	draft, err := s.drafts.Put(s.ctx, Draft{TenantID: testDraftKey.TenantID, ID: testDraftKey.ID, Body: "draft"})
+	s.NoError(err)
+
+	_, err = s.drafts.Delete(s.ctx, testDraftKey)
+	s.ErrorIs(err, depot.ErrVersionConflict)
+	_, err = s.drafts.Get(s.ctx, testDraftKey)
+	s.NoError(err)
+
+	_, err = s.drafts.Delete(s.ctx, draft)
+	s.NoError(err)
+	_, err = s.drafts.Get(s.ctx, testDraftKey)
+	s.ErrorIs(err, depot.ErrEntityNotFound)
+}
+
+func (s *Suite) TestVersionTransaction() {
+	_, err := s.drafts.Put(s.ctx, Draft{TenantID: testDraftKey.TenantID, ID: testDraftKey.ID, Body: "draft"})
+	s.NoError(err)
+
+	draft := testDraftKey
+	err = s.db.RunInTransaction(s.ctx, func(tx depot.Tx) (err error) {
+		draft = testDraftKey
+		if err = tx.Get(MessageTable, &draft); err != nil {
+			return
+		}
+		draft.Body = "edited"
+		return tx.Put(MessageTable, &draft)
+	})
+	s.NoError(err)
+	s.Equal(int64(2), draft.Version)
+
+	err = s.db.RunInTransaction(s.ctx, func(tx depot.Tx) error {
+		return tx.Put(MessageTable, &Draft{TenantID: testDraftKey.TenantID, ID: testDraftKey.ID, Body: "stale", Version: 1})
+	})
+	s.ErrorIs(err, depot.ErrVersionConflict)
+
+	stored, err := s.drafts.Get(s.ctx, testDraftKey)
+	s.NoError(err)
+	s.Equal(draft, stored)
+}
+
+func (s *Suite) TestTimestampsCreate() {
+	before := time.Now()
+	note, err := s.notes.Create(s.ctx, Note{TenantID: testNoteKey.TenantID, ID: testNoteKey.ID, Body: "created"})
+	s.NoError(err)
+	s.WithinDuration(before, note.CreatedAt, time.Minute)
+	s.True(note.UpdatedAt.Equal(note.CreatedAt))
+
+	stored, err := s.notes.Get(s.ctx, testNoteKey)
+	s.NoError(err)
+	s.True(stored.CreatedAt.Equal(note.CreatedAt))
+	s.True(stored.UpdatedAt.Equal(note.UpdatedAt))
+}
+
+func (s *Suite) TestTimestampsPut() {
+	first, err := s.notes.Put(s.ctx, Note{TenantID: testNoteKey.TenantID, ID: testNoteKey.ID, Body: "first"})
+	s.NoError(err)
+	s.False(first.CreatedAt.IsZero())
+	s.True(first.UpdatedAt.Equal(first.CreatedAt))
+
+	// A put that does not carry the created time keeps the stored one.
+	second, err := s.notes.Put(s.ctx, Note{TenantID: testNoteKey.TenantID, ID: testNoteKey.ID, Body: "second"})
+	s.NoError(err)
+	s.True(second.CreatedAt.Equal(first.CreatedAt))
+	s.False(second.UpdatedAt.Before(first.UpdatedAt))
+
+	stored, err := s.notes.Get(s.ctx, testNoteKey)
+	s.NoError(err)
+	s.Equal("second", stored.Body)
+	s.True(stored.CreatedAt.Equal(first.CreatedAt))
+	s.True(stored.UpdatedAt.Equal(second.UpdatedAt))
+}
+
+func (s *Suite) TestTimestampsUpdate() {
+	created, err := s.notes.Create(s.ctx, Note{TenantID: testNoteKey.TenantID, ID: testNoteKey.ID, Body: "created"})
+	s.NoError(err)
+
+	updated, err := s.notes.Update(s.ctx, Note{TenantID: testNoteKey.TenantID, ID: testNoteKey.ID, Body: "updated"})
+	s.NoError(err)
+	s.False(updated.UpdatedAt.Before(created.UpdatedAt))
+
+	stored, err := s.notes.Get(s.ctx, testNoteKey)
+	s.NoError(err)
+	s.Equal("updated", stored.Body)
+	s.True(stored.CreatedAt.Equal(created.CreatedAt))
+	s.True(stored.UpdatedAt.Equal(updated.UpdatedAt))
+}
+
+func (s *Suite) TestTimestampsTransaction() {
+	created, err := s.notes.Create(s.ctx, Note{TenantID: testNoteKey.TenantID, ID: testNoteKey.ID, Body: "created"})
+	s.NoError(err)
+
+	note := Note{TenantID: testNoteKey.TenantID, ID: testNoteKey.ID, Body: "edited"}
+	err = s.db.RunInTransaction(s.ctx, func(tx depot.Tx) error {
+		return tx.Put(MessageTable, &note)
+	})
+	s.NoError(err)
+	s.True(note.CreatedAt.Equal(created.CreatedAt))
+
+	stored, err := s.notes.Get(s.ctx, testNoteKey)
+	s.NoError(err)
+	s.Equal("edited", stored.Body)
+	s.True(stored.CreatedAt.Equal(created.CreatedAt))
+	s.False(stored.UpdatedAt.Before(created.UpdatedAt))
+}
+
+func (s *Suite) TestQueryConditions() {
+	s.putWidgets()
+
+	for _, tc := range []struct {
+		name     string
+		filter   Widget
+		op       []depot.QueryOp
+		expected []string
+	}{
+		{"default", Widget{TenantID: "tenant", Count: 3}, nil, []string{"widget3"}},
+		{"equal", Widget{TenantID: "tenant", Count: 3}, []depot.QueryOp{depot.Equal("count")}, []string{"widget3"}},
+		{"not-equal", Widget{TenantID: "tenant", Count: 3}, []depot.QueryOp{depot.NotEqual("count")}, []string{"widget1", "widget2", "widget4", "widget5", "widget6"}},
+		{"less-than", Widget{TenantID: "tenant", Count: 3}, []depot.QueryOp{depot.LessThan("count")}, []string{"widget1", "widget2"}},
+		{"less-than-or-equal", Widget{TenantID: "tenant", Count: 3}, []depot.QueryOp{depot.LessThanOrEqual("count")}, []string{"widget1", "widget2", "widget3"}},
+		{"greater-than", Widget{TenantID: "tenant", Count: 4}, []depot.QueryOp{depot.GreaterThan("count")}, []string{"widget5", "widget6"}},
+		{"greater-than-or-equal", Widget{TenantID: "tenant", Count: 4}, []depot.QueryOp{depot.GreaterThanOrEqual("count")}, []string{"widget4", "widget5", "widget6"}},
+		{"exists", Widget{TenantID: "tenant"}, []depot.QueryOp{depot.Exists("expiration")}, []string{"widget1", "widget2", "widget3", "widget4"}},
+		{"in", Widget{TenantID: "tenant"}, []depot.QueryOp{depot.In("count", int64(1), int64(3), int64(5))}, []string{"widget1", "widget3", "widget5"}},
+		{"not-in", Widget{TenantID: "tenant"}, []depot.QueryOp{depot.NotIn("count", int64(1), int64(3), int64(5))}, []string{"widget2", "widget4", "widget6"}},
+		{"in-key", Widget{TenantID: "tenant"}, []depot.QueryOp{depot.In("id", "widget2", "widget4")}, []string{"widget2", "widget4"}},
+		{"no-match", Widget{TenantID: "tenant", Count: 10}, []depot.QueryOp{depot.GreaterThan("count")}, nil},
+	} {
+		widgets, page, err := s.widgets.Query(s.ctx, "", tc.filter, tc.op...)
+		s.NoError(err, tc.name)
+		s.Empty(page, tc.name)
+		s.ElementsMatch(tc.expected, widgetIDs(widgets), tc.name)
+	}
+
+	// An In on the sort key keeps the order and pages of the query.
+	widgets, page, err := s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant"}, depot.In("id", "widget2", "widget5", "widget4"), depot.Desc(), depot.Limit(2))
+	s.NoError(err)
+	s.Equal([]string{"widget5", "widget4"}, widgetIDs(widgets))
+	s.NotEmpty(page)
+	widgets, page, err = s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant"}, depot.In("id", "widget2", "widget5", "widget4"), depot.Desc(), depot.Limit(2), depot.Page(page))
+	s.NoError(err)
+	s.Equal([]string{"widget2"}, widgetIDs(widgets))
+	s.Empty(page)
+
+	_, _, err = s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant"}, depot.In("count"))
+	s.ErrorIs(err, depot.ErrInvalidCondition)
+	_, _, err = s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant"}, depot.Where("count", "not-in", []int64{}))
+	s.ErrorIs(err, depot.ErrInvalidCondition)
+}
+
+func (s *Suite) TestQueryCompositeConditions() {
+	s.putWidgets()
+
+	for _, tc := range []struct {
+		name     string
+		filter   Widget
+		op       []depot.QueryOp
+		expected []string
+	}{
+		{"or", Widget{TenantID: "tenant", Count: 2}, []depot.QueryOp{depot.Or(depot.LessThan("count"), depot.In("count", int64(5), int64(6)))}, []string{"widget1", "widget5", "widget6"}},
+		{"and", Widget{TenantID: "tenant", Count: 2}, []depot.QueryOp{depot.And(depot.GreaterThan("count"), depot.NotIn("count", int64(4)))}, []string{"widget3", "widget5", "widget6"}},
+		{"not", Widget{TenantID: "tenant"}, []depot.QueryOp{depot.Not(depot.In("count", int64(1), int64(2), int64(3)))}, []string{"widget4", "widget5", "widget6"}},
+		{"nested", Widget{TenantID: "tenant", Count: 4}, []depot.QueryOp{depot.Or(depot.Equal("count"), depot.Not(depot.GreaterThanOrEqual("count")))}, []string{"widget1", "widget2", "widget3", "widget4"}},
+	} {
+		widgets, page, err := s.widgets.Query(s.ctx, "", tc.filter, tc.op...)
+		s.NoError(err, tc.name)
+		s.Empty(page, tc.name)
+		s.ElementsMatch(tc.expected, widgetIDs(widgets), tc.name)
+	}
+
+	update := Widget{TenantID: "tenant", ID: "widget5", Name: "Renamed", Count: 1}
+	_, err := s.widgets.Update(s.ctx, update, depot.Or(depot.Equal("count"), depot.Exists("expiration")))
+	s.ErrorIs(err, depot.ErrConditionFailed)
+	_, err = s.widgets.Update(s.ctx, update, depot.Or(depot.Equal("count"), depot.Not(depot.Exists("expiration"))))
+	s.NoError(err)
+	widget, err := s.widgets.Get(s.ctx, update)
+	s.NoError(err)
+	s.Equal("Renamed", widget.Name)
+	s.Equal(int64(5), widget.Count)
+}
+
+func (s *Suite) TestQueryValueConditions() {
+	s.putWidgets()
+
+	for _, tc := range []struct {
+		name     string
+		op       []depot.QueryOp
+		expected []string
+	}{
+		{"range", []depot.QueryOp{depot.Where("count", ">", 0), depot.Where("count", "<", 4)}, []string{"widget1", "widget2", "widget3"}},
+		{"between", []depot.QueryOp{depot.Between("count", int64(2), int64(4))}, []string{"widget2", "widget3", "widget4"}},
+		{"in", []depot.QueryOp{depot.Where("count", "in", []int64{1, 6})}, []string{"widget1", "widget6"}},
+		{"zero", []depot.QueryOp{depot.Where("status", "=", "")}, []string{"widget1", "widget2", "widget3", "widget4", "widget5", "widget6"}},
+	} {
+		widgets, page, err := s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant"}, tc.op...)
+		s.NoError(err, tc.name)
+		s.Empty(page, tc.name)
+		s.ElementsMatch(tc.expected, widgetIDs(widgets), tc.name)
+	}
+
+	s.putMessages()
+	messages, _, err := s.messages.Query(s.ctx, "", Message{TenantID: "tenant"}, depot.Between("id", 2, 4), depot.Asc())
+	s.NoError(err)
+	s.Equal([]int64{2, 3, 4}, messageIDs(messages))
+
+	update := Widget{TenantID: "tenant", ID: "widget5", Count: 10}
+	_, err = s.widgets.Update(s.ctx, update, depot.Where("count", "<", 5))
+	s.ErrorIs(err, depot.ErrConditionFailed)
+	_, err = s.widgets.Update(s.ctx, update, depot.Where("count", "<=", 5))
+	s.NoError(err)
+	widget, err := s.widgets.Get(s.ctx, update)
+	s.NoError(err)
+	s.Equal(int64(10), widget.Count)
+}
+
+func (s *Suite) TestQueryStringConditions() {
+	s.putWidgets()
+	_, err := s.widgets.Put(s.ctx, testWidget)
+	s.NoError(err)
+
+	for _, tc := range []struct {
+		name     string
+		filter   Widget
+		op       []depot.QueryOp
+		expected []string
+	}{
+		{"sort-key-prefix", Widget{TenantID: "tenant", ID: "widget"}, []depot.QueryOp{depot.BeginsWith("id")}, []string{"widget", "widget1", "widget2", "widget3", "widget4", "widget5", "widget6"}},
+		{"prefix", Widget{TenantID: "tenant", Name: "Widget "}, []depot.QueryOp{depot.BeginsWith("name")}, []string{"widget1", "widget2", "widget4", "widget5", "widget6"}},
+		{"where-prefix", Widget{TenantID: "tenant"}, []depot.QueryOp{depot.Where("id", "begins-with", "widget1")}, []string{"widget1"}},
+		{"contains", Widget{TenantID: "tenant", Refs: []string{"ref2"}}, []depot.QueryOp{depot.Contains("refs")}, []string{"widget"}},
+		{"where-contains", Widget{TenantID: "tenant"}, []depot.QueryOp{depot.Where("refs", "contains", "ref1")}, []string{"widget"}},
+		{"contains-missing", Widget{TenantID: "tenant", Refs: []string{"ref3"}}, []depot.QueryOp{depot.Contains("refs")}, nil},
+	} {
+		widgets, page, err := s.widgets.Query(s.ctx, "", tc.filter, tc.op...)
+		s.NoError(err, tc.name)
+		s.Empty(page, tc.name)
+		s.ElementsMatch(tc.expected, widgetIDs(widgets), tc.name)
+	}
+}
+
+func (s *Suite) TestSelect() {
+	_, err := s.widgets.Put(s.ctx, testWidget)
+	s.NoError(err)
+
+	widget, err := s.widgets.Get(s.ctx, Widget{TenantID: testWidget.TenantID, ID: testWidget.ID, Description: "stale"}, depot.Select("name", "data.c"))
+	s.NoError(err)
+	s.Equal(Widget{TenantID: testWidget.TenantID, ID: testWidget.ID, Name: testWidget.Name, Data: map[string]interface{}{"c": "d"}}, widget)
+
+	s.putWidgets()
+	widgets, _, err := s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant", Count: 4}, depot.GreaterThanOrEqual("count"), depot.Select("name"))
+	s.NoError(err)
+	s.ElementsMatch([]string{"widget4", "widget5", "widget6"}, widgetIDs(widgets))
+	for _, w := range widgets {
+		s.NotEmpty(w.Name)
+		s.Zero(w.Count)
+		s.Empty(w.Description)
+	}
+
+	// Fields that are not indexed are selected all the same.
+	widgets, _, err = s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant"}, depot.Select("desc"))
+	s.NoError(err)
+	s.Len(widgets, len(testWidgets)+1)
+	for _, w := range widgets {
+		s.NotEmpty(w.Description)
+		s.Empty(w.Name)
+	}
+
+	_, err = s.widgets.Get(s.ctx, testWidgetKey, depot.Select("missing"))
+	s.ErrorIs(err, depot.ErrInvalidFieldPath)
+}
+
+func (s *Suite) TestExists() {
+	ok, err := s.widgets.Exists(s.ctx, testWidgetKey)
+	s.NoError(err)
+	s.False(ok)
+
+	_, err = s.widgets.Put(s.ctx, testWidget)
+	s.NoError(err)
+
+	ok, err = s.widgets.Exists(s.ctx, testWidgetKey)
+	s.NoError(err)
+	s.True(ok)
+}
+
+func (s *Suite) TestKeys() {
+	s.putMessages()
+
+	keys, page, err := s.messages.Keys(s.ctx, "", Message{TenantID: "tenant", ID: 4}, depot.GreaterThan("id"), depot.Asc(), depot.Limit(2))
+	s.NoError(err)
+	s.NotEmpty(page)
+	s.Equal([]depot.Key{
+		{Partition: depot.KeyPart{Name: "tenantId", Value: "tenant"}, Sort: depot.KeyPart{Name: "id", Value: int64(5)}},
+		{Partition: depot.KeyPart{Name: "tenantId", Value: "tenant"}, Sort: depot.KeyPart{Name: "id", Value: int64(6)}},
+	}, keys)
+
+	keys, page, err = s.messages.Keys(s.ctx, "", Message{TenantID: "tenant", ID: 4}, depot.GreaterThan("id"), depot.Asc(), depot.Limit(2), depot.Page(page))
+	s.NoError(err)
+	s.Empty(page)
+	s.Equal([]depot.Key{
+		{Partition: depot.KeyPart{Name: "tenantId", Value: "tenant"}, Sort: depot.KeyPart{Name: "id", Value: int64(7)}},
+	}, keys)
+
+	s.putWidgets()
+	keys, _, err = s.widgets.Keys(s.ctx, "", Widget{TenantID: "tenant", Count: 5}, depot.GreaterThanOrEqual("count"))
+	s.NoError(err)
+	s.ElementsMatch([]depot.Key{
+		{Partition: depot.KeyPart{Name: "tenantId", Value: "tenant"}, Sort: depot.KeyPart{Name: "id", Value: "widget5"}},
+		{Partition: depot.KeyPart{Name: "tenantId", Value: "tenant"}, Sort: depot.KeyPart{Name: "id", Value: "widget6"}},
+	}, keys)
+}
+
+func (s *Suite) TestConsistent() {
+	_, err := s.widgets.Create(s.ctx, testWidget)
+	s.NoError(err)
+
+	widget, err := s.widgets.Get(s.ctx, testWidgetKey, depot.Consistent())
+	s.NoError(err)
+	s.Equal(testWidget.Name, widget.Name)
+
+	widgets, _, err := s.widgets.Query(s.ctx, "", Widget{TenantID: testWidget.TenantID}, depot.Consistent())
+	s.NoError(err)
+	s.Equal([]string{testWidget.ID}, widgetIDs(widgets))
+
+	// DynamoDB alone cannot read an index consistently.
+	widgets, _, err = s.widgets.Query(s.ctx, "named", Widget{TenantID: testWidget.TenantID}, depot.Consistent())
+	if !errors.Is(err, depot.ErrConsistentIndex) {
+		s.NoError(err)
+		s.Equal([]string{testWidget.ID}, widgetIDs(widgets))
+	}
+}
+
+func (s *Suite) TestAsOf() {
+	err := s.db.RunInTransaction(s.ctx, func(tx depot.Tx) error {
+		return tx.Get(WidgetTable, &Widget{TenantID: testWidget.TenantID, ID: testWidget.ID}, depot.AsOf(time.Now()))
+	})
+	s.ErrorIs(err, depot.ErrUnsupported)
+
+	_, err = s.widgets.Get(s.ctx, testWidgetKey, depot.AsOf(time.Now().Add(-time.Second)))
+	if errors.Is(err, depot.ErrUnsupported) {
+		// Backends that keep no past versions cannot read as of any time.
+		_, _, err = s.widgets.Query(s.ctx, "", Widget{TenantID: testWidget.TenantID}, depot.AsOf(time.Now()))
+		s.ErrorIs(err, depot.ErrUnsupported)
+		_, err = s.widgets.Count(s.ctx, "", Widget{TenantID: testWidget.TenantID}, depot.AsOf(time.Now()))
+		s.ErrorIs(err, depot.ErrUnsupported)
+		return
+	}
+	s.ErrorIs(err, depot.ErrEntityNotFound)
+
+	_, err = s.widgets.Put(s.ctx, testWidget)
+	s.NoError(err)
+	// Some backends read as of whole seconds.
+	time.Sleep(1100 * time.Millisecond)
+	snapshot := time.Now()
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: testWidget.TenantID, ID: testWidget.ID, Name: "Renamed"})
+	s.NoError(err)
+
+	widget, err := s.widgets.Get(s.ctx, testWidgetKey, depot.AsOf(snapshot))
+	s.NoError(err)
+	s.Equal(testWidget.Name, widget.Name)
+
+	_, err = s.widgets.Put(s.ctx, Widget{TenantID: testWidget.TenantID, ID: "widget2", Name: "Later"})
+	s.NoError(err)
+
+	widgets, _, err := s.widgets.Query(s.ctx, "", Widget{TenantID: testWidget.TenantID}, depot.AsOf(snapshot))
+	s.NoError(err)
+	s.Equal([]string{testWidget.ID}, widgetIDs(widgets))
+	s.Equal(testWidget.Name, widgets[0].Name)
+
+	count, err := s.widgets.Count(s.ctx, "", Widget{TenantID: testWidget.TenantID}, depot.AsOf(snapshot))
+	s.NoError(err)
+	s.Equal(int64(1), count)
+}
+
+func (s *Suite) TestAggregate() {
+	s.putWidgets()
+
+	count, err := s.widgets.Count(s.ctx, "", Widget{TenantID: "tenant"})
+	s.NoError(err)
+	s.Equal(int64(6), count)
+
+	count, err = s.widgets.Count(s.ctx, "", Widget{TenantID: "tenant", Count: 4}, depot.GreaterThanOrEqual("count"))
+	s.NoError(err)
+	s.Equal(int64(3), count)
+
+	sum, err := s.widgets.Sum(s.ctx, "", Widget{TenantID: "tenant"}, "count")
+	s.NoError(err)
+	s.Equal(float64(21), sum)
+
+	avg, err := s.widgets.Avg(s.ctx, "", Widget{TenantID: "tenant", Count: 4}, "count", depot.GreaterThanOrEqual("count"))
+	s.NoError(err)
+	s.Equal(float64(5), avg)
+
+	count, err = s.widgets.Count(s.ctx, "", Widget{TenantID: "missing"})
+	s.NoError(err)
+	s.Zero(count)
+
+	avg, err = s.widgets.Avg(s.ctx, "", Widget{TenantID: "missing"}, "count")
+	s.NoError(err)
+	s.Zero(avg)
+
+	_, err = s.widgets.Sum(s.ctx, "", Widget{TenantID: "tenant"}, "missing")
+	s.ErrorIs(err, depot.ErrInvalidFieldPath)
+}
+
+func (s *Suite) TestQueryKeyConditions() {
+	s.putMessages()
+
+	messages, page, err := s.messages.Query(s.ctx, "", Message{TenantID: "tenant", ID: 5})
+	s.NoError(err)
+	s.Empty(page)
+	s.Equal([]Message{testMessages[4]}, messages)
+
+	messages, _, err = s.messages.Query(s.ctx, "", Message{TenantID: "tenant", ID: 3}, depot.GreaterThan("id"), depot.Asc())
+	s.NoError(err)
+	s.Equal([]int64{4, 5, 6, 7}, messageIDs(messages))
+
+	messages, _, err = s.messages.Query(s.ctx, "", Message{TenantID: "tenant", ID: 3}, depot.LessThanOrEqual("id"), depot.Desc())
+	s.NoError(err)
+	s.Equal([]int64{3, 2, 1}, messageIDs(messages))
+
+	messages, _, err = s.messages.Query(s.ctx, "", Message{TenantID: "missing"})
+	s.NoError(err)
+	s.Empty(messages)
+}
+
+func (s *Suite) TestQueryCreatedIndex() {
+	s.putWidgets()
+
+	widgets, page, err := s.widgets.Query(s.ctx,
+		"created",
+		Widget{TenantID: "tenant", CreatedAt: time.Now().UTC().Add(-30 * time.Minute)},
+		depot.GreaterThan("createdAt"),
+		depot.Desc())
+	s.NoError(err)
+	s.Empty(page)
+	s.Equal(4, len(widgets))
+	s.equals(testWidgets[5], widgets[0])
+	s.equals(testWidgets[4], widgets[1])
+	s.equals(testWidgets[3], widgets[2])
+	s.equals(testWidgets[2], widgets[3])
+}
+
+func (s *Suite) TestQueryNamedIndex() {
+	s.putWidgets()
+
+	widgets, page, err := s.widgets.Query(s.ctx,
+		"named",
+		Widget{TenantID: "tenant", Name: "Widget"},
+		depot.GreaterThan("name"),
+		depot.Exists("expiration"),
+		depot.Limit(2))
+
+	s.NoError(err)
+	s.NotEmpty(page)
+	s.Equal(2, len(widgets))
+	s.equals(testWidgets[0], widgets[0])
+	s.equals(testWidgets[1], widgets[1])
+
+	widgets, page, err = s.widgets.Query(s.ctx,
+		"named",
+		Widget{TenantID: "tenant", Name: "Widget"},
+		depot.GreaterThan("name"),
+		depot.Exists("expiration"),
+		depot.Limit(2),
+		depot.Page(page))
+
+	s.NoError(err)
+	s.Equal(1, len(widgets))
+	s.equals(testWidgets[3], widgets[0])
+
+	if page != "" {
+		widgets, page, err = s.widgets.Query(s.ctx,
+			"named",
+			Widget{TenantID: "tenant", Name: "Widget"},
+			depot.GreaterThan("name"),
+			depot.Exists("expiration"),
+			depot.Limit(2),
+			depot.Page(page))
+
+		s.NoError(err)
+		s.Empty(page)
+		s.Equal(0, len(widgets))
+	}
+}
+
+func (s *Suite) TestQueryMessage() {
+	s.putMessages()
+
+	messages, page, err := s.messages.Query(s.ctx, "",
+		Message{TenantID: "tenant"},
+		depot.Limit(3),
+		depot.Desc())
+	s.NoError(err)
+	s.NotEmpty(page)
+	s.Equal(3, len(messages))
+	s.Equal(testMessages[6], messages[0])
+	s.Equal(testMessages[5], messages[1])
+	s.Equal(testMessages[4], messages[2])
+
+	messages, page, err = s.messages.Query(s.ctx, "",
+		Message{TenantID: "tenant"},
+		depot.Limit(3),
+		depot.Page(page),
+		depot.Desc())
+	s.NoError(err)
+	s.NotEmpty(page)
+	s.Equal(3, len(messages))
+	s.Equal(testMessages[3], messages[0])
+	s.Equal(testMessages[2], messages[1])
+	s.Equal(testMessages[1], messages[2])
+
+	messages, page, err = s.messages.Query(s.ctx, "",
+		Message{TenantID: "tenant"},
+		depot.Limit(3),
+		depot.Page(page),
+		depot.Desc())
+	s.NoError(err)
+	s.Empty(page)
+	s.Equal(1, len(messages))
+	s.Equal(testMessages[0], messages[0])
+}
+
+func (s *Suite) TestQueryPagination() {
+	s.putMessages()
+
+	// A limit larger than the result set returns everything in one page.
+	messages, page, err := s.messages.Query(s.ctx, "", Message{TenantID: "tenant"}, depot.Limit(10))
+	s.NoError(err)
+	s.Empty(page)
+	s.Equal(testMessages, messages)
+
+	// Following every page yields each entity exactly once, in order.
+	messages, pages := s.allMessages(Message{TenantID: "tenant"}, depot.Limit(2), depot.Asc())
+	s.Equal(testMessages, messages)
+	s.Equal(4, pages)
+
+	messages, _ = s.allMessages(Message{TenantID: "tenant"}, depot.Limit(3), depot.Desc())
+	s.Equal([]int64{7, 6, 5, 4, 3, 2, 1}, messageIDs(messages))
+
+	// A limit that divides the result set exactly may or may not report a
+	// trailing empty page, but never repeats or loses an entity.
+	messages, pages = s.allMessages(Message{TenantID: "tenant"}, depot.Limit(7))
+	s.Equal(testMessages, messages)
+	s.LessOrEqual(pages, 2)
+
+	messages, pages = s.allMessages(Message{TenantID: "missing"}, depot.Limit(2))
+	s.Empty(messages)
+	s.Equal(1, pages)
+}
+
+func (s *Suite) TestIterate() {
+	s.putMessages()
+
+	var ids []int64
+	it := s.messages.Iterate(s.ctx, "", Message{TenantID: "tenant"}, depot.Limit(2), depot.Asc())
+	for it.Next() {
+		ids = append(ids, it.Value().ID)
+	}
+	s.NoError(it.Err())
+	s.Equal([]int64{1, 2, 3, 4, 5, 6, 7}, ids)
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	it = s.messages.Iterate(ctx, "", Message{TenantID: "tenant"}, depot.Limit(2), depot.Asc())
+	s.True(it.Next())
+	cancel()
+	s.False(it.Next())
+	s.ErrorIs(it.Err(), context.Canceled)
+}
+
+func (s *Suite) TestQueryPaginationStable() {
+	s.putMessages()
+	inserted := Message{TenantID: "tenant", ID: 8, Body: "Message 8"}
+	defer func() {
+		_, err := s.messages.Delete(s.ctx, inserted)
+		s.NoError(err)
+	}()
+
+	messages, page, err := s.messages.Query(s.ctx, "", Message{TenantID: "tenant"}, depot.Limit(3), depot.Desc())
+	s.NoError(err)
+	s.Equal([]int64{7, 6, 5}, messageIDs(messages))
+
+	// An entity added ahead of the page token does not shift the next page.
+	_, err = s.messages.Put(s.ctx, inserted)
+	s.NoError(err)
+	messages, _, err = s.messages.Query(s.ctx, "", Message{TenantID: "tenant"}, depot.Limit(3), depot.Desc(), depot.Page(page))
+	s.NoError(err)
+	s.Equal([]int64{4, 3, 2}, messageIDs(messages))
+}
+
+func (s *Suite) TestQueryPathPagination() {
+	for i, w := range testWidgets[:4] {
+		w.Data = map[string]interface{}{"c": string(rune('a' + i))}
+		_, err := s.widgets.Put(s.ctx, w)
+		s.Require().NoError(err)
+	}
+
+	// Page tokens of a query ordered by an inequality on a nested field carry
+	// the value at its path.
+	var ids []string
+	it := s.widgets.Iterate(s.ctx, "", Widget{TenantID: "tenant", Data: map[string]interface{}{"c": "a"}},
+		depot.GreaterThan("data.c"), depot.Limit(1))
+	for it.Next() {
+		ids = append(ids, it.Value().ID)
+	}
+	s.NoError(it.Err())
+	s.ElementsMatch([]string{"widget2", "widget3", "widget4"}, ids)
+}
+
+func (s *Suite) TestQueryInvalidPage() {
+	s.putMessages()
+	_, _, err := s.messages.Query(s.ctx, "", Message{TenantID: "tenant"}, depot.Limit(2), depot.Page("!!!"))
+	s.ErrorIs(err, depot.ErrInvalidPage)
+}
+
+func (s *Suite) TestErrors() {
+	var tags []Tag
+
+	s.ErrorIs(s.db.Get(s.ctx, WidgetTable, "widget"), depot.ErrInvalidEntityType)
+	s.ErrorIs(s.db.Delete(s.ctx, WidgetTable, "widget"), depot.ErrInvalidEntityType)
+	s.ErrorIs(s.db.Update(s.ctx, WidgetTable, "widget"), depot.ErrInvalidEntityType)
+
+	_, err := s.db.Query(s.ctx, TagTable, "", &Tag{ID: "tag"}, &tags, depot.Asc())
+	s.ErrorIs(err, depot.ErrNoSortField)
+	_, err = s.db.Query(s.ctx, TagTable, "", &Tag{ID: "tag"}, &tags, depot.Desc())
+	s.ErrorIs(err, depot.ErrNoSortField)
+}
@@ -0,0 +1,116 @@
+// Package depottest provides the behavioral specification every
+// depot.Database implementation is expected to satisfy.
+//
+// Backends and wrappers verify themselves with a single call:
+//
+//	func TestConformance(t *testing.T) {
+//		depottest.RunConformance(t, func() depot.Database { return mydb.New() })
+//	}
+//
+// The suite reads and writes the depot-widget, depot-message and depot-tag
+// tables and removes its own fixtures before every test, so the factory may
+// return either a fresh database or a shared client.
+package depottest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andyday/depot"
+	"github.com/stretchr/testify/suite"
+)
+
+// RunConformance runs the conformance suite against the databases returned by
+// factory, which is called once per test.
+func RunConformance(t *testing.T, factory func() depot.Database) {
+	suite.Run(t, &Suite{factory: factory})
+}
+
+type Suite struct {
+	suite.Suite
+	factory  func() depot.Database
+	db       depot.Database
+	widgets  depot.Table[Widget]
+	messages depot.Table[Message]
+	drafts   depot.Table[Draft]
+	notes    depot.Table[Note]
+	ctx      context.Context
+}
+
+func (s *Suite) SetupTest() {
+	s.ctx = context.Background()
+	s.db = s.factory()
+	s.widgets = depot.NewTable[Widget](s.db, WidgetTable)
+	s.messages = depot.NewTable[Message](s.db, MessageTable)
+	s.drafts = depot.NewTable[Draft](s.db, MessageTable)
+	s.notes = depot.NewTable[Note](s.db, MessageTable)
+
+	for _, w := range append([]Widget{testWidgetKey, upsertedWidgetKey}, testWidgets...) {
+		_, err := s.widgets.Delete(s.ctx, Widget{TenantID: w.TenantID, ID: w.ID})
+		s.Require().NoError(err)
+	}
+	for _, m := range append([]Message{{TenantID: testDraftKey.TenantID, ID: testDraftKey.ID}, {TenantID: testNoteKey.TenantID, ID: testNoteKey.ID}}, testMessages...) {
+		_, err := s.messages.Delete(s.ctx, Message{TenantID: m.TenantID, ID: m.ID})
+		s.Require().NoError(err)
+	}
+	_, err := s.widgets.Get(s.ctx, testWidgetKey)
+	s.Require().ErrorIs(err, depot.ErrEntityNotFound)
+}
+
+func (s *Suite) putWidgets() {
+	for _, w := range testWidgets {
+		_, err := s.widgets.Put(s.ctx, w)
+		s.Require().NoError(err)
+	}
+}
+
+func (s *Suite) putMessages() {
+	for _, m := range testMessages {
+		_, err := s.messages.Put(s.ctx, m)
+		s.Require().NoError(err)
+	}
+}
+
+// allMessages follows page tokens until the backend reports no further pages.
+func (s *Suite) allMessages(filter Message, op ...depot.QueryOp) (messages []Message, pages int) {
+	var page string
+	for {
+		ms, next, err := s.messages.Query(s.ctx, "", filter, append(op, depot.Page(page))...)
+		s.Require().NoError(err)
+		messages = append(messages, ms...)
+		pages++
+		if next == "" {
+			return
+		}
+		s.Require().Less(pages, 100, "pagination did not terminate")
+		page = next
+	}
+}
+
+func (s *Suite) equals(a, b Widget) {
+	s.WithinDuration(a.CreatedAt, b.CreatedAt, time.Millisecond)
+	s.WithinDuration(a.UpdatedAt, b.UpdatedAt, time.Millisecond)
+	if a.Expiration != nil && s.NotNil(b.Expiration) {
+		s.WithinDuration(*a.Expiration, *b.Expiration, time.Millisecond)
+	}
+	a.CreatedAt = b.CreatedAt
+	a.UpdatedAt = b.UpdatedAt
+	a.Expiration = b.Expiration
+
+	s.Equal(a, b)
+}
+
+func widgetIDs(widgets []Widget) (ids []string) {
+	for _, w := range widgets {
+		ids = append(ids, w.ID)
+	}
+	return
+}
+
+func messageIDs(messages []Message) (ids []int64) {
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+	}
+	return
+}
@@ -0,0 +1,213 @@
+package depottest
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	WidgetTable  = "depot-widget"
+	MessageTable = "depot-message"
+	TagTable     = "depot-tag"
+)
+
+var (
+	testWidgetKey     = Widget{TenantID: "tenant", ID: "widget"}
+	upsertedWidgetKey = Widget{TenantID: "tenant", ID: "upserted"}
+	testDraftKey      = Draft{TenantID: "tenant", ID: 100}
+	testNoteKey       = Note{TenantID: "tenant", ID: 200}
+	testWidget        = Widget{
+		TenantID:    "tenant",
+		ID:          "widget",
+		Name:        "Widget",
+		Description: "Test Widget",
+		Refs:        []string{"ref1", "ref2"},
+		Preferences: map[string]map[string]bool{
+			"a": {
+				"1": true,
+				"2": false,
+			},
+			"b": {
+				"1": false,
+				"2": true,
+			},
+		},
+		Data: map[string]interface{}{
+			"c": "d",
+			"e": "f",
+		},
+		Version:   123,
+		Status:    "Active",
+		TTL:       time.Now().Add(time.Hour).Unix(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	testWidgets = []Widget{
+		{
+			TenantID:            "tenant",
+			ID:                  "widget1",
+			Name:                "Widget 1",
+			Description:         "Test Widget 1",
+			Category:            "category1",
+			Count:               1,
+			ExpirationPartition: 1,
+			Expiration:          aws.Time(time.Now().UTC().Add(-time.Hour)),
+			CreatedAt:           time.Now().UTC().Add(-time.Hour),
+			UpdatedAt:           time.Now().UTC(),
+		},
+		{
+			TenantID:            "tenant",
+			ID:                  "widget2",
+			Name:                "Widget 2",
+			Description:         "Test Widget 2",
+			Category:            "category2",
+			Count:               2,
+			ExpirationPartition: 1,
+			Expiration:          aws.Time(time.Now().UTC().Add(-time.Hour)),
+			CreatedAt:           time.Now().UTC().Add(-time.Hour),
+			UpdatedAt:           time.Now().UTC(),
+		},
+		{
+			TenantID:            "tenant",
+			ID:                  "widget3",
+			Name:                "The Widget 3",
+			Description:         "Test Widget 3",
+			Category:            "category1",
+			Count:               3,
+			ExpirationPartition: 1,
+			Expiration:          aws.Time(time.Now().UTC().Add(time.Hour)),
+			CreatedAt:           time.Now().UTC().Add(time.Minute),
+			UpdatedAt:           time.Now().UTC(),
+		},
+		{
+			TenantID:            "tenant",
+			ID:                  "widget4",
+			Name:                "Widget 4",
+			Description:         "Test Widget 4",
+			Category:            "category3",
+			Count:               4,
+			ExpirationPartition: 1,
+			Expiration:          aws.Time(time.Now().UTC().Add(time.Hour)),
+			CreatedAt:           time.Now().UTC().Add(2 * time.Minute),
+			UpdatedAt:           time.Now().UTC(),
+		},
+		{
+			TenantID:    "tenant",
+			ID:          "widget5",
+			Name:        "Widget 5",
+			Description: "Test Widget 5",
+			Count:       5,
+			CreatedAt:   time.Now().UTC().Add(3 * time.Minute),
+			UpdatedAt:   time.Now().UTC(),
+		},
+		{
+			TenantID:    "tenant",
+			ID:          "widget6",
+			Name:        "Widget 6",
+			Description: "Test Widget 6",
+			Count:       6,
+			CreatedAt:   time.Now().UTC().Add(4 * time.Minute),
+			UpdatedAt:   time.Now().UTC(),
+		},
+	}
+
+	testMessages = []Message{
+		{
+			TenantID: "tenant",
+			ID:       1,
+			Body:     "Message 1",
+		},
+		{
+			TenantID: "tenant",
+			ID:       2,
+			Body:     "Message 2",
+		},
+		{
+			TenantID: "tenant",
+			ID:       3,
+			Body:     "Message 3",
+		},
+		{
+			TenantID: "tenant",
+			ID:       4,
+			Body:     "Message 4",
+		},
+		{
+			TenantID: "tenant",
+			ID:       5,
+			Body:     "Message 5",
+		},
+		{
+			TenantID: "tenant",
+			ID:       6,
+			Body:     "Message 6",
+		},
+		{
+			TenantID: "tenant",
+			ID:       7,
+			Body:     "Message 7",
+		},
+	}
+)
+
+type WidgetStatus string
+
+type Widget struct {
+	TenantID            string                     `depot:"tenantId,pk,index:created:pk,index:named:pk,index:category:pk,index:count:pk"`
+	ID                  string                     `depot:"id,sk"`
+	Name                string                     `depot:"name,index:named:sk"`
+	Category            string                     `depot:"category,omitempty,index:category:sk"`
+	Description         string                     `depot:"desc,omitempty"`
+	Count               int64                      `depot:"count,omitempty,index:count:sk"`
+	Total               int64                      `depot:"total,omitempty"`
+	Refs                []string                   `depot:"refs,omitempty,indexed"`
+	Labels              []string                   `depot:"labels,omitempty,stringset"`
+	Stats               WidgetStats                `depot:"stats,omitempty"`
+	Preferences         map[string]map[string]bool `depot:"preferences,omitempty"`
+	Data                map[string]interface{}     `depot:"data,omitempty"`
+	TTL                 int64                      `depot:"ttl,ttl"`
+	Version             int64                      `depot:"version,omitempty"`
+	Status              WidgetStatus               `depot:"status,indexed"`
+	ExpirationPartition int64                      `depot:"expirationPartition,omitempty,index:expired:pk"`
+	Expiration          *time.Time                 `depot:"expiration,omitempty,index:expired:sk"`
+	CreatedAt           time.Time                  `depot:"createdAt,index:created:sk"`
+	UpdatedAt           time.Time                  `depot:"updatedAt"`
+}
+
+type WidgetStats struct {
+	Views int64 `depot:"views"`
+	Likes int64 `depot:"likes"`
+}
+
+type Message struct {
+	TenantID string `depot:"tenantId,pk"`
+	ID       int64  `depot:"id,sk"`
+	Body     string `depot:"body"`
+}
+
+// Draft is stored in the message table and carries an optimistic locking
+// version.
+type Draft struct {
+	TenantID string `depot:"tenantId,pk"`
+	ID       int64  `depot:"id,sk"`
+	Body     string `depot:"body"`
+	Version  int64  `depot:"version,version"`
+}
+
+// Note is stored in the message table and has its created and updated times
+// stamped by the database.
+type Note struct {
+	TenantID  string    `depot:"tenantId,pk"`
+	ID        int64     `depot:"id,sk"`
+	Body      string    `depot:"body"`
+	CreatedAt time.Time `depot:"createdAt,created"`
+	UpdatedAt time.Time `depot:"updatedAt,updated"`
+}
+
+// Tag has no sort key and is only used to verify errors that are raised before
+// a request reaches the backend.
+type Tag struct {
+	ID string `depot:"id,pk"`
+}
@@ -1,13 +1,18 @@
 package dynamo
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/big"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/andyday/depot"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -16,10 +21,32 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+const (
+	batchGetSize   = 100
+	batchWriteSize = 25
+	batchRetries   = 8
+	batchBackoff   = 50 * time.Millisecond
+	// putAttempts bounds the writes Put makes to keep a stored created time.
+	putAttempts = 3
+	// updateAttempts bounds the writes Update makes to leave out the Max and
+	// Min fields the stored item already outdoes.
+	updateAttempts = 3
+	// transactionAttempts bounds the runs RunInTransaction makes of a function
+	// whose reads went stale before its writes committed.
+	transactionAttempts = 3
+)
+
+var (
+	ErrUnprocessedItems   = errors.New("dynamo: unprocessed batch items")
+	ErrUnsupportedPageKey = errors.New("dynamo: unsupported page key type")
+)
+
 type DB struct {
 	dynamo  *dynamodb.Client
 	encoder *attributevalue.Encoder
 	decoder *attributevalue.Decoder
+	pages   depot.PageCodec
+	clock   func() time.Time
 }
 
 var _ depot.Database = &DB{}
@@ -32,8 +59,11 @@ func decoderOptions(opts *attributevalue.DecoderOptions) {
 	opts.TagKey = "depot"
 }
 
-func NewDatabase(cfg aws.Config) (c *DB, err error) {
+func NewDatabase(cfg aws.Config, opts ...depot.Option) (c *DB, err error) {
+	o := depot.NewOptions(opts...)
 	c = &DB{
+		pages:  o.PageCodec,
+		clock:  o.Clock,
 		dynamo: dynamodb.NewFromConfig(cfg),
 		encoder: attributevalue.NewEncoder(func(opts *attributevalue.EncoderOptions) {
 			opts.TagKey = "depot"
@@ -45,50 +75,157 @@ func NewDatabase(cfg aws.Config) (c *DB, err error) {
 	return
 }
 
-func (d *DB) Get(ctx context.Context, table string, entity interface{}) (err error) {
+func (d *DB) Get(ctx context.Context, table string, entity interface{}, op ...depot.GetOp) (err error) {
 	var (
 		out *dynamodb.GetItemOutput
-		in  = &dynamodb.GetItemInput{TableName: aws.String(table)}
+		in  *dynamodb.GetItemInput
 	)
-	if in.Key, err = keyFromEntity(entity); err != nil {
+	if in, err = getItemInput(table, entity, op); err != nil {
 		return
 	}
 
 	if out, err = d.dynamo.GetItem(ctx, in); err != nil {
 		return
 	}
+	return unmarshalItem(out, entity, in)
+}
+
+// getItemInput reads the item of entity, or only the fields that op selects,
+// consistently when op asks. DynamoDB keeps no past versions to read AsOf.
+func getItemInput(table string, entity interface{}, op []depot.GetOp) (in *dynamodb.GetItemInput, err error) {
+	var projection []string
+	if !depot.ReadTime(op).IsZero() {
+		return nil, depot.ErrUnsupported
+	}
+	in = &dynamodb.GetItemInput{TableName: aws.String(table)}
+	if in.Key, err = keyFromEntity(entity); err != nil {
+		return
+	}
+	if in.ConsistentRead, err = consistentRead("", op); err != nil {
+		return
+	}
+	if fields := depot.Selected(op); fields != nil {
+		if projection, err = depot.Projection("", entity, fields); err != nil {
+			return
+		}
+		in.ExpressionAttributeNames = make(map[string]string)
+		in.ProjectionExpression = projectionExpression(in.ExpressionAttributeNames, projection)
+	}
+	return
+}
+
+// unmarshalItem loads the item read by in into entity, whose fields are first
+// cleared when only some were read.
+func unmarshalItem(out *dynamodb.GetItemOutput, entity interface{}, in *dynamodb.GetItemInput) (err error) {
 	if len(out.Item) <= 0 {
 		return depot.ErrEntityNotFound
 	}
-	err = attributevalue.UnmarshalMapWithOptions(out.Item, entity, decoderOptions)
-	return
+	if in.ProjectionExpression != nil {
+		if err = depot.ResetEntity(entity); err != nil {
+			return
+		}
+	}
+	return attributevalue.UnmarshalMapWithOptions(out.Item, entity, decoderOptions)
+}
+
+// projectionExpression returns the expression loading the fields and dotted
+// paths of the projection.
+func projectionExpression(names map[string]string, projection []string) *string {
+	parts := make([]string, len(projection))
+	for i, name := range projection {
+		addNames(names, name)
+		parts[i] = attributeName(name)
+	}
+	return aws.String(strings.Join(parts, ", "))
+}
+
+// Put keeps the created time of a stored item by writing on condition that it
+// is unchanged, and retries with the stored time when it is not.
+func (d *DB) Put(ctx context.Context, table string, entity interface{}, op ...depot.Condition) (err error) {
+	var (
+		in *dynamodb.PutItemInput
+		c  check
+	)
+	if c, err = newCheck(entity, op); err != nil {
+		return
+	}
+	if c.stamps, err = entityTimestamps(entity); err != nil {
+		return
+	}
+	if c.stamps != nil {
+		c.stamps.Put(d.clock(), nil)
+	}
+	for attempt := 1; ; attempt++ {
+		if in, err = putItemInput(table, entity, c); err != nil {
+			return
+		}
+		if _, err = d.dynamo.PutItem(ctx, in); err == nil {
+			return c.bump()
+		}
+		if attempt == putAttempts || !c.restamp(err) {
+			return c.error(err)
+		}
+	}
 }
 
-func (d *DB) Put(ctx context.Context, table string, entity interface{}) (err error) {
-	var in = &dynamodb.PutItemInput{TableName: aws.String(table)}
+func putItemInput(table string, entity interface{}, c check) (in *dynamodb.PutItemInput, err error) {
+	in = &dynamodb.PutItemInput{
+		TableName:                           aws.String(table),
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
 	if in.Item, err = marshalEntity(entity); err != nil {
 		return
 	}
-	_, err = d.dynamo.PutItem(ctx, in)
+	if in.ConditionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues, err = c.expression(); err != nil {
+		return
+	}
+	err = c.write(in.Item)
 	return
 }
 
-func (d *DB) Delete(ctx context.Context, table string, entity interface{}) (err error) {
+func (d *DB) Delete(ctx context.Context, table string, entity interface{}, op ...depot.Condition) (err error) {
 	var (
-		inp = &dynamodb.DeleteItemInput{TableName: aws.String(table), ReturnValues: types.ReturnValueAllOld}
+		inp = &dynamodb.DeleteItemInput{
+			TableName:                           aws.String(table),
+			ReturnValues:                        types.ReturnValueAllOld,
+			ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+		}
 		out *dynamodb.DeleteItemOutput
+		c   check
 	)
 	if inp.Key, err = keyFromEntity(entity); err != nil {
 		return
 	}
+	if c, err = newCheck(entity, op); err != nil {
+		return
+	}
+	if inp.ConditionExpression, inp.ExpressionAttributeNames, inp.ExpressionAttributeValues, err = c.expression(); err != nil {
+		return
+	}
 
 	if out, err = d.dynamo.DeleteItem(ctx, inp); err != nil {
-		return
+		return c.error(err)
 	}
 	return unmarshalEntity(out.Attributes, entity)
 }
 
 func (d *DB) Create(ctx context.Context, table string, entity interface{}) (err error) {
+	var (
+		in *dynamodb.PutItemInput
+		c  check
+	)
+	if in, c, err = createItemInput(table, entity, d.clock()); err != nil {
+		return
+	}
+	if _, err = d.dynamo.PutItem(ctx, in); errorIsConditionCheckFailure(err) {
+		return depot.ErrEntityAlreadyExists
+	} else if err != nil {
+		return
+	}
+	return c.bump()
+}
+
+func createItemInput(table string, entity interface{}, now time.Time) (in *dynamodb.PutItemInput, c check, err error) {
 	var (
 		item map[string]types.AttributeValue
 		k    depot.Key
@@ -99,19 +236,115 @@ func (d *DB) Create(ctx context.Context, table string, entity interface{}) (err
 	if k, err = depot.EntityKey(entity); err != nil {
 		return
 	}
-
-	if _, err = d.dynamo.PutItem(ctx, &dynamodb.PutItemInput{
+	if c, err = newCheck(entity, nil); err != nil {
+		return
+	}
+	if c.stamps, err = entityTimestamps(entity); err != nil {
+		return
+	}
+	if c.stamps != nil {
+		c.stamps.Create(now)
+	}
+	if err = c.write(item); err != nil {
+		return
+	}
+	c.create = true
+	return &dynamodb.PutItemInput{
 		TableName:                aws.String(table),
 		Item:                     item,
 		ExpressionAttributeNames: map[string]string{"#pk": k.Partition.Name},
 		ConditionExpression:      aws.String("attribute_not_exists(#pk)"),
-	}); errorIsConditionCheckFailure(err) {
-		return depot.ErrEntityAlreadyExists
-	}
-	return
+	}, c, nil
 }
 
+// Update writes Max and Min fields on condition that they outdo the stored
+// values, and retries without the ones that do not.
 func (d *DB) Update(ctx context.Context, table string, entity interface{}, op ...depot.UpdateOp) (err error) {
+	var (
+		in   *dynamodb.UpdateItemInput
+		c    check
+		skip []string
+		now  = d.clock()
+	)
+	for attempt := 1; ; attempt++ {
+		if in, c, err = updateItemInput(table, entity, op, now, skip); err != nil {
+			return
+		}
+		if *in.UpdateExpression == "" {
+			return d.checkUpdate(ctx, in, c)
+		}
+		in.ReturnValues = types.ReturnValueAllNew
+		in.ReturnValuesOnConditionCheckFailure = types.ReturnValuesOnConditionCheckFailureAllOld
+		if _, err = d.dynamo.UpdateItem(ctx, in); err == nil {
+			return c.bump()
+		}
+		outdone := c.outdoneBy(err)
+		if attempt == updateAttempts || len(outdone) == 0 {
+			return c.error(err)
+		}
+		skip = append(skip, outdone...)
+	}
+}
+
+// checkUpdate evaluates the conditions of in, an update left with nothing to
+// write, with a condition check of its own.
+func (d *DB) checkUpdate(ctx context.Context, in *dynamodb.UpdateItemInput, c check) (err error) {
+	var tce *types.TransactionCanceledException
+	if in.ConditionExpression == nil {
+		return c.bump()
+	}
+	if _, err = d.dynamo.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{{ConditionCheck: conditionCheck(in)}},
+	}); errors.As(err, &tce) && len(tce.CancellationReasons) > 0 &&
+		aws.ToString(tce.CancellationReasons[0].Code) == "ConditionalCheckFailed" {
+		return c.failed(tce.CancellationReasons[0].Item)
+	} else if err != nil {
+		return
+	}
+	return c.bump()
+}
+
+// conditionCheck checks the conditions of in without writing anything.
+func conditionCheck(in *dynamodb.UpdateItemInput) *types.ConditionCheck {
+	names := in.ExpressionAttributeNames
+	if len(names) == 0 {
+		names = nil
+	}
+	return &types.ConditionCheck{
+		TableName:                           in.TableName,
+		Key:                                 in.Key,
+		ConditionExpression:                 in.ConditionExpression,
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           in.ExpressionAttributeValues,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+}
+
+// RunInTransaction collects the writes made by fn and commits them with a single
+// TransactWriteItems call, which also checks that the items fn read are
+// unchanged. When one has changed, fn runs again, up to transactionAttempts
+// times before failing with depot.ErrVersionConflict. Updates made inside it do
+// not fill in the entity.
+func (d *DB) RunInTransaction(ctx context.Context, fn func(tx depot.Tx) error) (err error) {
+	for attempt := 1; ; attempt++ {
+		var (
+			tx    = &transaction{d: d, ctx: ctx}
+			stale bool
+		)
+		if err = fn(tx); err != nil {
+			return
+		}
+		if stale, err = tx.commit(); err != nil || !stale {
+			return
+		}
+		if attempt == transactionAttempts {
+			return depot.ErrVersionConflict
+		}
+	}
+}
+
+// updateItemInput builds the update of entity, leaving out the fields in skip.
+func updateItemInput(table string, entity interface{}, op []depot.UpdateOp, now time.Time, skip []string) (in *dynamodb.UpdateItemInput, c check, err error) {
 	var (
 		key     map[string]types.AttributeValue
 		updates []depot.Update
@@ -126,39 +359,75 @@ func (d *DB) Update(ctx context.Context, table string, entity interface{}, op ..
 	if updates, err = depot.EntityUpdates(entity, op); err != nil {
 		return
 	}
+	if c, err = newCheck(entity, nil); err != nil {
+		return
+	}
+	updates = slices.DeleteFunc(updates, func(u depot.Update) bool { return slices.Contains(skip, u.Name) })
+	c.conditions = depot.UpdateConditions(updates)
+	c.removed = depot.RemovedFields(updates)
+	c.extrema = extremeUpdates(updates)
+	if c.stamps, err = entityTimestamps(entity); err != nil {
+		return
+	}
+	if c.stamps != nil {
+		c.stamps.Update(now)
+		updates = append(updates, c.stamps.Updates()...)
+	}
 
 	for _, u := range updates {
-		names["#"+u.Name] = u.Name
+		if _, ok := u.Op.(depot.Condition); ok {
+			continue
+		}
+		addNames(names, u.Name)
+		if _, ok := u.Op.(*depot.RemoveUpdateOp); ok {
+			continue
+		}
 		if mv, err = updateValue(u); err != nil {
-			return err
+			return
+		}
+		values[attributeValue(u.Name)] = mv
+		switch u.Op.(type) {
+		case *depot.AppendUpdateOp, *depot.PrependUpdateOp:
+			values[attributeValue(u.Name)+"_empty"] = &types.AttributeValueMemberL{Value: []types.AttributeValue{}}
 		}
-		values[":"+u.Name] = mv
 	}
 
-	set, add := updateExpressionParts(updates)
-	conditions := conditionExpression(updates)
-	if len(set) > 0 {
-		exp.WriteString("SET ")
-		exp.WriteString(strings.Join(set, ", "))
+	set, add, remove, del := updateExpressionParts(updates)
+	condition, err := expression{names, values}.conditions(c.conditions)
+	if err != nil {
+		return
+	}
+	for _, u := range c.extrema {
+		condition = expectOutdone(condition, u)
+	}
+	if c.version != nil {
+		condition, names, values = expectVersion(condition, names, values, *c.version)
+		p := placeholder(c.version.Name)
+		if values[":"+p+"_next"], err = attributevalue.Marshal(c.version.Next()); err != nil {
+			return
+		}
+		set = append(set, fmt.Sprintf("#%s = :%s_next", p, p))
 	}
-	if len(set) > 0 && len(add) > 0 {
-		exp.WriteRune(' ')
+	if len(values) == 0 {
+		values = nil
 	}
-	if len(add) > 0 {
-		exp.WriteString("ADD ")
-		exp.WriteString(strings.Join(add, ", "))
+	for _, clause := range []struct {
+		action string
+		parts  []string
+	}{{"SET", set}, {"ADD", add}, {"REMOVE", remove}, {"DELETE", del}} {
+		if len(clause.parts) > 0 {
+			exp.WriteString(clause.action + " " + strings.Join(clause.parts, ", ") + " ")
+		}
 	}
 
-	_, err = d.dynamo.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+	return &dynamodb.UpdateItemInput{
 		TableName:                 aws.String(table),
 		Key:                       key,
-		ConditionExpression:       conditions,
+		ConditionExpression:       condition,
 		ExpressionAttributeNames:  names,
 		ExpressionAttributeValues: values,
 		UpdateExpression:          aws.String(strings.TrimSpace(exp.String())),
-		ReturnValues:              types.ReturnValueAllNew,
-	})
-	return
+	}, c, nil
 }
 
 func (d *DB) Query(ctx context.Context, table, kind string, entity interface{}, entities interface{}, op ...depot.QueryOp) (nextPage string, err error) {
@@ -167,7 +436,6 @@ func (d *DB) Query(ctx context.Context, table, kind string, entity interface{},
 		names      = make(map[string]string)
 		values     = make(map[string]types.AttributeValue)
 		conditions []depot.EntityCondition
-		cv         types.AttributeValue
 		res        *dynamodb.QueryOutput
 		scanRes    *dynamodb.ScanOutput
 		keyExp     *string
@@ -175,37 +443,64 @@ func (d *DB) Query(ctx context.Context, table, kind string, entity interface{},
 		limit      *int32
 		page       map[string]types.AttributeValue
 		asc        *bool
+		sortField  string
+		projection []string
+		projExp    *string
+		consistent *bool
 	)
 	if kind != "" {
 		idx = &kind
 	}
+	if !depot.ReadTime(op).IsZero() {
+		return "", depot.ErrUnsupported
+	}
 
-	if _, conditions, err = depot.EntityConditions(kind, entity, op); err != nil {
+	if sortField, conditions, err = depot.EntityConditions(kind, entity, op); err != nil {
+		return
+	}
+	shape := depot.PageShape(table, kind, conditions, op)
+	if op, err = depot.DecodePageOps(d.pages, shape, op); err != nil {
 		return
 	}
 
-	for _, c := range conditions {
-		names["#"+c.Name] = c.Name
-		if c.Value != nil {
-			if cv, err = conditionValue(c); err != nil {
-				return
-			}
-			values[":"+c.Name] = cv
+	if keyExp, filterExp, err = (expression{names, values}).query(conditions); err != nil {
+		return
+	}
+	if limit, page, asc, err = queryDirectives(op, sortField); err != nil {
+		return
+	}
+	if fields := depot.Selected(op); fields != nil {
+		if projection, err = depot.Projection(kind, entity, fields); err != nil {
+			return
 		}
+		projExp = projectionExpression(names, projection)
 	}
-
-	keyExp, filterExp = queryExpressionParts(conditions)
-	if limit, page, asc, err = queryDirectives(op); err != nil {
+	if consistent, err = consistentRead(kind, op); err != nil {
 		return
 	}
 
+	if i, ok := keyIn(conditions); ok {
+		return d.queryIn(ctx, dynamodb.QueryInput{
+			TableName:        aws.String(table),
+			IndexName:        idx,
+			ConsistentRead:   consistent,
+			Limit:            limit,
+			ScanIndexForward: asc,
+		}, conditions, i, projection, page, entities, shape)
+	}
 	if keyExp == nil {
+		// A Scan returns items in no particular order.
+		if asc != nil {
+			return "", depot.ErrUnsupported
+		}
 		if scanRes, err = d.dynamo.Scan(ctx, &dynamodb.ScanInput{
 			TableName:                 aws.String(table),
 			IndexName:                 idx,
 			ExpressionAttributeNames:  names,
 			ExpressionAttributeValues: values,
 			FilterExpression:          filterExp,
+			ProjectionExpression:      projExp,
+			ConsistentRead:            consistent,
 			Limit:                     limit,
 			ExclusiveStartKey:         page,
 		}); err != nil {
@@ -214,7 +509,7 @@ func (d *DB) Query(ctx context.Context, table, kind string, entity interface{},
 		if err = unmarshalEntities(scanRes.Items, entities); err != nil {
 			return
 		}
-		return EncodePage(scanRes.LastEvaluatedKey)
+		return d.encodePage(shape, scanRes.LastEvaluatedKey)
 	}
 
 	if res, err = d.dynamo.Query(ctx, &dynamodb.QueryInput{
@@ -224,6 +519,8 @@ func (d *DB) Query(ctx context.Context, table, kind string, entity interface{},
 		ExpressionAttributeValues: values,
 		KeyConditionExpression:    keyExp,
 		FilterExpression:          filterExp,
+		ProjectionExpression:      projExp,
+		ConsistentRead:            consistent,
 		Limit:                     limit,
 		ExclusiveStartKey:         page,
 		ScanIndexForward:          asc,
@@ -234,178 +531,1415 @@ func (d *DB) Query(ctx context.Context, table, kind string, entity interface{},
 	if err = unmarshalEntities(res.Items, entities); err != nil {
 		return
 	}
-	return EncodePage(res.LastEvaluatedKey)
+	return d.encodePage(shape, res.LastEvaluatedKey)
 }
 
-func keyMap(k depot.Key) (m map[string]interface{}) {
-	m = make(map[string]interface{})
-	m[k.Partition.Name] = k.Partition.Value
-	if k.Sort.Name != "" {
-		m[k.Sort.Name] = k.Sort.Value
+// Aggregate counts the matching items with a Select of COUNT, or reads only the
+// field of each to add it up, following LastEvaluatedKey through every page.
+func (d *DB) Aggregate(ctx context.Context, table, kind string, entity interface{}, agg depot.Aggregate, field string, op ...depot.QueryOp) (result float64, err error) {
+	var (
+		in *dynamodb.QueryInput
+		a  = depot.Aggregator{Aggregate: agg, Field: field}
+	)
+	if in, err = aggregateInput(table, kind, entity, agg, field, op); err != nil {
+		return
+	}
+	for {
+		var (
+			items []map[string]types.AttributeValue
+			count int32
+			last  map[string]types.AttributeValue
+		)
+		if in.KeyConditionExpression == nil {
+			var res *dynamodb.ScanOutput
+			if res, err = d.dynamo.Scan(ctx, scanInput(in)); err != nil {
+				return
+			}
+			items, count, last = res.Items, res.Count, res.LastEvaluatedKey
+		} else {
+			var res *dynamodb.QueryOutput
+			if res, err = d.dynamo.Query(ctx, in); err != nil {
+				return
+			}
+			items, count, last = res.Items, res.Count, res.LastEvaluatedKey
+		}
+		if agg == depot.AggregateCount {
+			a.AddCount(int64(count))
+		}
+		for _, item := range items {
+			a.Add(storedItem(item))
+		}
+		if len(last) == 0 {
+			return a.Result(), nil
+		}
+		in.ExclusiveStartKey = last
 	}
-	return
 }
 
-func keyFromEntity(entity interface{}) (key map[string]types.AttributeValue, err error) {
-	var k depot.Key
-	if k, err = depot.EntityKey(entity); err != nil {
+// aggregateInput returns the query for the items an aggregate covers, which
+// is run as a scan when it has no key condition.
+func aggregateInput(table, kind string, entity interface{}, agg depot.Aggregate, field string, op []depot.QueryOp) (in *dynamodb.QueryInput, err error) {
+	var conditions []depot.EntityCondition
+	if !depot.ReadTime(op).IsZero() {
+		return nil, depot.ErrUnsupported
+	}
+	if err = depot.CheckAggregate(entity, agg, field); err != nil {
 		return
 	}
-	key, err = attributevalue.MarshalMap(keyMap(k))
-	return
-}
-
-func marshalEntity(entity interface{}) (map[string]types.AttributeValue, error) {
-	return attributevalue.MarshalMapWithOptions(entity, encoderOptions)
-}
-
-func unmarshalEntity(item map[string]types.AttributeValue, entity interface{}) (err error) {
-	v := reflect.ValueOf(entity)
-	if len(item) > 0 && v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct {
-		return attributevalue.UnmarshalMapWithOptions(item, entity, decoderOptions)
+	if _, conditions, err = depot.EntityConditions(kind, entity, op); err != nil {
+		return
+	}
+	in = &dynamodb.QueryInput{
+		TableName:                 aws.String(table),
+		ExpressionAttributeNames:  make(map[string]string),
+		ExpressionAttributeValues: make(map[string]types.AttributeValue),
+	}
+	if kind != "" {
+		in.IndexName = aws.String(kind)
+	}
+	if in.ConsistentRead, err = consistentRead(kind, op); err != nil {
+		return
+	}
+	e := expression{in.ExpressionAttributeNames, in.ExpressionAttributeValues}
+	if in.KeyConditionExpression, in.FilterExpression, err = e.query(conditions); err != nil {
+		return
+	}
+	if agg == depot.AggregateCount {
+		in.Select = types.SelectCount
+	} else {
+		in.ProjectionExpression = projectionExpression(in.ExpressionAttributeNames, []string{field})
+	}
+	if len(in.ExpressionAttributeNames) == 0 {
+		in.ExpressionAttributeNames = nil
+	}
+	if len(in.ExpressionAttributeValues) == 0 {
+		in.ExpressionAttributeValues = nil
 	}
 	return
 }
 
-func unmarshalEntities(items []map[string]types.AttributeValue, entities interface{}) (err error) {
-	return attributevalue.UnmarshalListOfMapsWithOptions(items, entities, decoderOptions)
+func scanInput(in *dynamodb.QueryInput) *dynamodb.ScanInput {
+	return &dynamodb.ScanInput{
+		TableName:                 in.TableName,
+		IndexName:                 in.IndexName,
+		ExpressionAttributeNames:  in.ExpressionAttributeNames,
+		ExpressionAttributeValues: in.ExpressionAttributeValues,
+		FilterExpression:          in.FilterExpression,
+		ProjectionExpression:      in.ProjectionExpression,
+		Select:                    in.Select,
+		ConsistentRead:            in.ConsistentRead,
+		ExclusiveStartKey:         in.ExclusiveStartKey,
+	}
 }
 
-func updateExpressionParts(updates []depot.Update) (set, add []string) {
-	for _, u := range updates {
-		switch u.Op.(type) {
-		case *depot.AddUpdateOp:
-			add = append(add, fmt.Sprintf("#%s :%s", u.Name, u.Name))
-		case *depot.SubtractUpdateOp:
-			add = append(add, fmt.Sprintf("#%s :%s", u.Name, u.Name))
-		default:
-			set = append(set, fmt.Sprintf("#%s = :%s", u.Name, u.Name))
-		}
+// consistentRead returns the ConsistentRead setting for ops, which is left
+// unset for the eventually consistent reads DynamoDB makes by default. Global
+// secondary indexes cannot be read consistently.
+func consistentRead[O any](kind string, ops []O) (consistent *bool, err error) {
+	if !depot.ConsistentRead(ops) {
+		return
+	} else if kind != "" {
+		return nil, depot.ErrConsistentIndex
 	}
-	return
+	return aws.Bool(true), nil
 }
 
-func queryExpressionParts(conditions []depot.EntityCondition) (keyExp, filterExp *string) {
+// queryIn runs the query once for each value of the In condition on the sort
+// key at conditions[i], in key order, so that it stays a Query on a single
+// partition rather than becoming a Scan. A page token holds the last key read,
+// or only the sort key of the value the next page starts from.
+func (d *DB) queryIn(ctx context.Context, base dynamodb.QueryInput, conditions []depot.EntityCondition, i int, projection []string, page map[string]types.AttributeValue, entities interface{}, shape []byte) (nextPage string, err error) {
 	var (
-		keyParts    []string
-		filterParts []string
+		keys  []keyValue
+		items []map[string]types.AttributeValue
+		next  map[string]types.AttributeValue
+		res   *dynamodb.QueryOutput
+		start int
+		c     = conditions[i]
+		limit = int(aws.ToInt32(base.Limit))
 	)
-	for _, c := range conditions {
-		var exp string
-		switch c.Op.(type) {
-		case *depot.EqualCondition:
-			exp = fmt.Sprintf("#%s = :%s", c.Name, c.Name)
-		case *depot.NotEqualCondition:
-			exp = fmt.Sprintf("#%s <> :%s", c.Name, c.Name)
-		case *depot.LTCondition:
-			exp = fmt.Sprintf("#%s < :%s", c.Name, c.Name)
-		case *depot.LTECondition:
-			exp = fmt.Sprintf("#%s <= :%s", c.Name, c.Name)
-		case *depot.GTCondition:
-			exp = fmt.Sprintf("#%s > :%s", c.Name, c.Name)
-		case *depot.GTECondition:
-			exp = fmt.Sprintf("#%s >= :%s", c.Name, c.Name)
-		case *depot.ExistsCondition:
-			exp = fmt.Sprintf("attribute_exists(#%s)", c.Name)
-		default:
-			exp = fmt.Sprintf("#%s = :%s", c.Name, c.Name)
+	if keys, err = inKeys(c.Op.(*depot.InCondition).List(), aws.ToBool(base.ScanIndexForward) || base.ScanIndexForward == nil); err != nil {
+		return
+	}
+	if page != nil {
+		if start = slices.IndexFunc(keys, func(k keyValue) bool { return compareKeys(k.av, page[c.Name]) == 0 }); start < 0 {
+			return "", depot.ErrInvalidPage
 		}
-
-		if c.KeyType == depot.KeyTypeNone {
-			filterParts = append(filterParts, exp)
-		} else {
-			keyParts = append(keyParts, exp)
+		if len(page) == 1 {
+			page = nil
 		}
 	}
-	if len(keyParts) > 0 {
-		keyExp = aws.String(strings.Join(keyParts, " AND "))
+	conditions = slices.Clone(conditions)
+values:
+	for j := start; j < len(keys); j++ {
+		in := base
+		in.ExpressionAttributeNames = make(map[string]string)
+		in.ExpressionAttributeValues = make(map[string]types.AttributeValue)
+		conditions[i] = depot.EntityCondition{Name: c.Name, KeyType: c.KeyType, Value: keys[j].value}
+		if in.KeyConditionExpression, in.FilterExpression, err = (expression{in.ExpressionAttributeNames, in.ExpressionAttributeValues}).query(conditions); err != nil {
+			return
+		}
+		if projection != nil {
+			in.ProjectionExpression = projectionExpression(in.ExpressionAttributeNames, projection)
+		}
+		in.ExclusiveStartKey, page = page, nil
+		for {
+			if limit > 0 {
+				in.Limit = aws.Int32(int32(limit - len(items)))
+			}
+			if res, err = d.dynamo.Query(ctx, &in); err != nil {
+				return
+			}
+			items = append(items, res.Items...)
+			if limit > 0 && len(items) >= limit {
+				if next = res.LastEvaluatedKey; next == nil && j+1 < len(keys) {
+					next = map[string]types.AttributeValue{c.Name: keys[j+1].av}
+				}
+				break values
+			}
+			if in.ExclusiveStartKey = res.LastEvaluatedKey; in.ExclusiveStartKey == nil {
+				break
+			}
+		}
 	}
-	if len(filterParts) > 0 {
-		filterExp = aws.String(strings.Join(filterParts, " AND "))
+	if err = unmarshalEntities(items, entities); err != nil {
+		return
 	}
-	return
+	return d.encodePage(shape, next)
 }
 
-func conditionExpression(updates []depot.Update) (condition *string) {
-	var parts []string
-	for _, u := range updates {
-		var exp string
-		switch u.Op.(type) {
-		case *depot.EqualCondition:
-			exp = fmt.Sprintf("#%s = :%s", u.Name, u.Name)
-		case *depot.NotEqualCondition:
-			exp = fmt.Sprintf("#%s <> :%s", u.Name, u.Name)
-		case *depot.LTCondition:
-			exp = fmt.Sprintf("#%s < :%s", u.Name, u.Name)
-		case *depot.LTECondition:
-			exp = fmt.Sprintf("#%s <= :%s", u.Name, u.Name)
-		case *depot.GTCondition:
-			exp = fmt.Sprintf("#%s > :%s", u.Name, u.Name)
-		case *depot.GTECondition:
-			exp = fmt.Sprintf("#%s >= :%s", u.Name, u.Name)
-		case *depot.ExistsCondition:
-			exp = fmt.Sprintf("attribute_exists(#%s)", u.Name)
-		}
-		if exp != "" {
-			parts = append(parts, exp)
+// keyIn returns the position of an In condition on the sort key when it is
+// the only condition on the sort key and the partition key is matched exactly,
+// so the query can run once for each value it lists.
+func keyIn(conditions []depot.EntityCondition) (i int, ok bool) {
+	var partition, sorts int
+	for j, c := range conditions {
+		switch c.KeyType {
+		case depot.KeyTypePartition:
+			if !keyCondition(c) {
+				return 0, false
+			}
+			partition++
+		case depot.KeyTypeSort:
+			sorts++
+			if _, in := c.Op.(*depot.InCondition); in {
+				i, ok = j, true
+			}
 		}
 	}
-	if len(parts) > 0 {
-		condition = aws.String(strings.Join(parts, "AND"))
+	return i, ok && partition > 0 && sorts == 1
+}
+
+// keyValue is a value an In condition lists along with the attribute value it
+// is stored as.
+type keyValue struct {
+	value interface{}
+	av    types.AttributeValue
+}
+
+// inKeys returns the distinct values of list in key order, or in reverse
+// order when asc is false.
+func inKeys(list []interface{}, asc bool) (keys []keyValue, err error) {
+	for _, v := range list {
+		var av types.AttributeValue
+		if av, err = attributevalue.Marshal(v); err != nil {
+			return
+		}
+		if !slices.ContainsFunc(keys, func(k keyValue) bool { return compareKeys(k.av, av) == 0 }) {
+			keys = append(keys, keyValue{value: v, av: av})
+		}
 	}
+	slices.SortFunc(keys, func(a, b keyValue) int {
+		if asc {
+			return compareKeys(a.av, b.av)
+		}
+		return compareKeys(b.av, a.av)
+	})
 	return
 }
 
-func queryDirectives(ops []depot.QueryOp) (limit *int32, page map[string]types.AttributeValue, asc *bool, err error) {
-	for _, op := range ops {
-		if d, ok := op.(depot.QueryDirective); ok {
-			switch v := d.(type) {
-			case *depot.LimitQueryDirective:
-				limit = aws.Int32(int32(v.Limit))
-			case *depot.PageQueryDirective:
-				if page, err = DecodePage(v.Page); err != nil {
-					return
-				}
-			case *depot.AscQueryDirective:
-				asc = aws.Bool(true)
-			case *depot.DescQueryDirective:
-				asc = aws.Bool(false)
+// compareKeys orders key attribute values the way DynamoDB sorts them: strings
+// and binary by their bytes and numbers by value. Values of different types
+// are ordered by type.
+func compareKeys(a, b types.AttributeValue) int {
+	switch av := a.(type) {
+	case *types.AttributeValueMemberS:
+		if bv, ok := b.(*types.AttributeValueMemberS); ok {
+			return strings.Compare(av.Value, bv.Value)
+		}
+	case *types.AttributeValueMemberN:
+		if bv, ok := b.(*types.AttributeValueMemberN); ok {
+			x, xok := new(big.Float).SetString(av.Value)
+			y, yok := new(big.Float).SetString(bv.Value)
+			if xok && yok {
+				return x.Cmp(y)
 			}
+			return strings.Compare(av.Value, bv.Value)
+		}
+	case *types.AttributeValueMemberB:
+		if bv, ok := b.(*types.AttributeValueMemberB); ok {
+			return bytes.Compare(av.Value, bv.Value)
 		}
 	}
-	return
+	return strings.Compare(fmt.Sprintf("%T", a), fmt.Sprintf("%T", b))
 }
 
-func DecodePage(encoded string) (decoded map[string]types.AttributeValue, err error) {
-	if encoded == "" {
+func (d *DB) encodePage(shape []byte, key map[string]types.AttributeValue) (page string, err error) {
+	if page, err = EncodePage(key); err != nil {
 		return
 	}
+	return d.pages.Encode(shape, page)
+}
+
+func (d *DB) BatchGet(ctx context.Context, table string, entities interface{}) (err error) {
 	var (
-		bytes []byte
-		m     = make(map[string]map[string]string)
+		v     reflect.Value
+		keys  []map[string]types.AttributeValue
+		items []map[string]types.AttributeValue
+		res   []map[string]types.AttributeValue
+		index = make(map[string][]int)
 	)
-	decoded = make(map[string]types.AttributeValue)
-	if bytes, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
-		return
-	}
-	if err = json.Unmarshal(bytes, &m); err != nil {
+	if v, err = depot.EntitySlice(entities); err != nil {
 		return
 	}
+	for i := 0; i < v.Len(); i++ {
+		var (
+			k   depot.Key
+			key map[string]types.AttributeValue
+		)
+		if k, err = depot.EntityKey(v.Index(i).Addr().Interface()); err != nil {
+			return
+		}
+		// BatchGetItem rejects duplicate keys so each key is requested once.
+		if _, ok := index[k.String()]; !ok {
+			if key, err = attributevalue.MarshalMap(keyMap(k)); err != nil {
+				return
+			}
+			keys = append(keys, key)
+		}
+		index[k.String()] = append(index[k.String()], i)
+	}
+	for _, chunk := range chunks(keys, batchGetSize) {
+		if res, err = d.batchGet(ctx, table, chunk); err != nil {
+			return
+		}
+		items = append(items, res...)
+	}
+
+	found := make([]bool, v.Len())
+	for _, item := range items {
+		var k depot.Key
+		ev := reflect.New(v.Type().Elem())
+		if err = attributevalue.UnmarshalMapWithOptions(item, ev.Interface(), decoderOptions); err != nil {
+			return
+		}
+		if k, err = depot.EntityKey(ev.Interface()); err != nil {
+			return
+		}
+		for _, i := range index[k.String()] {
+			v.Index(i).Set(ev.Elem())
+			found[i] = true
+		}
+	}
+	return depot.KeepEntities(v, found)
+}
+
+func (d *DB) BatchPut(ctx context.Context, table string, entities interface{}) (err error) {
+	var (
+		v        reflect.Value
+		item     map[string]types.AttributeValue
+		requests []types.WriteRequest
+	)
+	if v, err = depot.EntitySlice(entities); err != nil {
+		return
+	}
+	for i := 0; i < v.Len(); i++ {
+		if item, err = marshalEntity(v.Index(i).Addr().Interface()); err != nil {
+			return
+		}
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+	return d.batchWrite(ctx, table, requests)
+}
+
+func (d *DB) BatchDelete(ctx context.Context, table string, entities interface{}) (err error) {
+	var (
+		v        reflect.Value
+		key      map[string]types.AttributeValue
+		requests []types.WriteRequest
+	)
+	if v, err = depot.EntitySlice(entities); err != nil {
+		return
+	}
+	for i := 0; i < v.Len(); i++ {
+		if key, err = keyFromEntity(v.Index(i).Addr().Interface()); err != nil {
+			return
+		}
+		requests = append(requests, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key}})
+	}
+	return d.batchWrite(ctx, table, requests)
+}
+
+func (d *DB) batchGet(ctx context.Context, table string, keys []map[string]types.AttributeValue) (items []map[string]types.AttributeValue, err error) {
+	var (
+		out *dynamodb.BatchGetItemOutput
+		req = map[string]types.KeysAndAttributes{table: {Keys: keys}}
+	)
+	for attempt := 0; len(req) > 0; attempt++ {
+		if err = retryBackoff(ctx, attempt); err != nil {
+			return
+		}
+		if out, err = d.dynamo.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: req}); err != nil {
+			return
+		}
+		items = append(items, out.Responses[table]...)
+		req = out.UnprocessedKeys
+	}
+	return
+}
+
+func (d *DB) batchWrite(ctx context.Context, table string, requests []types.WriteRequest) (err error) {
+	var out *dynamodb.BatchWriteItemOutput
+	for _, chunk := range chunks(requests, batchWriteSize) {
+		req := map[string][]types.WriteRequest{table: chunk}
+		for attempt := 0; len(req) > 0; attempt++ {
+			if err = retryBackoff(ctx, attempt); err != nil {
+				return
+			}
+			if out, err = d.dynamo.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: req}); err != nil {
+				return
+			}
+			req = out.UnprocessedItems
+		}
+	}
+	return
+}
+
+// retryBackoff waits before retrying unprocessed batch items, doubling the
+// delay on every attempt and giving up after batchRetries attempts.
+func retryBackoff(ctx context.Context, attempt int) error {
+	if attempt == 0 {
+		return nil
+	}
+	if attempt > batchRetries {
+		return ErrUnprocessedItems
+	}
+	t := time.NewTimer(batchBackoff << (attempt - 1))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func chunks[T any](list []T, size int) (out [][]T) {
+	for len(list) > size {
+		out = append(out, list[:size])
+		list = list[size:]
+	}
+	if len(list) > 0 {
+		out = append(out, list)
+	}
+	return
+}
+
+type transaction struct {
+	d      *DB
+	ctx    context.Context
+	items  []types.TransactWriteItem
+	checks []check
+	reads  []read
+}
+
+var _ depot.Tx = &transaction{}
+
+// Get reads the item with a consistent read outside of the transaction, which
+// then checks that the item is still as it was read.
+func (t *transaction) Get(table string, entity interface{}, op ...depot.GetOp) (err error) {
+	var (
+		out   *dynamodb.GetItemOutput
+		in    *dynamodb.GetItemInput
+		paths []string
+	)
+	if in, err = getItemInput(table, entity, op); err != nil {
+		return
+	}
+	in.ConsistentRead = aws.Bool(true)
+	if fields := depot.Selected(op); fields != nil {
+		if paths, err = depot.Projection("", entity, fields); err != nil {
+			return
+		}
+	}
+	if out, err = t.d.dynamo.GetItem(t.ctx, in); err != nil {
+		return
+	}
+	if err = unmarshalItem(out, entity, in); err != nil && !errors.Is(err, depot.ErrEntityNotFound) {
+		return
+	}
+	t.read(newRead(table, in.Key, out.Item, paths, entity))
+	return err
+}
+
+// read records r, replacing an earlier read of the same item.
+func (t *transaction) read(r read) {
+	for i := range t.reads {
+		if t.reads[i].is(aws.String(r.table), r.key) {
+			t.reads[i] = r
+			return
+		}
+	}
+	t.reads = append(t.reads, r)
+}
+
+// Put reads the created time of a stored item ahead of the transaction, which
+// then fails with depot.ErrConditionFailed should it change.
+func (t *transaction) Put(table string, entity interface{}, op ...depot.Condition) (err error) {
+	var (
+		in       *dynamodb.PutItemInput
+		c        check
+		existing map[string]interface{}
+	)
+	if c, err = newCheck(entity, op); err != nil {
+		return
+	}
+	if c.stamps, err = entityTimestamps(entity); err != nil {
+		return
+	}
+	if c.stamps != nil && c.stamps.Created != "" {
+		if existing, err = t.stored(table, entity); err != nil {
+			return
+		}
+	}
+	if c.stamps != nil {
+		c.stamps.Put(t.d.clock(), existing)
+	}
+	if in, err = putItemInput(table, entity, c); err != nil {
+		return
+	}
+	t.add(types.TransactWriteItem{Put: &types.Put{
+		TableName:                           in.TableName,
+		Item:                                in.Item,
+		ConditionExpression:                 in.ConditionExpression,
+		ExpressionAttributeNames:            in.ExpressionAttributeNames,
+		ExpressionAttributeValues:           in.ExpressionAttributeValues,
+		ReturnValuesOnConditionCheckFailure: in.ReturnValuesOnConditionCheckFailure,
+	}}, c)
+	return
+}
+
+// stored returns the item stored for entity, or nil when there is none.
+func (t *transaction) stored(table string, entity interface{}) (existing map[string]interface{}, err error) {
+	var (
+		out *dynamodb.GetItemOutput
+		in  = &dynamodb.GetItemInput{TableName: aws.String(table), ConsistentRead: aws.Bool(true)}
+	)
+	if in.Key, err = keyFromEntity(entity); err != nil {
+		return
+	}
+	if out, err = t.d.dynamo.GetItem(t.ctx, in); err != nil || len(out.Item) == 0 {
+		return
+	}
+	err = attributevalue.UnmarshalMapWithOptions(out.Item, &existing, decoderOptions)
+	return
+}
+
+func (t *transaction) Delete(table string, entity interface{}, op ...depot.Condition) (err error) {
+	var (
+		del = &types.Delete{
+			TableName:                           aws.String(table),
+			ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+		}
+		c check
+	)
+	if del.Key, err = keyFromEntity(entity); err != nil {
+		return
+	}
+	if c, err = newCheck(entity, op); err != nil {
+		return
+	}
+	if del.ConditionExpression, del.ExpressionAttributeNames, del.ExpressionAttributeValues, err = c.expression(); err != nil {
+		return
+	}
+	// A delete leaves no version to bump.
+	c.entity = nil
+	t.add(types.TransactWriteItem{Delete: del}, c)
+	return
+}
+
+func (t *transaction) Create(table string, entity interface{}) (err error) {
+	var (
+		in *dynamodb.PutItemInput
+		c  check
+	)
+	if in, c, err = createItemInput(table, entity, t.d.clock()); err != nil {
+		return
+	}
+	t.add(types.TransactWriteItem{Put: &types.Put{
+		TableName:                in.TableName,
+		Item:                     in.Item,
+		ExpressionAttributeNames: in.ExpressionAttributeNames,
+		ConditionExpression:      in.ConditionExpression,
+	}}, c)
+	return
+}
+
+// Update reads the stored item first when there are Max or Min fields, and
+// leaves out the ones it already outdoes.
+func (t *transaction) Update(table string, entity interface{}, op ...depot.UpdateOp) (err error) {
+	var (
+		in  *dynamodb.UpdateItemInput
+		c   check
+		now = t.d.clock()
+	)
+	if in, c, err = updateItemInput(table, entity, op, now, nil); err != nil {
+		return
+	}
+	if len(c.extrema) > 0 {
+		var existing map[string]interface{}
+		if existing, err = t.stored(table, entity); err != nil {
+			return
+		}
+		if skip := c.outdone(existing); len(skip) > 0 {
+			if in, c, err = updateItemInput(table, entity, op, now, skip); err != nil {
+				return
+			}
+		}
+	}
+	if *in.UpdateExpression == "" {
+		if in.ConditionExpression != nil {
+			t.add(types.TransactWriteItem{ConditionCheck: conditionCheck(in)}, c)
+		}
+		return
+	}
+	t.add(types.TransactWriteItem{Update: &types.Update{
+		TableName:                           in.TableName,
+		Key:                                 in.Key,
+		ConditionExpression:                 in.ConditionExpression,
+		ExpressionAttributeNames:            in.ExpressionAttributeNames,
+		ExpressionAttributeValues:           in.ExpressionAttributeValues,
+		UpdateExpression:                    in.UpdateExpression,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}}, c)
+	return
+}
+
+func (t *transaction) add(item types.TransactWriteItem, c check) {
+	t.items = append(t.items, item)
+	t.checks = append(t.checks, c)
+}
+
+// commit writes the items along with the checks that the items read are
+// unchanged, and reports whether any of them was not.
+func (t *transaction) commit() (stale bool, err error) {
+	var tce *types.TransactionCanceledException
+	if len(t.items) == 0 {
+		return
+	}
+	for i := range t.reads {
+		t.expect(&t.reads[i])
+	}
+	if _, err = t.d.dynamo.TransactWriteItems(t.ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: t.items,
+	}); errors.As(err, &tce) {
+		for i, r := range tce.CancellationReasons {
+			// A check made only for a read has no entity, and fails only when
+			// the read item changed.
+			c := t.checks[i]
+			if aws.ToString(r.Code) == "ConditionalCheckFailed" && c.read != nil &&
+				(c.entity == nil || c.read.changed(r.Item)) {
+				return true, nil
+			}
+		}
+		for i, r := range tce.CancellationReasons {
+			if aws.ToString(r.Code) != "ConditionalCheckFailed" {
+				continue
+			}
+			if t.checks[i].create {
+				return false, depot.ErrEntityAlreadyExists
+			}
+			return false, t.checks[i].failed(r.Item)
+		}
+	}
+	if err != nil {
+		return
+	}
+	for _, c := range t.checks {
+		if err = c.bump(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// expect adds the check that the item r read is unchanged to the write of the
+// same item, or as a condition check of its own when there is none, since a
+// transaction may not name an item twice.
+func (t *transaction) expect(r *read) {
+	for i, item := range t.items {
+		var (
+			exp    **string
+			names  *map[string]string
+			values *map[string]types.AttributeValue
+		)
+		switch {
+		case item.Put != nil && r.is(item.Put.TableName, item.Put.Item):
+			exp, names, values = &item.Put.ConditionExpression, &item.Put.ExpressionAttributeNames, &item.Put.ExpressionAttributeValues
+			item.Put.ReturnValuesOnConditionCheckFailure = types.ReturnValuesOnConditionCheckFailureAllOld
+		case item.Update != nil && r.is(item.Update.TableName, item.Update.Key):
+			exp, names, values = &item.Update.ConditionExpression, &item.Update.ExpressionAttributeNames, &item.Update.ExpressionAttributeValues
+		case item.Delete != nil && r.is(item.Delete.TableName, item.Delete.Key):
+			exp, names, values = &item.Delete.ConditionExpression, &item.Delete.ExpressionAttributeNames, &item.Delete.ExpressionAttributeValues
+		case item.ConditionCheck != nil && r.is(item.ConditionCheck.TableName, item.ConditionCheck.Key):
+			exp, names, values = &item.ConditionCheck.ConditionExpression, &item.ConditionCheck.ExpressionAttributeNames, &item.ConditionCheck.ExpressionAttributeValues
+		default:
+			continue
+		}
+		*exp, *names, *values = expectRead(*exp, *names, *values, r)
+		t.checks[i].read = r
+		return
+	}
+	exp, names, values := expectRead(nil, nil, nil, r)
+	t.add(types.TransactWriteItem{ConditionCheck: &types.ConditionCheck{
+		TableName:                           aws.String(r.table),
+		Key:                                 r.key,
+		ConditionExpression:                 exp,
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           values,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}}, check{read: r})
+}
+
+// read is an item a transaction read: whether it was found and the values it
+// held at the paths read, or only its version when it has one.
+type read struct {
+	table  string
+	key    map[string]types.AttributeValue
+	found  bool
+	values map[string]types.AttributeValue
+}
+
+// newRead records item, read for entity with the projection paths, or in
+// full when there are none.
+func newRead(table string, key, item map[string]types.AttributeValue, paths []string, entity interface{}) (r read) {
+	r = read{table: table, key: key, found: len(item) > 0, values: make(map[string]types.AttributeValue)}
+	if !r.found {
+		return
+	}
+	if v, ok, err := depot.EntityVersion(entity); err == nil && ok && item[v.Name] != nil {
+		r.values[v.Name] = item[v.Name]
+		return
+	}
+	if paths == nil {
+		for name := range item {
+			paths = append(paths, name)
+		}
+	}
+	for _, path := range paths {
+		r.values[path] = pathValue(item, path)
+	}
+	return
+}
+
+// is reports whether the item in table with the attributes item is the one
+// read.
+func (r *read) is(table *string, item map[string]types.AttributeValue) bool {
+	if aws.ToString(table) != r.table {
+		return false
+	}
+	for name, av := range r.key {
+		if !reflect.DeepEqual(item[name], av) {
+			return false
+		}
+	}
+	return true
+}
+
+// changed reports whether item, as stored now, differs from what was read.
+func (r *read) changed(item map[string]types.AttributeValue) bool {
+	if !r.found || len(item) == 0 {
+		return r.found != (len(item) > 0)
+	}
+	for path, av := range r.values {
+		if !reflect.DeepEqual(pathValue(item, path), av) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathValue returns the value at the attribute or dotted document path of
+// item, or nil when it has none.
+func pathValue(item map[string]types.AttributeValue, path string) (av types.AttributeValue) {
+	m := item
+	for _, name := range depot.PathParts(path) {
+		if m == nil {
+			return nil
+		}
+		if av = m[name]; av == nil {
+			return nil
+		}
+		m = nil
+		if mv, ok := av.(*types.AttributeValueMemberM); ok {
+			m = mv.Value
+		}
+	}
+	return
+}
+
+// check holds what the condition of a write guards: that the item is new, the
+// conditions passed to it, the version of its entity and, for a put, the
+// created time it keeps. It turns a failed condition check into the matching
+// depot error and sets the version and timestamps written, and clears the
+// fields removed, on the entity once the write succeeds.
+type check struct {
+	create     bool
+	conditions []depot.EntityCondition
+	entity     interface{}
+	version    *depot.Version
+	stamps     *depot.Timestamps
+	removed    []string
+	extrema    []depot.Update
+	read       *read
+}
+
+func newCheck(entity interface{}, op []depot.Condition) (c check, err error) {
+	var (
+		v         depot.Version
+		versioned bool
+	)
+	if c.conditions, err = depot.EntityPreconditions(entity, op); err != nil {
+		return
+	}
+	if v, versioned, err = depot.EntityVersion(entity); err != nil {
+		return
+	}
+	c.entity = entity
+	if versioned {
+		c.version = &v
+	}
+	return
+}
+
+// entityTimestamps returns the timestamps of entity, or nil when it has none.
+func entityTimestamps(entity interface{}) (*depot.Timestamps, error) {
+	ts, err := depot.EntityTimestamps(entity)
+	if err != nil || !ts.Stamped() {
+		return nil, err
+	}
+	return &ts, nil
+}
+
+// expression compiles the conditions, the expected version and the kept
+// created time into a ConditionExpression and the attribute names and values
+// it refers to.
+func (c check) expression() (exp *string, names map[string]string, values map[string]types.AttributeValue, err error) {
+	if exp, names, values, err = preconditionExpression(c.conditions); err != nil {
+		return
+	}
+	if c.version != nil {
+		exp, names, values = expectVersion(exp, names, values, *c.version)
+	}
+	if c.stamps != nil && c.stamps.Created != "" && !c.create {
+		exp, names, values, err = expectCreated(exp, names, values, c.stamps.Created, c.stamps.CreatedAt)
+	}
+	return
+}
+
+// write stores the next version and the timestamps in item.
+func (c check) write(item map[string]types.AttributeValue) (err error) {
+	if c.version != nil {
+		if item[c.version.Name], err = attributevalue.Marshal(c.version.Next()); err != nil {
+			return
+		}
+	}
+	if c.stamps == nil {
+		return
+	}
+	for _, u := range c.stamps.Updates() {
+		if item[u.Name], err = attributevalue.Marshal(u.Value); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// bump sets the version and timestamps written, and clears the fields removed,
+// on the entity.
+func (c check) bump() (err error) {
+	if c.entity == nil {
+		return
+	}
+	if len(c.removed) > 0 {
+		if err = depot.ClearFields(c.entity, c.removed...); err != nil {
+			return
+		}
+	}
+	if c.stamps != nil {
+		if err = c.stamps.Set(c.entity); err != nil {
+			return
+		}
+	}
+	if c.version == nil {
+		return
+	}
+	return depot.SetEntityVersion(c.entity, c.version.Next())
+}
+
+// error turns a failed condition check into the matching depot error and
+// passes any other error through.
+func (c check) error(err error) error {
+	var ccf *types.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return c.failed(ccf.Item)
+	}
+	return err
+}
+
+// failed names what item, the stored item returned with a failed condition
+// check, does not satisfy.
+func (c check) failed(item map[string]types.AttributeValue) error {
+	existing := storedItem(item)
+	if err := c.verify(existing); err != nil {
+		return err
+	}
+	return &depot.ConditionError{Fields: c.outdone(existing)}
+}
+
+// outdone names the Max and Min fields whose stored values existing already
+// outdoes. Values are compared as DynamoDB stores them, so that times compare
+// as the strings the condition expression sees.
+func (c check) outdone(existing map[string]interface{}) (fields []string) {
+	if existing == nil {
+		return
+	}
+	for _, u := range c.extrema {
+		var v interface{}
+		av, err := attributevalue.Marshal(u.Value)
+		if err == nil {
+			err = attributevalue.Unmarshal(av, &v)
+		}
+		if err == nil && !depot.UpdateApplies(depot.Update{Name: u.Name, Op: u.Op, Value: v}, depot.StoredValue(existing, u.Name)) {
+			fields = append(fields, u.Name)
+		}
+	}
+	return
+}
+
+// outdoneBy returns the Max and Min fields that failed an update with err when
+// nothing else about the stored item did.
+func (c check) outdoneBy(err error) []string {
+	var ccf *types.ConditionalCheckFailedException
+	if len(c.extrema) == 0 || !errors.As(err, &ccf) {
+		return nil
+	}
+	existing := storedItem(ccf.Item)
+	if c.verify(existing) != nil {
+		return nil
+	}
+	return c.outdone(existing)
+}
+
+// verify checks the version and conditions against the stored fields.
+func (c check) verify(existing map[string]interface{}) error {
+	if c.version != nil {
+		if err := depot.CheckVersion(*c.version, existing); err != nil {
+			return err
+		}
+	}
+	return depot.CheckConditions(c.conditions, existing)
+}
+
+// restamp reports whether err failed a put only because the stored created
+// time differs from the one written, and takes up the stored one for a retry.
+func (c check) restamp(err error) bool {
+	var ccf *types.ConditionalCheckFailedException
+	if c.stamps == nil || c.stamps.Created == "" || !errors.As(err, &ccf) || len(ccf.Item) == 0 {
+		return false
+	}
+	existing := storedItem(ccf.Item)
+	if c.verify(existing) != nil {
+		return false
+	}
+	t, ok := depot.StoredTime(existing[c.stamps.Created])
+	if !ok || t.Equal(c.stamps.CreatedAt) {
+		return false
+	}
+	c.stamps.CreatedAt = t
+	return true
+}
+
+// storedItem unmarshals a stored item, returning nil when there is none.
+func storedItem(item map[string]types.AttributeValue) (existing map[string]interface{}) {
+	if len(item) > 0 && attributevalue.UnmarshalMapWithOptions(item, &existing, decoderOptions) != nil {
+		existing = nil
+	}
+	return
+}
+
+func keyMap(k depot.Key) (m map[string]interface{}) {
+	m = make(map[string]interface{})
+	m[k.Partition.Name] = k.Partition.Value
+	if k.Sort.Name != "" {
+		m[k.Sort.Name] = k.Sort.Value
+	}
+	return
+}
+
+func keyFromEntity(entity interface{}) (key map[string]types.AttributeValue, err error) {
+	var k depot.Key
+	if k, err = depot.EntityKey(entity); err != nil {
+		return
+	}
+	key, err = attributevalue.MarshalMap(keyMap(k))
+	return
+}
+
+func marshalEntity(entity interface{}) (map[string]types.AttributeValue, error) {
+	return attributevalue.MarshalMapWithOptions(entity, encoderOptions)
+}
+
+func unmarshalEntity(item map[string]types.AttributeValue, entity interface{}) (err error) {
+	v := reflect.ValueOf(entity)
+	if len(item) > 0 && v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct {
+		return attributevalue.UnmarshalMapWithOptions(item, entity, decoderOptions)
+	}
+	return
+}
+
+func unmarshalEntities(items []map[string]types.AttributeValue, entities interface{}) (err error) {
+	return attributevalue.UnmarshalListOfMapsWithOptions(items, entities, decoderOptions)
+}
+
+func updateExpressionParts(updates []depot.Update) (set, add, remove, del []string) {
+	for _, u := range updates {
+		n, v := attributeName(u.Name), attributeValue(u.Name)
+		switch u.Op.(type) {
+		case *depot.AddUpdateOp:
+			add = append(add, fmt.Sprintf("%s %s", n, v))
+		case *depot.SubtractUpdateOp:
+			add = append(add, fmt.Sprintf("%s %s", n, v))
+		case *depot.RemoveUpdateOp:
+			remove = append(remove, n)
+		case *depot.AppendUpdateOp:
+			set = append(set, fmt.Sprintf("%s = list_append(if_not_exists(%s, %s_empty), %s)", n, n, v, v))
+		case *depot.PrependUpdateOp:
+			set = append(set, fmt.Sprintf("%s = list_append(%s, if_not_exists(%s, %s_empty))", n, v, n, v))
+		case *depot.AddToSetUpdateOp:
+			add = append(add, fmt.Sprintf("%s %s", n, v))
+		case *depot.RemoveFromSetUpdateOp:
+			del = append(del, fmt.Sprintf("%s %s", n, v))
+		case *depot.SetIfAbsentUpdateOp:
+			set = append(set, fmt.Sprintf("%s = if_not_exists(%s, %s)", n, n, v))
+		case depot.Condition:
+			// condition fields are only checked, never written
+		default:
+			set = append(set, fmt.Sprintf("%s = %s", n, v))
+		}
+	}
+	return
+}
+
+// expression collects the attribute names and values that condition
+// expressions refer to. Each condition gets value placeholders of its own, so
+// that several conditions may compare the same field.
+type expression struct {
+	names  map[string]string
+	values map[string]types.AttributeValue
+}
+
+// query compiles the conditions on key attributes into a key condition
+// expression and the others into a filter expression. A query may not filter
+// on key attributes, so a key condition that a key condition expression cannot
+// hold, such as a NotIn, moves all of them to the filter of a scan. Query runs
+// an In on the sort key as one query per value instead, through queryIn.
+func (e expression) query(conditions []depot.EntityCondition) (keyExp, filterExp *string, err error) {
+	var (
+		keyParts    []string
+		filterParts []string
+		part        string
+		scan        bool
+	)
+	for _, c := range conditions {
+		if part, err = e.condition(c); err != nil {
+			return
+		}
+		if c.KeyType == depot.KeyTypeNone {
+			filterParts = append(filterParts, part)
+		} else {
+			keyParts = append(keyParts, part)
+			scan = scan || !keyCondition(c)
+		}
+	}
+	if scan {
+		filterParts, keyParts = append(keyParts, filterParts...), nil
+	}
+	if len(keyParts) > 0 {
+		keyExp = aws.String(strings.Join(keyParts, " AND "))
+	}
+	if len(filterParts) > 0 {
+		filterExp = aws.String(strings.Join(filterParts, " AND "))
+	}
+	return
+}
+
+// keyCondition reports whether a key condition expression can hold c: an
+// equality, or a range or prefix on the sort key.
+func keyCondition(c depot.EntityCondition) bool {
+	switch c.Op.(type) {
+	case nil, *depot.EqualCondition:
+		return true
+	case *depot.LTCondition, *depot.LTECondition, *depot.GTCondition, *depot.GTECondition,
+		*depot.BeginsWithCondition, *depot.BetweenCondition:
+		return c.KeyType == depot.KeyTypeSort
+	}
+	return false
+}
+
+// conditions compiles the conditions into a single condition expression.
+func (e expression) conditions(conditions []depot.EntityCondition) (exp *string, err error) {
+	var (
+		parts []string
+		part  string
+	)
+	for _, c := range conditions {
+		if part, err = e.condition(c); err != nil {
+			return
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) > 0 {
+		exp = aws.String(strings.Join(parts, " AND "))
+	}
+	return
+}
+
+// condition compiles c, parenthesizing the conditions an Or or And combines.
+func (e expression) condition(c depot.EntityCondition) (part string, err error) {
+	switch c.Op.(type) {
+	case *depot.OrCondition, *depot.AndCondition:
+		sep := " AND "
+		if _, ok := c.Op.(*depot.OrCondition); ok {
+			sep = " OR "
+		}
+		parts := make([]string, len(c.Conditions))
+		for i, sub := range c.Conditions {
+			if parts[i], err = e.condition(sub); err != nil {
+				return
+			}
+		}
+		return "(" + strings.Join(parts, sep) + ")", nil
+	case *depot.NotCondition:
+		if part, err = e.condition(c.Conditions[0]); err != nil {
+			return
+		}
+		return "NOT " + part, nil
+	case *depot.ContainsCondition:
+		// A list is contained when each of its elements is.
+		if list := depot.ListValues(c.Value); list != nil {
+			if len(list) == 0 {
+				addNames(e.names, c.Name)
+				return fmt.Sprintf("attribute_exists(%s)", attributeName(c.Name)), nil
+			}
+			and := depot.EntityCondition{Op: depot.And()}
+			for _, v := range list {
+				and.Conditions = append(and.Conditions, depot.EntityCondition{Name: c.Name, Value: v, Op: c.Op})
+			}
+			return e.condition(and)
+		}
+	}
+	addNames(e.names, c.Name)
+	key := e.valueKey(c.Name)
+	if err = conditionValues(e.values, key, c.Op, c.Value); err != nil {
+		return
+	}
+	return conditionPart(c.Name, key, c.Op), nil
+}
+
+// valueKey returns the value placeholder of name, numbered apart from those
+// already taken.
+func (e expression) valueKey(name string) string {
+	key := attributeValue(name)
+	for i := 2; e.taken(key); i++ {
+		key = fmt.Sprintf("%s_%d", attributeValue(name), i)
+	}
+	return key
+}
+
+func (e expression) taken(key string) bool {
+	_, value := e.values[key]
+	_, list := e.values[key+"_0"]
+	return value || list
+}
+
+func conditionPart(name, key string, op depot.Condition) string {
+	n, v := attributeName(name), key
+	switch c := op.(type) {
+	case *depot.NotEqualCondition:
+		return fmt.Sprintf("%s <> %s", n, v)
+	case *depot.LTCondition:
+		return fmt.Sprintf("%s < %s", n, v)
+	case *depot.LTECondition:
+		return fmt.Sprintf("%s <= %s", n, v)
+	case *depot.GTCondition:
+		return fmt.Sprintf("%s > %s", n, v)
+	case *depot.GTECondition:
+		return fmt.Sprintf("%s >= %s", n, v)
+	case *depot.ExistsCondition:
+		return fmt.Sprintf("attribute_exists(%s)", n)
+	case *depot.BeginsWithCondition:
+		return fmt.Sprintf("begins_with(%s, %s)", n, v)
+	case *depot.ContainsCondition:
+		return fmt.Sprintf("contains(%s, %s)", n, v)
+	case *depot.InCondition:
+		return inExpression(name, key, len(c.List()))
+	case *depot.NotInCondition:
+		return fmt.Sprintf("NOT (%s)", inExpression(name, key, len(c.List())))
+	case *depot.BetweenCondition:
+		return fmt.Sprintf("%s BETWEEN %s_0 AND %s_1", n, v, v)
+	default:
+		return fmt.Sprintf("%s = %s", n, v)
+	}
+}
+
+// attributeName returns the placeholder of the attribute or dotted document
+// path name, which takes a name placeholder for each element of the path.
+func attributeName(name string) string {
+	parts := depot.PathParts(name)
+	for i, p := range parts {
+		parts[i] = "#" + placeholder(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// addNames adds the names that the placeholder of name refers to.
+func addNames(names map[string]string, name string) {
+	for _, p := range depot.PathParts(name) {
+		names["#"+placeholder(p)] = p
+	}
+}
+
+// attributeValue returns the placeholder of the value of name.
+func attributeValue(name string) string {
+	return ":" + placeholder(name)
+}
+
+// placeholder replaces the characters of name that a placeholder may not hold.
+func placeholder(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// preconditionExpression compiles the conditions of a Put or Delete into a
+// ConditionExpression and the attribute names and values it refers to.
+func preconditionExpression(conditions []depot.EntityCondition) (exp *string, names map[string]string, values map[string]types.AttributeValue, err error) {
+	if len(conditions) == 0 {
+		return
+	}
+	names = make(map[string]string)
+	values = make(map[string]types.AttributeValue)
+	if exp, err = (expression{names, values}).conditions(conditions); err != nil {
+		return
+	}
+	if len(values) == 0 {
+		values = nil
+	}
+	return
+}
+
+// expectVersion adds the check that the stored version equals v, where a
+// missing version counts as 0, to the condition expression exp.
+func expectVersion(exp *string, names map[string]string, values map[string]types.AttributeValue, v depot.Version) (*string, map[string]string, map[string]types.AttributeValue) {
+	if names == nil {
+		names = make(map[string]string)
+	}
+	if values == nil {
+		values = make(map[string]types.AttributeValue)
+	}
+	p := placeholder(v.Name)
+	names["#"+p] = v.Name
+	values[":"+p] = &types.AttributeValueMemberN{Value: strconv.FormatInt(v.Value, 10)}
+	part := fmt.Sprintf("#%s = :%s", p, p)
+	if v.Value == 0 {
+		part = fmt.Sprintf("(attribute_not_exists(#%s) OR %s)", p, part)
+	}
+	if exp != nil {
+		part = *exp + " AND " + part
+	}
+	return aws.String(part), names, values
+}
+
+// extremeUpdates returns the Max and Min updates.
+func extremeUpdates(updates []depot.Update) (extrema []depot.Update) {
+	for _, u := range updates {
+		switch u.Op.(type) {
+		case *depot.MaxUpdateOp, *depot.MinUpdateOp:
+			extrema = append(extrema, u)
+		}
+	}
+	return
+}
+
+// expectRead adds the check that the item r read is unchanged to the condition
+// expression exp: that it is still missing, or that the paths read still hold
+// the values read. Its values are named apart from those of the write's own
+// conditions.
+func expectRead(exp *string, names map[string]string, values map[string]types.AttributeValue, r *read) (*string, map[string]string, map[string]types.AttributeValue) {
+	var parts []string
+	if names == nil {
+		names = make(map[string]string)
+	}
+	if !r.found {
+		keys := make([]string, 0, len(r.key))
+		for name := range r.key {
+			keys = append(keys, name)
+		}
+		slices.Sort(keys)
+		addNames(names, keys[0])
+		parts = append(parts, fmt.Sprintf("attribute_not_exists(%s)", attributeName(keys[0])))
+	} else {
+		if values == nil {
+			values = make(map[string]types.AttributeValue)
+		}
+		paths := make([]string, 0, len(r.values))
+		for path := range r.values {
+			paths = append(paths, path)
+		}
+		slices.Sort(paths)
+		for _, path := range paths {
+			addNames(names, path)
+			if r.values[path] == nil {
+				parts = append(parts, fmt.Sprintf("attribute_not_exists(%s)", attributeName(path)))
+				continue
+			}
+			key := attributeValue(path) + "_read"
+			values[key] = r.values[path]
+			parts = append(parts, fmt.Sprintf("%s = %s", attributeName(path), key))
+		}
+	}
+	if len(values) == 0 {
+		values = nil
+	}
+	part := strings.Join(parts, " AND ")
+	if exp != nil {
+		part = *exp + " AND " + part
+	}
+	return aws.String(part), names, values
+}
+
+// expectOutdone adds the check that the Max or Min update u outdoes the stored
+// value, if any, to the condition expression exp.
+func expectOutdone(exp *string, u depot.Update) *string {
+	cmp := "<"
+	if _, ok := u.Op.(*depot.MinUpdateOp); ok {
+		cmp = ">"
+	}
+	n := attributeName(u.Name)
+	part := fmt.Sprintf("(attribute_not_exists(%s) OR %s %s %s)", n, n, cmp, attributeValue(u.Name))
+	if exp != nil {
+		part = *exp + " AND " + part
+	}
+	return aws.String(part)
+}
+
+// expectCreated adds the check that the stored created time, if any, equals t
+// to the condition expression exp. Its value is named apart from the field's
+// so that it cannot clash with a condition on it.
+func expectCreated(exp *string, names map[string]string, values map[string]types.AttributeValue, name string, t time.Time) (*string, map[string]string, map[string]types.AttributeValue, error) {
+	av, err := attributevalue.Marshal(t)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if names == nil {
+		names = make(map[string]string)
+	}
+	if values == nil {
+		values = make(map[string]types.AttributeValue)
+	}
+	p := placeholder(name)
+	names["#"+p] = name
+	values[":"+p+"_stored"] = av
+	part := fmt.Sprintf("(attribute_not_exists(#%s) OR #%s = :%s_stored)", p, p, p)
+	if exp != nil {
+		part = *exp + " AND " + part
+	}
+	return aws.String(part), names, values, nil
+}
+
+func queryDirectives(ops []depot.QueryOp, sortField string) (limit *int32, page map[string]types.AttributeValue, asc *bool, err error) {
+	for _, op := range ops {
+		if d, ok := op.(depot.QueryDirective); ok {
+			switch v := d.(type) {
+			case *depot.LimitQueryDirective:
+				limit = aws.Int32(int32(v.Limit))
+			case *depot.PageQueryDirective:
+				if page, err = DecodePage(v.Page); err != nil {
+					return
+				}
+			case *depot.AscQueryDirective:
+				if sortField == "" {
+					return nil, nil, nil, depot.ErrNoSortField
+				}
+				asc = aws.Bool(true)
+			case *depot.DescQueryDirective:
+				if sortField == "" {
+					return nil, nil, nil, depot.ErrNoSortField
+				}
+				asc = aws.Bool(false)
+			}
+		}
+	}
+	return
+}
+
+// DecodePage turns a page token made by EncodePage back into the
+// LastEvaluatedKey it was made from.
+func DecodePage(encoded string) (decoded map[string]types.AttributeValue, err error) {
+	if encoded == "" {
+		return
+	}
+	var (
+		bytes []byte
+		m     = make(map[string]map[string]string)
+	)
+	decoded = make(map[string]types.AttributeValue)
+	if bytes, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+		return nil, depot.ErrInvalidPage
+	}
+	if err = json.Unmarshal(bytes, &m); err != nil {
+		return nil, depot.ErrInvalidPage
+	}
 	for k, v := range m {
+		if len(v) != 1 {
+			return nil, depot.ErrInvalidPage
+		}
 		for kk, vv := range v {
 			switch kk {
 			case "S":
 				decoded[k] = &types.AttributeValueMemberS{Value: vv}
 			case "N":
 				decoded[k] = &types.AttributeValueMemberN{Value: vv}
+			case "B":
+				var b []byte
+				if b, err = base64.StdEncoding.DecodeString(vv); err != nil {
+					return nil, depot.ErrInvalidPage
+				}
+				decoded[k] = &types.AttributeValueMemberB{Value: b}
+			default:
+				return nil, depot.ErrInvalidPage
 			}
 		}
 	}
-
 	return
-
 }
 
+// EncodePage turns a LastEvaluatedKey into a page token. Key attributes can
+// only be strings, numbers or binary, so any other type is an error.
 func EncodePage(decoded map[string]types.AttributeValue) (encoded string, err error) {
 	if decoded == nil {
 		return "", nil
@@ -420,6 +1954,10 @@ func EncodePage(decoded map[string]types.AttributeValue) (encoded string, err er
 			m[k] = map[string]string{"S": vv.Value}
 		case *types.AttributeValueMemberN:
 			m[k] = map[string]string{"N": vv.Value}
+		case *types.AttributeValueMemberB:
+			m[k] = map[string]string{"B": base64.StdEncoding.EncodeToString(vv.Value)}
+		default:
+			return "", fmt.Errorf("%w: %s is %T", ErrUnsupportedPageKey, k, v)
 		}
 	}
 	if bytes, err = json.Marshal(m); err != nil {
@@ -432,6 +1970,8 @@ func EncodePage(decoded map[string]types.AttributeValue) (encoded string, err er
 func updateValue(u depot.Update) (av types.AttributeValue, err error) {
 	var v interface{}
 	switch u.Op.(type) {
+	case *depot.AddToSetUpdateOp, *depot.RemoveFromSetUpdateOp:
+		return setValue(u.Value)
 	case *depot.SubtractUpdateOp:
 		v = depot.NegateValue(u.Value)
 	case *depot.AddUpdateOp:
@@ -443,18 +1983,83 @@ func updateValue(u depot.Update) (av types.AttributeValue, err error) {
 	return
 }
 
-func conditionValue(c depot.EntityCondition) (av types.AttributeValue, err error) {
-	// var v interface{}
-	// switch c.Op.Type {
-	// case depot.TypeSubtract:
-	// 	v = depot.NegateValue(c.Value)
-	// default:
-	// 	v = c.Value
-	// }
-	av, err = attributevalue.Marshal(c.Value)
+// setValue marshals the slice v as a string, number or binary set.
+func setValue(v interface{}) (av types.AttributeValue, err error) {
+	var (
+		ss, ns []string
+		bs     [][]byte
+		ev     types.AttributeValue
+	)
+	for _, e := range depot.ListValues(v) {
+		if ev, err = attributevalue.Marshal(e); err != nil {
+			return
+		}
+		switch m := ev.(type) {
+		case *types.AttributeValueMemberS:
+			ss = append(ss, m.Value)
+		case *types.AttributeValueMemberN:
+			ns = append(ns, m.Value)
+		case *types.AttributeValueMemberB:
+			bs = append(bs, m.Value)
+		default:
+			return nil, depot.ErrInvalidTransform
+		}
+	}
+	switch {
+	case len(ss) > 0 && len(ns) == 0 && len(bs) == 0:
+		return &types.AttributeValueMemberSS{Value: ss}, nil
+	case len(ns) > 0 && len(ss) == 0 && len(bs) == 0:
+		return &types.AttributeValueMemberNS{Value: ns}, nil
+	case len(bs) > 0 && len(ss) == 0 && len(ns) == 0:
+		return &types.AttributeValueMemberBS{Value: bs}, nil
+	default:
+		return nil, depot.ErrInvalidTransform
+	}
+}
+
+// conditionValues stores the value or list of values op compares under the
+// placeholder key.
+func conditionValues(values map[string]types.AttributeValue, key string, op depot.Condition, value interface{}) (err error) {
+	var av types.AttributeValue
+	switch c := op.(type) {
+	case *depot.InCondition:
+		return listValues(values, key, c.List())
+	case *depot.NotInCondition:
+		return listValues(values, key, c.List())
+	case *depot.BetweenCondition:
+		return listValues(values, key, []interface{}{c.From(), c.To()})
+	case *depot.ExistsCondition:
+		return
+	}
+	if value == nil {
+		return
+	}
+	if av, err = attributevalue.Marshal(value); err != nil {
+		return
+	}
+	values[key] = av
 	return
 }
 
+func listValues(values map[string]types.AttributeValue, key string, list []interface{}) (err error) {
+	var av types.AttributeValue
+	for i, v := range list {
+		if av, err = attributevalue.Marshal(v); err != nil {
+			return
+		}
+		values[fmt.Sprintf("%s_%d", key, i)] = av
+	}
+	return
+}
+
+func inExpression(name, key string, n int) string {
+	placeholders := make([]string, n)
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("%s_%d", key, i)
+	}
+	return fmt.Sprintf("%s IN (%s)", attributeName(name), strings.Join(placeholders, ", "))
+}
+
 func errorIsConditionCheckFailure(err error) bool {
 	var conditionCheckFailure *types.ConditionalCheckFailedException
 	return errors.As(err, &conditionCheckFailure)
@@ -1,8 +1,12 @@
 package dynamo
 
 import (
+	"context"
+	"encoding/base64"
 	"testing"
+	"time"
 
+	"github.com/andyday/depot"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/stretchr/testify/assert"
 )
@@ -19,3 +23,633 @@ func TestEncodePage(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, expected, decoded)
 }
+
+func TestEncodePageBinary(t *testing.T) {
+	expected := map[string]types.AttributeValue{
+		"hash": &types.AttributeValueMemberB{Value: []byte{0x00, 0xff, 0x10}},
+		"id":   &types.AttributeValueMemberS{Value: "s1"},
+	}
+	encoded, err := EncodePage(expected)
+	assert.NoError(t, err)
+
+	decoded, err := DecodePage(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, decoded)
+}
+
+func TestEncodePageUnsupported(t *testing.T) {
+	_, err := EncodePage(map[string]types.AttributeValue{
+		"a1": &types.AttributeValueMemberBOOL{Value: true},
+	})
+	assert.ErrorIs(t, err, ErrUnsupportedPageKey)
+
+	encoded, err := EncodePage(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, encoded)
+}
+
+func TestDecodePageInvalid(t *testing.T) {
+	for _, page := range []string{
+		"!",
+		base64.RawURLEncoding.EncodeToString([]byte("[]")),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"a":{"BOOL":"true"}}`)),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"a":{"S":"x","N":"1"}}`)),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"a":{"B":"!"}}`)),
+	} {
+		_, err := DecodePage(page)
+		assert.ErrorIs(t, err, depot.ErrInvalidPage, page)
+	}
+}
+
+func TestChunks(t *testing.T) {
+	assert.Nil(t, chunks([]int(nil), 2))
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}, {5}}, chunks([]int{1, 2, 3, 4, 5}, 2))
+	assert.Equal(t, [][]int{{1, 2}}, chunks([]int{1, 2}, 2))
+}
+
+func TestRetryBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(t, retryBackoff(ctx, 0))
+	assert.ErrorIs(t, retryBackoff(ctx, batchRetries+1), ErrUnprocessedItems)
+	cancel()
+	assert.ErrorIs(t, retryBackoff(ctx, 1), context.Canceled)
+}
+
+func TestPreconditionExpression(t *testing.T) {
+	type widget struct {
+		TenantID string `depot:"tenantId,pk"`
+		ID       string `depot:"id,sk"`
+		Version  int64  `depot:"version"`
+		Status   string `depot:"status"`
+	}
+	conditions, err := depot.EntityPreconditions(&widget{TenantID: "t", ID: "i", Version: 2},
+		[]depot.Condition{depot.Exists("id"), depot.Equal("version"), depot.In("status", "a", "b")})
+	assert.NoError(t, err)
+	exp, names, values, err := preconditionExpression(conditions)
+	assert.NoError(t, err)
+	assert.Equal(t, "attribute_exists(#id) AND #version = :version AND #status IN (:status_0, :status_1)", *exp)
+	assert.Equal(t, map[string]string{"#id": "id", "#version": "version", "#status": "status"}, names)
+	assert.Equal(t, map[string]types.AttributeValue{
+		":version":  &types.AttributeValueMemberN{Value: "2"},
+		":status_0": &types.AttributeValueMemberS{Value: "a"},
+		":status_1": &types.AttributeValueMemberS{Value: "b"},
+	}, values)
+
+	exp, names, values, err = preconditionExpression([]depot.EntityCondition{{Name: "id", Op: depot.Exists("id")}})
+	assert.NoError(t, err)
+	assert.Equal(t, "attribute_exists(#id)", *exp)
+	assert.Equal(t, map[string]string{"#id": "id"}, names)
+	assert.Nil(t, values)
+
+	exp, names, values, err = preconditionExpression(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, exp)
+	assert.Nil(t, names)
+	assert.Nil(t, values)
+}
+
+func TestUpdateItemInputConditions(t *testing.T) {
+	type widget struct {
+		TenantID string `depot:"tenantId,pk"`
+		ID       string `depot:"id,sk"`
+		Name     string `depot:"name"`
+		Version  int64  `depot:"version"`
+		Count    int64  `depot:"count"`
+	}
+	in, c, err := updateItemInput("widgets", &widget{TenantID: "t", ID: "i", Name: "n", Version: 2, Count: 1},
+		[]depot.UpdateOp{depot.Equal("version"), depot.LessThan("count")}, depot.Now(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "#version = :version AND #count < :count", *in.ConditionExpression)
+	assert.Equal(t, "SET #name = :name", *in.UpdateExpression)
+	if assert.Len(t, c.conditions, 2) {
+		assert.Equal(t, "version", c.conditions[0].Name)
+		assert.Equal(t, "count", c.conditions[1].Name)
+	}
+	assert.Nil(t, c.version)
+}
+
+type draft struct {
+	TenantID string `depot:"tenantId,pk"`
+	ID       string `depot:"id,sk"`
+	Body     string `depot:"body"`
+	Version  int64  `depot:"version,version"`
+}
+
+func TestUpdateItemInputVersion(t *testing.T) {
+	d := &draft{TenantID: "t", ID: "i", Body: "b", Version: 3}
+	in, c, err := updateItemInput("drafts", d, nil, depot.Now(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "#version = :version", *in.ConditionExpression)
+	assert.Equal(t, "SET #body = :body, #version = :version_next", *in.UpdateExpression)
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "3"}, in.ExpressionAttributeValues[":version"])
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "4"}, in.ExpressionAttributeValues[":version_next"])
+
+	assert.NoError(t, c.bump())
+	assert.Equal(t, int64(4), d.Version)
+}
+
+func TestCheckExpressionVersion(t *testing.T) {
+	c, err := newCheck(&draft{TenantID: "t", ID: "i"}, []depot.Condition{depot.Exists("id")})
+	assert.NoError(t, err)
+	exp, names, values, err := c.expression()
+	assert.NoError(t, err)
+	assert.Equal(t, "attribute_exists(#id) AND (attribute_not_exists(#version) OR #version = :version)", *exp)
+	assert.Equal(t, map[string]string{"#id": "id", "#version": "version"}, names)
+	assert.Equal(t, map[string]types.AttributeValue{":version": &types.AttributeValueMemberN{Value: "0"}}, values)
+
+	item := map[string]types.AttributeValue{}
+	assert.NoError(t, c.write(item))
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "1"}, item["version"])
+}
+
+func TestExpectPlaceholders(t *testing.T) {
+	exp, names, values := expectVersion(nil, nil, nil, depot.Version{Name: "row-version", Value: 2})
+	assert.Equal(t, "#row_version = :row_version", *exp)
+	assert.Equal(t, map[string]string{"#row_version": "row-version"}, names)
+	assert.Equal(t, map[string]types.AttributeValue{":row_version": &types.AttributeValueMemberN{Value: "2"}}, values)
+
+	exp, names, values, err := expectCreated(exp, names, values, "created.at", time.Unix(0, 0).UTC())
+	assert.NoError(t, err)
+	assert.Equal(t, "#row_version = :row_version AND (attribute_not_exists(#created_at) OR #created_at = :created_at_stored)", *exp)
+	assert.Equal(t, "created.at", names["#created_at"])
+	assert.Contains(t, values, ":created_at_stored")
+}
+
+func TestCheckError(t *testing.T) {
+	c := check{conditions: []depot.EntityCondition{
+		{Name: "version", Value: int64(2), Op: depot.Equal("version")},
+		{Name: "status", Value: "active", Op: depot.Equal("status")},
+	}}
+	var ce *depot.ConditionError
+
+	err := c.error(&types.ConditionalCheckFailedException{Item: map[string]types.AttributeValue{
+		"version": &types.AttributeValueMemberN{Value: "3"},
+		"status":  &types.AttributeValueMemberS{Value: "active"},
+	}})
+	assert.ErrorIs(t, err, depot.ErrConditionFailed)
+	if assert.ErrorAs(t, err, &ce) {
+		assert.Equal(t, []string{"version"}, ce.Fields)
+	}
+
+	// Without the stored item every condition has failed.
+	err = c.error(&types.ConditionalCheckFailedException{})
+	if assert.ErrorAs(t, err, &ce) {
+		assert.Equal(t, []string{"version", "status"}, ce.Fields)
+	}
+
+	assert.ErrorIs(t, c.error(context.Canceled), context.Canceled)
+
+	c, err = newCheck(&draft{TenantID: "t", ID: "i", Version: 1}, nil)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, c.error(&types.ConditionalCheckFailedException{Item: map[string]types.AttributeValue{
+		"version": &types.AttributeValueMemberN{Value: "2"},
+	}}), depot.ErrVersionConflict)
+}
+
+func TestTransactionReads(t *testing.T) {
+	type message struct {
+		TenantID string                 `depot:"tenantId,pk"`
+		ID       string                 `depot:"id,sk"`
+		Body     string                 `depot:"body"`
+		Data     map[string]interface{} `depot:"data"`
+	}
+	key := func(id string) map[string]types.AttributeValue {
+		return map[string]types.AttributeValue{
+			"tenantId": &types.AttributeValueMemberS{Value: "t"},
+			"id":       &types.AttributeValueMemberS{Value: id},
+		}
+	}
+	item := key("read")
+	item["body"] = &types.AttributeValueMemberS{Value: "b"}
+	item["data"] = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{"c": &types.AttributeValueMemberS{Value: "d"}}}
+
+	tx := &transaction{}
+	tx.read(newRead("messages", key("read"), item, []string{"tenantId", "id", "data.c"}, &message{}))
+	tx.read(newRead("messages", key("missing"), nil, nil, &message{}))
+	tx.read(newRead("drafts", key("versioned"), map[string]types.AttributeValue{
+		"version": &types.AttributeValueMemberN{Value: "3"},
+	}, nil, &draft{Version: 3}))
+	assert.Len(t, tx.reads, 3)
+	assert.NoError(t, tx.Delete("messages", &message{TenantID: "t", ID: "missing"}))
+	for i := range tx.reads {
+		tx.expect(&tx.reads[i])
+	}
+	if !assert.Len(t, tx.items, 3) {
+		return
+	}
+	check := tx.items[1].ConditionCheck
+	assert.Equal(t, "#data.#c = :data_c_read AND #id = :id_read AND #tenantId = :tenantId_read", *check.ConditionExpression)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "d"}, check.ExpressionAttributeValues[":data_c_read"])
+	assert.Equal(t, "attribute_not_exists(#id)", *tx.items[0].Delete.ConditionExpression)
+	assert.Nil(t, tx.items[0].Delete.ExpressionAttributeValues)
+	assert.Equal(t, "#version = :version_read", *tx.items[2].ConditionCheck.ConditionExpression)
+	assert.Same(t, &tx.reads[1], tx.checks[0].read)
+
+	r := tx.reads[0]
+	assert.False(t, r.changed(item))
+	assert.True(t, r.changed(nil))
+	item["data"] = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{"c": &types.AttributeValueMemberS{Value: "x"}}}
+	assert.True(t, r.changed(item))
+	assert.False(t, tx.reads[1].changed(nil))
+	assert.True(t, tx.reads[1].changed(key("missing")))
+}
+
+type note struct {
+	ID        string    `depot:"id,pk"`
+	Body      string    `depot:"body"`
+	CreatedAt time.Time `depot:"createdAt,created"`
+	UpdatedAt time.Time `depot:"updatedAt,updated"`
+}
+
+func TestUpdateItemInputTimestamps(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	n := &note{ID: "i", Body: "b", CreatedAt: now.Add(-time.Hour)}
+	in, c, err := updateItemInput("notes", n, nil, now, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "SET #body = :body, #updatedAt = :updatedAt", *in.UpdateExpression)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "2024-01-02T03:04:05Z"}, in.ExpressionAttributeValues[":updatedAt"])
+
+	assert.NoError(t, c.bump())
+	assert.Equal(t, now, n.UpdatedAt)
+	assert.Equal(t, now.Add(-time.Hour), n.CreatedAt)
+}
+
+func TestPutItemInputTimestamps(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	n := &note{ID: "i", Body: "b"}
+	c, err := newCheck(n, nil)
+	assert.NoError(t, err)
+	c.stamps, err = entityTimestamps(n)
+	assert.NoError(t, err)
+	c.stamps.Put(now, nil)
+
+	in, err := putItemInput("notes", n, c)
+	assert.NoError(t, err)
+	assert.Equal(t, "(attribute_not_exists(#createdAt) OR #createdAt = :createdAt_stored)", *in.ConditionExpression)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "2024-01-02T03:04:05Z"}, in.ExpressionAttributeValues[":createdAt_stored"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "2024-01-02T03:04:05Z"}, in.Item["createdAt"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "2024-01-02T03:04:05Z"}, in.Item["updatedAt"])
+
+	// The stored created time differs, so the put is retried keeping it.
+	stored := &types.ConditionalCheckFailedException{Item: map[string]types.AttributeValue{
+		"createdAt": &types.AttributeValueMemberS{Value: "2023-06-01T00:00:00Z"},
+	}}
+	assert.True(t, c.restamp(stored))
+	assert.Equal(t, time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC), c.stamps.CreatedAt)
+	assert.False(t, c.restamp(stored))
+	assert.False(t, c.restamp(context.Canceled))
+
+	assert.NoError(t, c.bump())
+	assert.Equal(t, time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC), n.CreatedAt)
+	assert.Equal(t, now, n.UpdatedAt)
+}
+
+func TestUpdateItemInputRemove(t *testing.T) {
+	type widget struct {
+		TenantID   string     `depot:"tenantId,pk"`
+		ID         string     `depot:"id,sk"`
+		Name       string     `depot:"name"`
+		Expiration *time.Time `depot:"expiration,omitempty"`
+		Count      int64      `depot:"count"`
+	}
+	now := time.Now()
+	w := &widget{TenantID: "t", ID: "i", Name: "n", Expiration: &now, Count: 1}
+	in, c, err := updateItemInput("widgets", w, []depot.UpdateOp{depot.Remove("expiration"), depot.Add("count")}, now, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "SET #name = :name ADD #count :count REMOVE #expiration", *in.UpdateExpression)
+	assert.Equal(t, "expiration", in.ExpressionAttributeNames["#expiration"])
+	assert.NotContains(t, in.ExpressionAttributeValues, ":expiration")
+
+	assert.NoError(t, c.bump())
+	assert.Nil(t, w.Expiration)
+}
+
+func TestUpdateItemInputLists(t *testing.T) {
+	type widget struct {
+		TenantID string   `depot:"tenantId,pk"`
+		ID       string   `depot:"id,sk"`
+		Refs     []string `depot:"refs"`
+		Old      []string `depot:"old"`
+		Labels   []string `depot:"labels,stringset"`
+		Scores   []int64  `depot:"scores,numberset"`
+	}
+	in, _, err := updateItemInput("widgets", &widget{
+		TenantID: "t", ID: "i",
+		Refs: []string{"r"}, Old: []string{"o"}, Labels: []string{"l"}, Scores: []int64{1, 2},
+	}, []depot.UpdateOp{depot.Append("refs"), depot.Prepend("old"), depot.AddToSet("labels"), depot.RemoveFromSet("scores")}, time.Now(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "SET #refs = list_append(if_not_exists(#refs, :refs_empty), :refs), "+
+		"#old = list_append(:old, if_not_exists(#old, :old_empty)) ADD #labels :labels DELETE #scores :scores", *in.UpdateExpression)
+	assert.Equal(t, &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberS{Value: "r"}}}, in.ExpressionAttributeValues[":refs"])
+	assert.Equal(t, &types.AttributeValueMemberL{Value: []types.AttributeValue{}}, in.ExpressionAttributeValues[":refs_empty"])
+	assert.Equal(t, &types.AttributeValueMemberSS{Value: []string{"l"}}, in.ExpressionAttributeValues[":labels"])
+	assert.Equal(t, &types.AttributeValueMemberNS{Value: []string{"1", "2"}}, in.ExpressionAttributeValues[":scores"])
+}
+
+func TestSetValue(t *testing.T) {
+	av, err := setValue([][]byte{[]byte("a")})
+	assert.NoError(t, err)
+	assert.Equal(t, &types.AttributeValueMemberBS{Value: [][]byte{[]byte("a")}}, av)
+
+	_, err = setValue([]interface{}{"a", 1})
+	assert.ErrorIs(t, err, depot.ErrInvalidTransform)
+	_, err = setValue([]bool{true})
+	assert.ErrorIs(t, err, depot.ErrInvalidTransform)
+}
+
+func TestUpdateItemInputExtrema(t *testing.T) {
+	type widget struct {
+		TenantID string    `depot:"tenantId,pk"`
+		ID       string    `depot:"id,sk"`
+		Seen     time.Time `depot:"seen"`
+		Low      int64     `depot:"low"`
+		First    string    `depot:"first"`
+	}
+	seen := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	w := &widget{TenantID: "t", ID: "i", Seen: seen, Low: 3, First: "f"}
+	op := []depot.UpdateOp{depot.Max("seen"), depot.Min("low"), depot.SetIfAbsent("first")}
+	in, c, err := updateItemInput("widgets", w, op, depot.Now(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "(attribute_not_exists(#seen) OR #seen < :seen) AND (attribute_not_exists(#low) OR #low > :low)", *in.ConditionExpression)
+	assert.Equal(t, "SET #seen = :seen, #low = :low, #first = if_not_exists(#first, :first)", *in.UpdateExpression)
+
+	assert.Nil(t, c.outdone(map[string]interface{}{"seen": "2024-01-01T00:00:00Z", "low": float64(4)}))
+	assert.Equal(t, []string{"seen", "low"}, c.outdone(map[string]interface{}{"seen": "2024-01-02T03:04:05Z", "low": float64(2)}))
+	failure := &types.ConditionalCheckFailedException{Item: map[string]types.AttributeValue{
+		"low": &types.AttributeValueMemberN{Value: "1"},
+	}}
+	assert.Equal(t, []string{"low"}, c.outdoneBy(failure))
+	var ce *depot.ConditionError
+	if assert.ErrorAs(t, c.error(failure), &ce) {
+		assert.Equal(t, []string{"low"}, ce.Fields)
+	}
+
+	in, c, err = updateItemInput("widgets", w, op, depot.Now(), []string{"low"})
+	assert.NoError(t, err)
+	assert.Equal(t, "(attribute_not_exists(#seen) OR #seen < :seen)", *in.ConditionExpression)
+	assert.Equal(t, "SET #seen = :seen, #first = if_not_exists(#first, :first)", *in.UpdateExpression)
+	assert.Len(t, c.extrema, 1)
+}
+
+func TestUpdateItemInputPaths(t *testing.T) {
+	type stats struct {
+		Views int64 `depot:"views"`
+	}
+	type widget struct {
+		TenantID string                 `depot:"tenantId,pk"`
+		ID       string                 `depot:"id,sk"`
+		Stats    stats                  `depot:"stats"`
+		Data     map[string]interface{} `depot:"data"`
+	}
+	w := &widget{TenantID: "t", ID: "i", Stats: stats{Views: 2}, Data: map[string]interface{}{"c": "d", "my-key": 1}}
+	in, _, err := updateItemInput("widgets", w, []depot.UpdateOp{depot.Add("stats.views"), depot.Equal("data.c"), depot.Remove("data.my-key")}, depot.Now(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "#data.#c = :data_c", *in.ConditionExpression)
+	assert.Equal(t, "ADD #stats.#views :stats_views REMOVE #data.#my_key", *in.UpdateExpression)
+	assert.Equal(t, map[string]string{"#stats": "stats", "#views": "views", "#data": "data", "#c": "c", "#my_key": "my-key"}, in.ExpressionAttributeNames)
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "2"}, in.ExpressionAttributeValues[":stats_views"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "d"}, in.ExpressionAttributeValues[":data_c"])
+}
+
+func TestCompositeExpression(t *testing.T) {
+	type widget struct {
+		TenantID string `depot:"tenantId,pk"`
+		ID       string `depot:"id,sk"`
+		Status   string `depot:"status"`
+		Count    int64  `depot:"count"`
+	}
+	conditions, err := depot.EntityPreconditions(&widget{TenantID: "t", ID: "i", Status: "a", Count: 3}, []depot.Condition{
+		depot.Or(depot.Equal("status"), depot.In("status", "b", "c")),
+		depot.Not(depot.And(depot.Exists("id"), depot.LessThan("count"))),
+		depot.GreaterThan("count"),
+	})
+	assert.NoError(t, err)
+	exp, names, values, err := preconditionExpression(conditions)
+	assert.NoError(t, err)
+	assert.Equal(t, "(#status = :status OR #status IN (:status_2_0, :status_2_1)) AND "+
+		"NOT (attribute_exists(#id) AND #count < :count) AND #count > :count_2", *exp)
+	assert.Equal(t, map[string]string{"#id": "id", "#status": "status", "#count": "count"}, names)
+	assert.Equal(t, map[string]types.AttributeValue{
+		":status":     &types.AttributeValueMemberS{Value: "a"},
+		":status_2_0": &types.AttributeValueMemberS{Value: "b"},
+		":status_2_1": &types.AttributeValueMemberS{Value: "c"},
+		":count":      &types.AttributeValueMemberN{Value: "3"},
+		":count_2":    &types.AttributeValueMemberN{Value: "3"},
+	}, values)
+}
+
+func TestValueConditionExpression(t *testing.T) {
+	type message struct {
+		TenantID string `depot:"tenantId,pk"`
+		ID       int64  `depot:"id,sk"`
+		Count    int64  `depot:"count"`
+	}
+	_, conditions, err := depot.EntityConditions("", message{TenantID: "t"}, []depot.QueryOp{
+		depot.Between("id", 2, 4), depot.Where("count", ">", 0), depot.Where("count", "!=", 3),
+	})
+	assert.NoError(t, err)
+	names := make(map[string]string)
+	values := make(map[string]types.AttributeValue)
+	keyExp, filterExp, err := expression{names, values}.query(conditions)
+	assert.NoError(t, err)
+	assert.Equal(t, "#tenantId = :tenantId AND #id BETWEEN :id_0 AND :id_1", *keyExp)
+	assert.Equal(t, "#count > :count AND #count <> :count_2", *filterExp)
+	assert.Equal(t, map[string]types.AttributeValue{
+		":tenantId": &types.AttributeValueMemberS{Value: "t"},
+		":id_0":     &types.AttributeValueMemberN{Value: "2"},
+		":id_1":     &types.AttributeValueMemberN{Value: "4"},
+		":count":    &types.AttributeValueMemberN{Value: "0"},
+		":count_2":  &types.AttributeValueMemberN{Value: "3"},
+	}, values)
+}
+
+func TestStringConditionExpression(t *testing.T) {
+	type order struct {
+		TenantID string   `depot:"tenantId,pk"`
+		ID       string   `depot:"id,sk"`
+		Tags     []string `depot:"tags"`
+		Note     string   `depot:"note"`
+	}
+	_, conditions, err := depot.EntityConditions("", order{TenantID: "t", ID: "ORDER#2024-", Tags: []string{"a", "b"}, Note: "rush"},
+		[]depot.QueryOp{depot.BeginsWith("id"), depot.Contains("tags"), depot.Contains("note")})
+	assert.NoError(t, err)
+	names := make(map[string]string)
+	values := make(map[string]types.AttributeValue)
+	keyExp, filterExp, err := expression{names, values}.query(conditions)
+	assert.NoError(t, err)
+	assert.Equal(t, "#tenantId = :tenantId AND begins_with(#id, :id)", *keyExp)
+	assert.Equal(t, "(contains(#tags, :tags) AND contains(#tags, :tags_2)) AND contains(#note, :note)", *filterExp)
+	assert.Equal(t, map[string]types.AttributeValue{
+		":tenantId": &types.AttributeValueMemberS{Value: "t"},
+		":id":       &types.AttributeValueMemberS{Value: "ORDER#2024-"},
+		":tags":     &types.AttributeValueMemberS{Value: "a"},
+		":tags_2":   &types.AttributeValueMemberS{Value: "b"},
+		":note":     &types.AttributeValueMemberS{Value: "rush"},
+	}, values)
+}
+
+func TestKeyInExpression(t *testing.T) {
+	type message struct {
+		TenantID string `depot:"tenantId,pk"`
+		ID       int64  `depot:"id,sk"`
+		Body     string `depot:"body"`
+	}
+	_, conditions, err := depot.EntityConditions("", message{TenantID: "t", Body: "b"}, []depot.QueryOp{
+		depot.In("id", 1, 2),
+	})
+	assert.NoError(t, err)
+	names := make(map[string]string)
+	values := make(map[string]types.AttributeValue)
+	keyExp, filterExp, err := expression{names, values}.query(conditions)
+	assert.NoError(t, err)
+	assert.Nil(t, keyExp)
+	assert.Equal(t, "#tenantId = :tenantId AND #id IN (:id_0, :id_1) AND #body = :body", *filterExp)
+}
+
+func TestKeyIn(t *testing.T) {
+	type message struct {
+		TenantID string `depot:"tenantId,pk"`
+		ID       int64  `depot:"id,sk"`
+		Body     string `depot:"body"`
+	}
+	conditions := func(op ...depot.QueryOp) []depot.EntityCondition {
+		_, conditions, err := depot.EntityConditions("", message{TenantID: "t"}, op)
+		assert.NoError(t, err)
+		return conditions
+	}
+
+	i, ok := keyIn(conditions(depot.In("id", 1, 2)))
+	assert.True(t, ok)
+	assert.Equal(t, "id", conditions(depot.In("id", 1, 2))[i].Name)
+	_, ok = keyIn(conditions(depot.In("id", 1, 2), depot.Where("id", ">", 0)))
+	assert.False(t, ok)
+	_, ok = keyIn(conditions(depot.NotIn("id", 1, 2)))
+	assert.False(t, ok)
+	_, ok = keyIn(conditions(depot.In("tenantId", "t", "u"), depot.In("id", 1, 2)))
+	assert.False(t, ok)
+	_, ok = keyIn(conditions(depot.In("body", "a")))
+	assert.False(t, ok)
+
+	keys, err := inKeys([]interface{}{10, 9, 100, 9}, true)
+	assert.NoError(t, err)
+	values := make([]interface{}, len(keys))
+	for i, k := range keys {
+		values[i] = k.value
+	}
+	assert.Equal(t, []interface{}{9, 10, 100}, values)
+	keys, err = inKeys([]interface{}{"b", "a", "c"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "c"}, keys[0].av)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "a"}, keys[2].av)
+
+	assert.Zero(t, compareKeys(&types.AttributeValueMemberN{Value: "1.50"}, &types.AttributeValueMemberN{Value: "1.5"}))
+	assert.Negative(t, compareKeys(&types.AttributeValueMemberB{Value: []byte{1}}, &types.AttributeValueMemberB{Value: []byte{1, 0}}))
+	assert.NotZero(t, compareKeys(&types.AttributeValueMemberS{Value: "1"}, &types.AttributeValueMemberN{Value: "1"}))
+	assert.NotZero(t, compareKeys(&types.AttributeValueMemberS{Value: "1"}, nil))
+}
+
+func TestGetItemInputProjection(t *testing.T) {
+	type widget struct {
+		TenantID string                 `depot:"tenantId,pk"`
+		ID       string                 `depot:"id,sk"`
+		Name     string                 `depot:"name"`
+		Data     map[string]interface{} `depot:"data"`
+	}
+	in, err := getItemInput("widgets", &widget{TenantID: "t", ID: "i"}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, in.ProjectionExpression)
+	assert.Nil(t, in.ExpressionAttributeNames)
+
+	in, err = getItemInput("widgets", &widget{TenantID: "t", ID: "i"}, []depot.GetOp{depot.Select("name", "data.c")})
+	assert.NoError(t, err)
+	assert.Equal(t, "#tenantId, #id, #name, #data.#c", *in.ProjectionExpression)
+	assert.Equal(t, map[string]string{"#tenantId": "tenantId", "#id": "id", "#name": "name", "#data": "data", "#c": "c"}, in.ExpressionAttributeNames)
+
+	in, err = getItemInput("widgets", &widget{TenantID: "t", ID: "i"}, []depot.GetOp{depot.Select()})
+	assert.NoError(t, err)
+	assert.Equal(t, "#tenantId, #id", *in.ProjectionExpression)
+	assert.Nil(t, in.ConsistentRead)
+
+	in, err = getItemInput("widgets", &widget{TenantID: "t", ID: "i"}, []depot.GetOp{depot.Consistent()})
+	assert.NoError(t, err)
+	assert.True(t, *in.ConsistentRead)
+
+	_, err = getItemInput("widgets", &widget{TenantID: "t", ID: "i"}, []depot.GetOp{depot.Select("missing")})
+	assert.ErrorIs(t, err, depot.ErrInvalidFieldPath)
+	_, err = getItemInput("widgets", &widget{TenantID: "t", ID: "i"}, []depot.GetOp{depot.AsOf(time.Now())})
+	assert.ErrorIs(t, err, depot.ErrUnsupported)
+}
+
+func TestAggregateInput(t *testing.T) {
+	type widget struct {
+		TenantID string `depot:"tenantId,pk"`
+		ID       string `depot:"id,sk"`
+		Count    int    `depot:"count"`
+	}
+	in, err := aggregateInput("widgets", "", &widget{TenantID: "t"}, depot.AggregateCount, "", []depot.QueryOp{depot.Equal("tenantId")})
+	assert.NoError(t, err)
+	assert.Equal(t, types.SelectCount, in.Select)
+	assert.Equal(t, "#tenantId = :tenantId", *in.KeyConditionExpression)
+	assert.Nil(t, in.ProjectionExpression)
+	assert.Nil(t, in.IndexName)
+
+	in, err = aggregateInput("widgets", "", &widget{Count: 2}, depot.AggregateSum, "count", []depot.QueryOp{depot.GreaterThan("count")})
+	assert.NoError(t, err)
+	assert.Empty(t, in.Select)
+	assert.Nil(t, in.KeyConditionExpression)
+	assert.Equal(t, "#count > :count", *in.FilterExpression)
+	assert.Equal(t, "#count", *in.ProjectionExpression)
+	assert.Equal(t, "#count > :count", *scanInput(in).FilterExpression)
+
+	in, err = aggregateInput("widgets", "", &widget{}, depot.AggregateCount, "", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, in.ExpressionAttributeNames)
+	assert.Nil(t, in.ExpressionAttributeValues)
+
+	in, err = aggregateInput("widgets", "", &widget{TenantID: "t"}, depot.AggregateCount, "", []depot.QueryOp{depot.Consistent()})
+	assert.NoError(t, err)
+	assert.True(t, *in.ConsistentRead)
+	assert.True(t, *scanInput(in).ConsistentRead)
+
+	_, err = aggregateInput("widgets", "named", &widget{TenantID: "t"}, depot.AggregateCount, "", []depot.QueryOp{depot.Consistent()})
+	assert.ErrorIs(t, err, depot.ErrConsistentIndex)
+	_, err = aggregateInput("widgets", "", &widget{TenantID: "t"}, depot.AggregateCount, "", []depot.QueryOp{depot.AsOf(time.Now())})
+	assert.ErrorIs(t, err, depot.ErrUnsupported)
+
+	_, err = aggregateInput("widgets", "", &widget{}, depot.AggregateAvg, "missing", nil)
+	assert.ErrorIs(t, err, depot.ErrInvalidFieldPath)
+}
+
+func TestConditionOnlyUpdate(t *testing.T) {
+	type message struct {
+		TenantID string `depot:"tenantId,pk"`
+		ID       string `depot:"id,sk"`
+		Body     string `depot:"body"`
+	}
+	key := map[string]types.AttributeValue{
+		"tenantId": &types.AttributeValueMemberS{Value: "t"},
+		"id":       &types.AttributeValueMemberS{Value: "m"},
+	}
+	tx := &transaction{d: &DB{clock: time.Now}}
+	assert.NoError(t, tx.Update("messages", &message{TenantID: "t", ID: "m", Body: "b"}, depot.Equal("body")))
+	if !assert.Len(t, tx.items, 1) {
+		return
+	}
+	check := tx.items[0].ConditionCheck
+	if !assert.NotNil(t, check) {
+		return
+	}
+	assert.Equal(t, "#body = :body", *check.ConditionExpression)
+	assert.Equal(t, map[string]string{"#body": "body"}, check.ExpressionAttributeNames)
+
+	// A read of the same item is checked along with the conditions.
+	tx.read(newRead("messages", key, nil, nil, &message{}))
+	tx.expect(&tx.reads[0])
+	assert.Len(t, tx.items, 1)
+	assert.Equal(t, "#body = :body AND attribute_not_exists(#id)", *check.ConditionExpression)
+	assert.Same(t, &tx.reads[0], tx.checks[0].read)
+
+	tx = &transaction{d: &DB{clock: time.Now}}
+	assert.NoError(t, tx.Update("messages", &message{TenantID: "t", ID: "m"}))
+	assert.Empty(t, tx.items)
+}
@@ -5,45 +5,15 @@ import (
 	"os"
 	"testing"
 
+	"github.com/andyday/depot"
 	"github.com/andyday/depot/datastore"
-	"github.com/stretchr/testify/suite"
+	"github.com/andyday/depot/depottest"
+	"github.com/stretchr/testify/require"
 )
 
-type DatastoreSuite struct {
-	Suite
-}
-
-func TestDatastoreSuite(t *testing.T) {
+func TestDatastore(t *testing.T) {
 	t.Skip()
-	suite.Run(t, new(DatastoreSuite))
-}
-
-func (s *DatastoreSuite) SetupSuite() {
-	var err error
-	s.db, err = datastore.NewDatabase(context.Background(), os.Getenv("DATASTORE_PROJECT_ID"), "")
-	s.NoError(err)
-}
-
-func (s *DatastoreSuite) TestPut() {
-	TestPut(&s.Suite)
-}
-
-func (s *DatastoreSuite) TestCreate() {
-	TestCreate(&s.Suite)
-}
-
-func (s *DatastoreSuite) TestUpdate() {
-	TestUpdate(&s.Suite)
-}
-
-func (s *DatastoreSuite) TestQueryCreatedIndex() {
-	TestQueryCreatedIndex(&s.Suite)
-}
-
-func (s *DatastoreSuite) TestQueryNamedIndex() {
-	TestQueryNamedIndex(&s.Suite)
-}
-
-func (s *DatastoreSuite) TestQueryMessage() {
-	TestQueryMessage(&s.Suite)
+	db, err := datastore.NewDatabase(context.Background(), os.Getenv("DATASTORE_PROJECT_ID"), "")
+	require.NoError(t, err)
+	depottest.RunConformance(t, func() depot.Database { return db })
 }
@@ -4,20 +4,14 @@ import (
 	"context"
 	"testing"
 
+	"github.com/andyday/depot"
+	"github.com/andyday/depot/depottest"
 	"github.com/andyday/depot/dynamo"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/stretchr/testify/suite"
+	"github.com/stretchr/testify/require"
 )
 
-type DynamoSuite struct {
-	Suite
-}
-
-func TestDynamoSuite(t *testing.T) {
-	suite.Run(t, new(DynamoSuite))
-}
-
-func (s *DynamoSuite) SetupSuite() {
+func TestDynamo(t *testing.T) {
 	cfg, err := awsconfig.LoadDefaultConfig(context.Background())
 	//awsconfig.WithClientLogMode(
 	//	aws.LogRequestWithBody|
@@ -25,31 +19,8 @@ func (s *DynamoSuite) SetupSuite() {
 	//		aws.LogRequestEventMessage|
 	//		aws.LogResponseEventMessage,
 	//))
-	s.NoError(err)
-	s.db, err = dynamo.NewDatabase(cfg)
-	s.NoError(err)
-}
-
-func (s *DynamoSuite) TestPut() {
-	TestPut(&s.Suite)
-}
-
-func (s *DynamoSuite) TestCreate() {
-	TestCreate(&s.Suite)
-}
-
-func (s *DynamoSuite) TestUpdate() {
-	TestUpdate(&s.Suite)
-}
-
-func (s *DynamoSuite) TestQueryCreatedIndex() {
-	TestQueryCreatedIndex(&s.Suite)
-}
-
-func (s *DynamoSuite) TestQueryNamedIndex() {
-	TestQueryNamedIndex(&s.Suite)
-}
-
-func (s *DynamoSuite) TestQueryMessage() {
-	TestQueryMessage(&s.Suite)
+	require.NoError(t, err)
+	db, err := dynamo.NewDatabase(cfg)
+	require.NoError(t, err)
+	depottest.RunConformance(t, func() depot.Database { return db })
 }
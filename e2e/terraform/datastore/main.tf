@@ -61,6 +61,42 @@ resource "google_datastore_index" "expired" {
   }
 }
 
+resource "google_datastore_index" "count" {
+  kind = local.widget
+  properties {
+    name      = "tenantId"
+    direction = "ASCENDING"
+  }
+  properties {
+    name      = "count"
+    direction = "ASCENDING"
+  }
+}
+
+resource "google_datastore_index" "data" {
+  kind = local.widget
+  properties {
+    name      = "tenantId"
+    direction = "ASCENDING"
+  }
+  properties {
+    name      = "data.c"
+    direction = "ASCENDING"
+  }
+}
+
+resource "google_datastore_index" "message_asc" {
+  kind = local.message
+  properties {
+    name      = "tenantId"
+    direction = "ASCENDING"
+  }
+  properties {
+    name      = "id"
+    direction = "ASCENDING"
+  }
+}
+
 resource "google_datastore_index" "message" {
   kind = local.message
   properties {
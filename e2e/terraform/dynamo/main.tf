@@ -34,6 +34,10 @@ resource "aws_dynamodb_table" "widget" {
     name = "category"
     type = "S"
   }
+  attribute {
+    name = "count"
+    type = "N"
+  }
   attribute {
     name = "createdAt"
     type = "S"
@@ -65,6 +69,12 @@ resource "aws_dynamodb_table" "widget" {
     range_key       = "category"
     projection_type = "ALL"
   }
+  global_secondary_index {
+    name            = "count"
+    hash_key        = "tenantId"
+    range_key       = "count"
+    projection_type = "ALL"
+  }
   global_secondary_index {
     name            = "expired"
     hash_key        = "expirationPartition"
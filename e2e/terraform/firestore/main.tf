@@ -84,6 +84,54 @@ resource "google_firestore_index" "expired" {
   }
 }
 
+resource "google_firestore_index" "count" {
+  project    = var.project
+  database   = google_firestore_database.database.name
+  collection = local.widget
+
+  fields {
+    field_path = "tenantId"
+    order      = "ASCENDING"
+  }
+
+  fields {
+    field_path = "count"
+    order      = "ASCENDING"
+  }
+}
+
+resource "google_firestore_index" "data" {
+  project    = var.project
+  database   = google_firestore_database.database.name
+  collection = local.widget
+
+  fields {
+    field_path = "tenantId"
+    order      = "ASCENDING"
+  }
+
+  fields {
+    field_path = "data.c"
+    order      = "ASCENDING"
+  }
+}
+
+resource "google_firestore_index" "message_asc" {
+  project    = var.project
+  database   = google_firestore_database.database.name
+  collection = local.message
+
+  fields {
+    field_path = "tenantId"
+    order      = "ASCENDING"
+  }
+
+  fields {
+    field_path = "id"
+    order      = "ASCENDING"
+  }
+}
+
 resource "google_firestore_index" "message" {
   project    = var.project
   database   = google_firestore_database.database.name
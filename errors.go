@@ -1,6 +1,10 @@
 package depot
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 var (
 	ErrInvalidEntityType   = errors.New("depot: invalid entity type")
@@ -8,4 +12,26 @@ var (
 	ErrEntityNotFound      = errors.New("depot: entity not found")
 	ErrEntityAlreadyExists = errors.New("depot: entity already exists")
 	ErrNoSortField         = errors.New("depot: no sort field")
+	ErrInvalidPage         = errors.New("depot: invalid page token")
+	ErrConditionFailed     = errors.New("depot: condition failed")
+	ErrVersionConflict     = errors.New("depot: version conflict")
+	ErrInvalidFieldPath    = errors.New("depot: invalid field path")
+	ErrUnsupported         = errors.New("depot: unsupported by this backend")
+	ErrInvalidCondition    = errors.New("depot: invalid condition")
+	ErrConsistentIndex     = errors.New("depot: consistent reads are unsupported on indexes")
 )
+
+// ConditionError is returned when the conditions of a write are not met. It
+// wraps ErrConditionFailed and names the fields whose conditions failed.
+type ConditionError struct {
+	Fields []string
+}
+
+func (e *ConditionError) Error() string {
+	if len(e.Fields) == 0 {
+		return ErrConditionFailed.Error()
+	}
+	return fmt.Sprintf("%s: %s", ErrConditionFailed, strings.Join(e.Fields, ", "))
+}
+
+func (e *ConditionError) Unwrap() error { return ErrConditionFailed }
@@ -2,26 +2,50 @@ package firestore
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"reflect"
-	"strconv"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/firestore"
+	apiv1 "cloud.google.com/go/firestore/apiv1"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
 	"github.com/andyday/depot"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+var ErrInvalidPageCursor = fmt.Errorf("firestore: %w", depot.ErrInvalidPage)
+
 type DB struct {
 	firestore *firestore.Client
+	// reader runs the queries made as of a read time. It is created on first
+	// use, under mu.
+	reader *apiv1.Client
+	mu     sync.Mutex
+	pages  depot.PageCodec
+	clock  func() time.Time
 }
 
 var _ depot.Database = &DB{}
 
-func NewDatabase(ctx context.Context, projectID, databaseID string) (c *DB, err error) {
-	c = &DB{}
+func NewDatabase(ctx context.Context, projectID, databaseID string, opts ...depot.Option) (c *DB, err error) {
+	o := depot.NewOptions(opts...)
+	c = &DB{pages: o.PageCodec, clock: o.Clock}
 	if databaseID == "" {
 		c.firestore, err = firestore.NewClient(ctx, projectID)
 	} else {
@@ -30,22 +54,89 @@ func NewDatabase(ctx context.Context, projectID, databaseID string) (c *DB, err
 	return
 }
 
-func (d *DB) Put(ctx context.Context, table string, entity interface{}) (err error) {
+// Close closes the connections the database holds.
+func (d *DB) Close() (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.reader != nil {
+		err = d.reader.Close()
+		d.reader = nil
+	}
+	if cerr := d.firestore.Close(); err == nil {
+		err = cerr
+	}
+	return
+}
+
+// readerClient returns the low-level client, creating it with the endpoint
+// and credentials firestore.NewClient uses: the emulator when
+// FIRESTORE_EMULATOR_HOST is set and the default credentials otherwise.
+func (d *DB) readerClient(ctx context.Context) (_ *apiv1.Client, err error) {
+	var (
+		opts []option.ClientOption
+		conn *grpc.ClientConn
+	)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.reader != nil {
+		return d.reader, nil
+	}
+	if addr := os.Getenv("FIRESTORE_EMULATOR_HOST"); addr != "" {
+		if conn, err = grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithPerRPCCredentials(emulatorCreds{})); err != nil {
+			return
+		}
+		opts = append(opts, option.WithGRPCConn(conn))
+	}
+	if d.reader, err = apiv1.NewClient(ctx, opts...); err != nil {
+		if conn != nil {
+			_ = conn.Close()
+		}
+		return
+	}
+	return d.reader, nil
+}
+
+// emulatorCreds authorizes requests to the emulator as its owner.
+type emulatorCreds struct{}
+
+func (emulatorCreds) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer owner"}, nil
+}
+
+func (emulatorCreds) RequireTransportSecurity() bool {
+	return false
+}
+
+func (d *DB) Put(ctx context.Context, table string, entity interface{}, op ...depot.Condition) (err error) {
 	var (
 		doc *firestore.DocumentRef
 		m   map[string]interface{}
+		ts  depot.Timestamps
 	)
+	if ts, err = depot.EntityTimestamps(entity); err != nil {
+		return
+	}
+	// Keeping the stored created time needs a read, so it takes a transaction.
+	if len(op) > 0 || ts.Created != "" || depot.IsVersioned(entity) {
+		return d.transact(ctx, func(t *transaction) error {
+			return t.Put(table, entity, op...)
+		})
+	}
 	if doc, err = d.doc(table, entity); err != nil {
 		return
 	}
 	if m, err = depot.EntityMap(entity, true); err != nil {
 		return
 	}
-	_, err = doc.Set(ctx, m)
-	return
+	ts.Put(d.clock(), nil)
+	ts.Write(m)
+	if _, err = doc.Set(ctx, m); err != nil {
+		return
+	}
+	return ts.Set(entity)
 }
 
-func (d *DB) Get(ctx context.Context, table string, entity interface{}) (err error) {
+func (d *DB) Get(ctx context.Context, table string, entity interface{}, op ...depot.GetOp) (err error) {
 	var (
 		doc *firestore.DocumentRef
 		res *firestore.DocumentSnapshot
@@ -53,15 +144,58 @@ func (d *DB) Get(ctx context.Context, table string, entity interface{}) (err err
 	if doc, err = d.doc(table, entity); err != nil {
 		return
 	}
+	if t := depot.ReadTime(op); !t.IsZero() {
+		doc = doc.WithReadOptions(firestore.ReadTime(t))
+	} else if fields := depot.Selected(op); fields != nil && len(fields) == 0 {
+		return exists(ctx, doc, entity)
+	}
 	if res, err = doc.Get(ctx); status.Code(err) == codes.NotFound {
 		return depot.ErrEntityNotFound
 	} else if err != nil {
 		return
 	}
-	return depot.EntityFromMap(res.Data(), entity, true)
+	return loadDocument(res, entity, op)
+}
+
+// exists fails with depot.ErrEntityNotFound unless doc is stored, and
+// otherwise clears the fields of entity other than its key. It queries for the
+// document ID alone, which reads none of its fields.
+func exists(ctx context.Context, doc *firestore.DocumentRef, entity interface{}) (err error) {
+	it := doc.Parent.Where(firestore.DocumentID, "==", doc).Select().Limit(1).Documents(ctx)
+	defer it.Stop()
+	if _, err = it.Next(); errors.Is(err, iterator.Done) {
+		return depot.ErrEntityNotFound
+	} else if err != nil {
+		return
+	}
+	return depot.ResetEntity(entity)
+}
+
+// loadDocument loads res into entity, keeping only the fields that op selects.
+// Documents are read whole, so the others are dropped here.
+func loadDocument(res *firestore.DocumentSnapshot, entity interface{}, op []depot.GetOp) (err error) {
+	var (
+		data       = res.Data()
+		projection []string
+	)
+	if fields := depot.Selected(op); fields != nil {
+		if projection, err = depot.Projection("", entity, fields); err != nil {
+			return
+		}
+		if err = depot.ResetEntity(entity); err != nil {
+			return
+		}
+		data = depot.ProjectMap(data, projection)
+	}
+	return depot.EntityFromMap(data, entity, true)
 }
 
-func (d *DB) Delete(ctx context.Context, table string, entity interface{}) (err error) {
+func (d *DB) Delete(ctx context.Context, table string, entity interface{}, op ...depot.Condition) (err error) {
+	if len(op) > 0 || depot.IsVersioned(entity) {
+		return d.transact(ctx, func(t *transaction) error {
+			return t.Delete(table, entity, op...)
+		})
+	}
 	var doc *firestore.DocumentRef
 	if doc, err = d.doc(table, entity); err != nil {
 		return
@@ -72,8 +206,11 @@ func (d *DB) Delete(ctx context.Context, table string, entity interface{}) (err
 
 func (d *DB) Create(ctx context.Context, table string, entity interface{}) (err error) {
 	var (
-		doc *firestore.DocumentRef
-		m   map[string]interface{}
+		doc       *firestore.DocumentRef
+		m         map[string]interface{}
+		version   depot.Version
+		versioned bool
+		ts        depot.Timestamps
 	)
 	if doc, err = d.doc(table, entity); err != nil {
 		return
@@ -81,115 +218,398 @@ func (d *DB) Create(ctx context.Context, table string, entity interface{}) (err
 	if m, err = depot.EntityMap(entity, true); err != nil {
 		return
 	}
+	if version, versioned, err = depot.EntityVersion(entity); err != nil {
+		return
+	}
+	if ts, err = depot.EntityTimestamps(entity); err != nil {
+		return
+	}
+	if versioned {
+		m[version.Name] = version.Next()
+	}
+	ts.Create(d.clock())
+	ts.Write(m)
 	if _, err = doc.Create(ctx, m); status.Code(err) == codes.AlreadyExists {
 		return depot.ErrEntityAlreadyExists
+	} else if err != nil {
+		return
 	}
-	return
+	if err = ts.Set(entity); err != nil || !versioned {
+		return
+	}
+	return depot.SetEntityVersion(entity, version.Next())
 }
 
 func (d *DB) Update(ctx context.Context, table string, entity interface{}, op ...depot.UpdateOp) (err error) {
+	return d.transact(ctx, func(t *transaction) error {
+		return t.Update(table, entity, op...)
+	})
+}
+
+func (d *DB) RunInTransaction(ctx context.Context, fn func(tx depot.Tx) error) (err error) {
+	if err = d.transact(ctx, func(t *transaction) error {
+		return fn(t)
+	}); status.Code(err) == codes.AlreadyExists {
+		return depot.ErrEntityAlreadyExists
+	}
+	return
+}
+
+// transact runs fn in a Firestore transaction, which may call it more than
+// once, and sets the versions written by its last call once it has committed.
+func (d *DB) transact(ctx context.Context, fn func(t *transaction) error) (err error) {
+	var t *transaction
+	if err = d.firestore.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		t = &transaction{d: d, tx: tx}
+		return fn(t)
+	}); err != nil {
+		return
+	}
+	return t.bumps.Apply()
+}
+
+func (t *transaction) update(table string, entity interface{}, op []depot.UpdateOp) (err error) {
 	var (
 		doc          *firestore.DocumentRef
 		res          *firestore.DocumentSnapshot
+		key          depot.Key
 		depotUpdates []depot.Update
 		u            depot.Update
 		existing     map[string]interface{}
 		updates      []firestore.Update
-		canUpdate    = true
+		useSet       bool
 		v            interface{}
+		version      depot.Version
+		versioned    bool
+		ts           depot.Timestamps
 	)
-	if doc, err = d.doc(table, entity); err != nil {
+	if doc, err = t.d.doc(table, entity); err != nil {
+		return
+	}
+	if key, err = depot.EntityKey(entity); err != nil {
 		return
 	}
 	if depotUpdates, err = depot.EntityUpdates(entity, op); err != nil {
 		return
 	}
+	if version, versioned, err = depot.EntityVersion(entity); err != nil {
+		return
+	}
+	if ts, err = depot.EntityTimestamps(entity); err != nil {
+		return
+	}
 
-	err = d.firestore.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) (err error) {
-		var useSet bool
-		if res, err = tx.Get(doc); status.Code(err) == codes.NotFound {
-			existing = make(map[string]interface{})
-			useSet = true
-		} else if err != nil {
+	if res, err = t.tx.Get(doc); status.Code(err) == codes.NotFound {
+		existing = keyMap(key)
+		useSet = true
+	} else if err != nil {
+		return
+	} else {
+		existing = res.Data()
+	}
+	if versioned {
+		if err = depot.CheckVersion(version, existing); err != nil {
 			return
-		} else {
-			existing = res.Data()
 		}
+	}
+	if err = depot.CheckConditions(depot.UpdateConditions(depotUpdates), existing); err != nil {
+		return
+	}
+	if versioned {
+		depotUpdates = append(depotUpdates, depot.Update{Name: version.Name, Value: version.Next()})
+		t.bumps.Add(entity, version.Next())
+	}
+	ts.Update(t.d.clock())
+	depotUpdates = append(depotUpdates, ts.Updates()...)
+	if err = ts.Set(entity); err != nil {
+		return
+	}
+	if err = depot.ClearFields(entity, depot.RemovedFields(depotUpdates)...); err != nil {
+		return
+	}
 
-		for _, u := range depotUpdates {
-			switch u.Op.(type) {
+	for _, u = range depotUpdates {
+		v = depot.StoredValue(existing, u.Name)
+		switch u.Op.(type) {
+		case *depot.AddUpdateOp:
+			v = depot.AddValues(v, u.Value)
+		case *depot.SubtractUpdateOp:
+			v = depot.SubtractValues(v, u.Value)
+		case *depot.RemoveUpdateOp:
+			if !useSet {
+				updates = append(updates, firestore.Update{FieldPath: fieldPath(u.Name), Value: firestore.Delete})
+			} else if err = depot.DeletePathValue(existing, u.Name); err != nil {
+				return
 			}
-
-		}
-
-		for _, u = range depotUpdates {
-			v = existing[u.Name]
-			switch u.Op.(type) {
-			case *depot.AddUpdateOp:
-				v = depot.AddValues(v, u.Value)
-			case *depot.SubtractUpdateOp:
-				v = depot.SubtractValues(v, u.Value)
-			case *depot.EqualCondition:
-				canUpdate = canUpdate && depot.ValuesEqual(v, u.Value)
-			case *depot.NotEqualCondition:
-				canUpdate = canUpdate && depot.ValuesNotEqual(v, u.Value)
-			case *depot.LTCondition:
-				canUpdate = canUpdate && depot.ValuesLessThan(v, u.Value)
-			case *depot.LTECondition:
-				canUpdate = canUpdate && depot.ValuesLessThanOrEqual(v, u.Value)
-			case *depot.GTCondition:
-				canUpdate = canUpdate && depot.ValuesGreaterThan(v, u.Value)
-			case *depot.GTECondition:
-				canUpdate = canUpdate && depot.ValuesGreaterThanOrEqual(v, u.Value)
-			//case *depot.ExistsCondition:
-
-			default:
-				v = u.Value
+			continue
+		case *depot.AppendUpdateOp:
+			v = depot.AppendValues(v, u.Value)
+		case *depot.PrependUpdateOp:
+			v = depot.PrependValues(v, u.Value)
+		case *depot.AddToSetUpdateOp:
+			if useSet {
+				v = depot.UnionValues(v, u.Value)
+			} else {
+				v = firestore.ArrayUnion(depot.ListValues(u.Value)...)
 			}
+		case *depot.RemoveFromSetUpdateOp:
 			if useSet {
-				existing[u.Name] = v
+				v = depot.DifferenceValues(v, u.Value)
 			} else {
-				updates = append(updates, firestore.Update{Path: u.Name, Value: v})
+				v = firestore.ArrayRemove(depot.ListValues(u.Value)...)
 			}
+		case *depot.SetIfAbsentUpdateOp, *depot.MaxUpdateOp, *depot.MinUpdateOp:
+			if !depot.UpdateApplies(u, v) {
+				continue
+			}
+			v = u.Value
+		case depot.Condition:
+			continue
+		default:
+			v = u.Value
 		}
-		if useSet {
-			err = tx.Set(doc, existing)
-		} else {
-			err = tx.Update(doc, updates)
+		if !useSet {
+			updates = append(updates, firestore.Update{FieldPath: fieldPath(u.Name), Value: v})
+		} else if err = depot.SetPathValue(existing, u.Name, v); err != nil {
+			return
 		}
-		return
-	})
-	return
+	}
+	if useSet {
+		return t.tx.Set(doc, existing)
+	}
+	return t.tx.Update(doc, updates)
 }
 
 func (d *DB) Query(ctx context.Context, table, kind string, entity interface{}, entities interface{}, op ...depot.QueryOp) (page string, err error) {
 	var (
 		conditions []depot.EntityCondition
 		sortField  string
-		offset     int
+		s          depot.Struct
+		ev         reflect.Value
+		limit      int
+		start      string
+		orders     []string
+		dir        firestore.Direction
+		values     []interface{}
+		last       *document
 		q          firestore.Query
+		it         documentIterator
+		projection []string
 	)
 
 	if sortField, conditions, err = depot.EntityConditions(kind, entity, op); err != nil {
 		return
 	}
-	q = applyQueryConditions(d.firestore.Collection(table), conditions)
-	if q, offset, err = applyQueryDirectives(q, op, sortField); err != nil {
+	shape := depot.PageShape(table, kind, conditions, op)
+	if op, err = depot.DecodePageOps(d.pages, shape, op); err != nil {
 		return
 	}
-	qr := newQueryRunner(table, entities, offset)
-	if offset, err = qr.run(q.Documents(ctx)); err != nil {
+	if s, ev, err = depot.GetStruct(reflect.ValueOf(entity)); err != nil {
 		return
 	}
-	if err = qr.next(q.Offset(offset).Documents(ctx), false); errors.Is(err, iterator.Done) {
-		// If this is an error it means it is done at the 1st item or there was an error
-		return "", nil
+	if limit, start, orders, dir, err = queryDirectives(op, conditions, sortField); err != nil {
+		return
 	}
-	if err != nil {
+	if q, err = applyQueryConditions(d.firestore.Collection(table), conditions); err != nil {
 		return
 	}
+	for _, f := range orders {
+		q = q.OrderBy(f, dir)
+	}
 
-	return strconv.Itoa(offset), nil
+	if fields := depot.Selected(op); fields != nil {
+		if projection, err = depot.Projection(kind, entity, fields); err != nil {
+			return
+		}
+		q = q.Select(selection(projection, orders)...)
+	}
+	if limit > 0 {
+		q = q.Limit(limit + 1)
+	}
+	if start != "" {
+		if values, err = decodePage(s, ev.Type(), start, orders); err != nil {
+			return
+		}
+		q = q.StartAfter(values...)
+	}
+	if it, err = d.documents(ctx, q, depot.ReadTime(op)); err != nil {
+		return
+	}
+	if last, err = newQueryRunner(entities, limit, projection).run(it); err != nil || last == nil {
+		return
+	}
+	if page, err = encodePage(last, orders); err != nil {
+		return
+	}
+	return d.pages.Encode(shape, page)
+}
+
+func (d *DB) Aggregate(ctx context.Context, table, kind string, entity interface{}, agg depot.Aggregate, field string, op ...depot.QueryOp) (result float64, err error) {
+	var (
+		conditions []depot.EntityCondition
+		q          firestore.Query
+		res        firestore.AggregationResult
+		readTime   = depot.ReadTime(op)
+	)
+	if err = depot.CheckAggregate(entity, agg, field); err != nil {
+		return
+	}
+	if _, conditions, err = depot.EntityConditions(kind, entity, op); err != nil {
+		return
+	}
+	if q, err = applyQueryConditions(d.firestore.Collection(table), conditions); err != nil {
+		return
+	}
+	if !readTime.IsZero() {
+		return d.aggregateAt(ctx, q, agg, field, readTime)
+	}
+	if res, err = aggregationQuery(q, agg, field).Get(ctx); err != nil {
+		return
+	}
+	return aggregateValue(res[aggregateAlias]), nil
+}
+
+// aggregateAt computes the aggregate over the documents q matches as of
+// readTime. Aggregation queries take no read time, so the documents are read
+// and the aggregate is worked out here.
+func (d *DB) aggregateAt(ctx context.Context, q firestore.Query, agg depot.Aggregate, field string, readTime time.Time) (result float64, err error) {
+	var (
+		it  documentIterator
+		doc *document
+		a   = depot.Aggregator{Aggregate: agg, Field: field}
+	)
+	if agg == depot.AggregateCount {
+		q = q.Select()
+	} else {
+		q = q.Select(field)
+	}
+	if it, err = d.documents(ctx, q, readTime); err != nil {
+		return
+	}
+	defer it.Stop()
+	for {
+		if doc, err = it.Next(); errors.Is(err, iterator.Done) {
+			return a.Result(), nil
+		} else if err != nil {
+			return
+		}
+		a.Add(doc.data)
+	}
+}
+
+const aggregateAlias = "depot"
+
+func aggregationQuery(q firestore.Query, agg depot.Aggregate, field string) *firestore.AggregationQuery {
+	aq := q.NewAggregationQuery()
+	switch agg {
+	case depot.AggregateSum:
+		return aq.WithSumPath(fieldPath(field), aggregateAlias)
+	case depot.AggregateAvg:
+		return aq.WithAvgPath(fieldPath(field), aggregateAlias)
+	}
+	return aq.WithCount(aggregateAlias)
+}
+
+// aggregateValue returns the number an aggregation result holds. The average
+// of no values comes back as null and is 0.
+func aggregateValue(v interface{}) float64 {
+	pv, ok := v.(*firestorepb.Value)
+	if !ok {
+		return 0
+	}
+	switch pv.GetValueType().(type) {
+	case *firestorepb.Value_IntegerValue:
+		return float64(pv.GetIntegerValue())
+	case *firestorepb.Value_DoubleValue:
+		return pv.GetDoubleValue()
+	}
+	return 0
+}
+
+func (d *DB) BatchGet(ctx context.Context, table string, entities interface{}) (err error) {
+	var (
+		v     reflect.Value
+		doc   *firestore.DocumentRef
+		docs  []*firestore.DocumentRef
+		snaps []*firestore.DocumentSnapshot
+	)
+	if v, err = depot.EntitySlice(entities); err != nil {
+		return
+	}
+	for i := 0; i < v.Len(); i++ {
+		if doc, err = d.doc(table, v.Index(i).Addr().Interface()); err != nil {
+			return
+		}
+		docs = append(docs, doc)
+	}
+	if len(docs) > 0 {
+		if snaps, err = d.firestore.GetAll(ctx, docs); err != nil {
+			return
+		}
+	}
+	found := make([]bool, v.Len())
+	for i, snap := range snaps {
+		if !snap.Exists() {
+			continue
+		}
+		if err = depot.EntityFromMap(snap.Data(), v.Index(i).Addr().Interface(), true); err != nil {
+			return
+		}
+		found[i] = true
+	}
+	return depot.KeepEntities(v, found)
+}
+
+func (d *DB) BatchPut(ctx context.Context, table string, entities interface{}) (err error) {
+	return d.bulkWrite(ctx, entities, func(bw *firestore.BulkWriter, entity interface{}) (job *firestore.BulkWriterJob, err error) {
+		var (
+			doc *firestore.DocumentRef
+			m   map[string]interface{}
+		)
+		if doc, err = d.doc(table, entity); err != nil {
+			return
+		}
+		if m, err = depot.EntityMap(entity, true); err != nil {
+			return
+		}
+		return bw.Set(doc, m)
+	})
+}
+
+func (d *DB) BatchDelete(ctx context.Context, table string, entities interface{}) (err error) {
+	return d.bulkWrite(ctx, entities, func(bw *firestore.BulkWriter, entity interface{}) (job *firestore.BulkWriterJob, err error) {
+		var doc *firestore.DocumentRef
+		if doc, err = d.doc(table, entity); err != nil {
+			return
+		}
+		return bw.Delete(doc)
+	})
+}
+
+func (d *DB) bulkWrite(ctx context.Context, entities interface{}, write func(*firestore.BulkWriter, interface{}) (*firestore.BulkWriterJob, error)) (err error) {
+	var (
+		v    reflect.Value
+		job  *firestore.BulkWriterJob
+		jobs []*firestore.BulkWriterJob
+	)
+	if v, err = depot.EntitySlice(entities); err != nil {
+		return
+	}
+	bw := d.firestore.BulkWriter(ctx)
+	for i := 0; i < v.Len(); i++ {
+		if job, err = write(bw, v.Index(i).Addr().Interface()); err != nil {
+			bw.End()
+			return
+		}
+		jobs = append(jobs, job)
+	}
+	bw.End()
+	for _, job = range jobs {
+		if _, err = job.Results(); err != nil {
+			return
+		}
+	}
+	return
 }
 
 func (d *DB) doc(table string, entity interface{}) (_ *firestore.DocumentRef, err error) {
@@ -200,17 +620,20 @@ func (d *DB) doc(table string, entity interface{}) (_ *firestore.DocumentRef, er
 	return d.firestore.Doc(k), nil
 }
 
+// queryRunner appends query results to a list. A query with a limit is run
+// with one extra result which tells whether there is another page without
+// adding it to the list.
 type queryRunner struct {
-	table       string
-	list        interface{}
 	listValue   reflect.Value
 	elementType reflect.Type
-	offset      int
+	limit       int
+	// projection, when set, names the only fields loaded into the list.
+	projection []string
 }
 
-func newQueryRunner(table string, list interface{}, offset int) *queryRunner {
-	q := &queryRunner{table: table, list: list, offset: offset}
-	q.listValue = reflect.ValueOf(q.list)
+func newQueryRunner(list interface{}, limit int, projection []string) *queryRunner {
+	q := &queryRunner{limit: limit, projection: projection}
+	q.listValue = reflect.ValueOf(list)
 	if q.listValue.Kind() == reflect.Ptr {
 		q.listValue = q.listValue.Elem()
 	}
@@ -218,90 +641,546 @@ func newQueryRunner(table string, list interface{}, offset int) *queryRunner {
 	return q
 }
 
-func (q *queryRunner) run(it *firestore.DocumentIterator) (offset int, err error) {
+// run returns the last document added to the list when there is another page
+// of results after it.
+func (q *queryRunner) run(it documentIterator) (last *document, err error) {
+	var res *document
 	defer it.Stop()
-	for {
-		if err = q.next(it, true); errors.Is(err, iterator.Done) {
-			break
+	for n := 0; ; n++ {
+		if res, err = it.Next(); errors.Is(err, iterator.Done) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
 		}
-		if err != nil {
-			return
+		if q.limit > 0 && n == q.limit {
+			return last, nil
+		}
+		data := res.data
+		if q.projection != nil {
+			data = depot.ProjectMap(data, q.projection)
+		}
+		ev := reflect.New(q.elementType)
+		if err = depot.EntityFromMap(data, ev.Interface(), true); err != nil {
+			return nil, err
 		}
+		q.listValue.Set(reflect.Append(q.listValue, ev.Elem()))
+		last = res
 	}
-	return q.offset, nil
 }
 
-func (q *queryRunner) next(it *firestore.DocumentIterator, append bool) (err error) {
-	var res *firestore.DocumentSnapshot
-	if !append {
-		defer it.Stop()
+// document is a stored document as a query returns it.
+type document struct {
+	id   string
+	data map[string]interface{}
+}
+
+type documentIterator interface {
+	Next() (*document, error)
+	Stop()
+}
+
+// documents runs q, as of readTime unless it is zero. This version of the
+// client cannot run a query as of a read time: Query.WithReadOptions writes to
+// settings that a collection's queries do not have, and a read-only
+// Transaction sends its ID in place of any read time. Those queries run
+// through the low-level client instead.
+func (d *DB) documents(ctx context.Context, q firestore.Query, readTime time.Time) (it documentIterator, err error) {
+	var (
+		bytes  []byte
+		req    firestorepb.RunQueryRequest
+		reader *apiv1.Client
+		stream firestorepb.Firestore_RunQueryClient
+	)
+	if readTime.IsZero() {
+		return snapshotIterator{q.Documents(ctx)}, nil
 	}
-	ev := reflect.New(q.elementType)
-	if res, err = it.Next(); err != nil {
+	if reader, err = d.readerClient(ctx); err != nil {
 		return
 	}
-	if err = depot.EntityFromMap(res.Data(), ev.Interface(), true); err != nil {
+	if bytes, err = q.Serialize(); err != nil {
 		return
 	}
-	q.offset++
-	if append {
-		q.listValue.Set(reflect.Append(q.listValue, ev.Elem()))
+	if err = proto.Unmarshal(bytes, &req); err != nil {
+		return
+	}
+	// Read times are truncated to the second, as the client does for Get.
+	req.ConsistencySelector = &firestorepb.RunQueryRequest_ReadTime{ReadTime: timestamppb.New(readTime.Truncate(time.Second))}
+	database, _, _ := strings.Cut(req.Parent, "/documents")
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(ctx, "google-cloud-resource-prefix", database))
+	if stream, err = reader.RunQuery(ctx, &req); err != nil {
+		cancel()
+		return
+	}
+	return &streamIterator{d: d, stream: stream, cancel: cancel}, nil
+}
+
+type snapshotIterator struct {
+	it *firestore.DocumentIterator
+}
+
+func (s snapshotIterator) Next() (doc *document, err error) {
+	var res *firestore.DocumentSnapshot
+	if res, err = s.it.Next(); err != nil {
+		return
+	}
+	return &document{id: res.Ref.ID, data: res.Data()}, nil
+}
+
+func (s snapshotIterator) Stop() {
+	s.it.Stop()
+}
+
+type streamIterator struct {
+	d      *DB
+	stream firestorepb.Firestore_RunQueryClient
+	cancel context.CancelFunc
+}
+
+func (s *streamIterator) Next() (doc *document, err error) {
+	var res *firestorepb.RunQueryResponse
+	for {
+		if res, err = s.stream.Recv(); errors.Is(err, io.EOF) {
+			return nil, iterator.Done
+		} else if err != nil {
+			return
+		}
+		// Responses without a document only report progress.
+		if res.Document != nil {
+			return s.d.protoDocument(res.Document)
+		}
+	}
+}
+
+func (s *streamIterator) Stop() {
+	s.cancel()
+}
+
+// protoDocument decodes a document the low-level client returns into the
+// same values a DocumentSnapshot holds.
+func (d *DB) protoDocument(pd *firestorepb.Document) (doc *document, err error) {
+	var v interface{}
+	doc = &document{id: pd.Name[strings.LastIndex(pd.Name, "/")+1:], data: make(map[string]interface{}, len(pd.Fields))}
+	for name, pv := range pd.Fields {
+		if v, err = d.protoValue(pv); err != nil {
+			return nil, err
+		}
+		doc.data[name] = v
 	}
 	return
 }
 
-func applyQueryConditions(in *firestore.CollectionRef, conditions []depot.EntityCondition) (q firestore.Query) {
+func (d *DB) protoValue(pv *firestorepb.Value) (v interface{}, err error) {
+	switch t := pv.GetValueType().(type) {
+	case *firestorepb.Value_NullValue:
+		return nil, nil
+	case *firestorepb.Value_BooleanValue:
+		return t.BooleanValue, nil
+	case *firestorepb.Value_IntegerValue:
+		return t.IntegerValue, nil
+	case *firestorepb.Value_DoubleValue:
+		return t.DoubleValue, nil
+	case *firestorepb.Value_TimestampValue:
+		return t.TimestampValue.AsTime(), nil
+	case *firestorepb.Value_StringValue:
+		return t.StringValue, nil
+	case *firestorepb.Value_BytesValue:
+		return t.BytesValue, nil
+	case *firestorepb.Value_ReferenceValue:
+		_, path, ok := strings.Cut(t.ReferenceValue, "/documents/")
+		if !ok {
+			return nil, fmt.Errorf("firestore: malformed document path %q", t.ReferenceValue)
+		}
+		return d.firestore.Doc(path), nil
+	case *firestorepb.Value_GeoPointValue:
+		return t.GeoPointValue, nil
+	case *firestorepb.Value_ArrayValue:
+		values := make([]interface{}, len(t.ArrayValue.Values))
+		for i := range t.ArrayValue.Values {
+			if values[i], err = d.protoValue(t.ArrayValue.Values[i]); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	case *firestorepb.Value_MapValue:
+		m := make(map[string]interface{}, len(t.MapValue.Fields))
+		for name, fv := range t.MapValue.Fields {
+			if m[name], err = d.protoValue(fv); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("firestore: unknown value type %T", pv.GetValueType())
+}
+
+func applyQueryConditions(in *firestore.CollectionRef, conditions []depot.EntityCondition) (q firestore.Query, err error) {
+	var f firestore.EntityFilter
 	q = in.Query
 	for _, c := range conditions {
-		switch c.Op.(type) {
-		case *depot.EqualCondition:
-			q = q.Where(c.Name, "=", c.Value)
-		case *depot.NotEqualCondition:
-			q = q.Where(c.Name, "!=", c.Value)
-		case *depot.LTCondition:
-			q = q.Where(c.Name, "<", c.Value)
-		case *depot.LTECondition:
-			q = q.Where(c.Name, "<=", c.Value)
-		case *depot.GTCondition:
-			q = q.Where(c.Name, ">", c.Value)
-		case *depot.GTECondition:
-			q = q.Where(c.Name, ">=", c.Value)
-		case *depot.ExistsCondition:
-			q = q.Where(c.Name, "!=", "-DEAD-BEEF-")
-		default:
-			q = q.Where(c.Name, "==", c.Value)
+		if f, err = entityFilter(c); err != nil {
+			return
 		}
+		q = q.WhereEntity(f)
 	}
 	return
 }
 
-func applyQueryDirectives(in firestore.Query, ops []depot.QueryOp, sortField string) (q firestore.Query, offset int, err error) {
-	q = in
+// entityFilter returns the filter matching c. Firestore has no negation, so the
+// condition a Not wraps is negated instead.
+func entityFilter(c depot.EntityCondition) (f firestore.EntityFilter, err error) {
+	switch v := c.Op.(type) {
+	case *depot.OrCondition, *depot.AndCondition:
+		filters := make([]firestore.EntityFilter, len(c.Conditions))
+		for i, sub := range c.Conditions {
+			if filters[i], err = entityFilter(sub); err != nil {
+				return
+			}
+		}
+		if _, ok := v.(*depot.OrCondition); ok {
+			return firestore.OrFilter{Filters: filters}, nil
+		}
+		return firestore.AndFilter{Filters: filters}, nil
+	case *depot.NotCondition:
+		if c, err = c.Conditions[0].Negate(); err != nil {
+			return
+		}
+		return entityFilter(c)
+	case *depot.NotEqualCondition:
+		return pathFilter(c.Name, "!=", c.Value), nil
+	case *depot.LTCondition:
+		return pathFilter(c.Name, "<", c.Value), nil
+	case *depot.LTECondition:
+		return pathFilter(c.Name, "<=", c.Value), nil
+	case *depot.GTCondition:
+		return pathFilter(c.Name, ">", c.Value), nil
+	case *depot.GTECondition:
+		return pathFilter(c.Name, ">=", c.Value), nil
+	case *depot.ExistsCondition:
+		return pathFilter(c.Name, "!=", "-DEAD-BEEF-"), nil
+	case *depot.InCondition:
+		return pathFilter(c.Name, "in", v.List()), nil
+	case *depot.NotInCondition:
+		return pathFilter(c.Name, "not-in", v.List()), nil
+	case *depot.BeginsWithCondition:
+		return firestore.AndFilter{Filters: []firestore.EntityFilter{
+			pathFilter(c.Name, ">=", c.Value),
+			pathFilter(c.Name, "<", depot.PrefixEnd(c.Value)),
+		}}, nil
+	case *depot.ContainsCondition:
+		// Firestore only finds elements of arrays, and one per query.
+		value := c.Value
+		if list := depot.ListValues(value); list != nil {
+			if len(list) != 1 {
+				return nil, depot.ErrUnsupported
+			}
+			value = list[0]
+		}
+		return pathFilter(c.Name, "array-contains", value), nil
+	case *depot.BetweenCondition:
+		return firestore.AndFilter{Filters: []firestore.EntityFilter{
+			pathFilter(c.Name, ">=", v.From()),
+			pathFilter(c.Name, "<=", v.To()),
+		}}, nil
+	}
+	return pathFilter(c.Name, "==", c.Value), nil
+}
+
+func pathFilter(name, operator string, value interface{}) firestore.EntityFilter {
+	return firestore.PropertyPathFilter{Path: fieldPath(name), Operator: operator, Value: value}
+}
+
+// selection returns the fields of the projection and those the query is
+// ordered by, which page tokens are made of.
+func selection(projection, orders []string) []string {
+	fields := append([]string(nil), projection...)
+	for _, f := range orders {
+		if f != firestore.DocumentID && !slices.Contains(fields, f) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// fieldPath splits the dotted path name into the FieldPath it addresses.
+func fieldPath(name string) firestore.FieldPath {
+	return depot.PathParts(name)
+}
+
+// queryDirectives returns the fields a query is ordered by, which always end
+// with the document ID so that a page can start after any document. Queries
+// without Asc or Desc are ordered the way Firestore orders them implicitly.
+func queryDirectives(ops []depot.QueryOp, conditions []depot.EntityCondition, sortField string) (limit int, page string, orders []string, dir firestore.Direction, err error) {
+	var ordered bool
+	dir = firestore.Asc
 	for _, op := range ops {
 		if d, ok := op.(depot.QueryDirective); ok {
 			switch v := d.(type) {
 			case *depot.LimitQueryDirective:
-				q = q.Limit(v.Limit)
+				limit = v.Limit
 			case *depot.PageQueryDirective:
-				if v.Page != "" {
-					if offset, err = strconv.Atoi(v.Page); err != nil {
-						return
-					}
-					q = q.Offset(offset)
-				}
+				page = v.Page
 			case *depot.AscQueryDirective:
 				if sortField == "" {
-					return q, 0, depot.ErrNoSortField
+					return 0, "", nil, dir, depot.ErrNoSortField
 				}
-				q = q.OrderBy(sortField, firestore.Asc)
+				ordered, dir = true, firestore.Asc
 			case *depot.DescQueryDirective:
 				if sortField == "" {
-					return q, 0, depot.ErrNoSortField
+					return 0, "", nil, dir, depot.ErrNoSortField
+				}
+				ordered, dir = true, firestore.Desc
+			}
+		}
+	}
+	if ordered {
+		orders = append(orders, sortField)
+	} else if f := inequalityField(conditions); f != "" {
+		orders = append(orders, f)
+	}
+	orders = append(orders, firestore.DocumentID)
+	return
+}
+
+func inequalityField(conditions []depot.EntityCondition) string {
+	for _, c := range conditions {
+		switch c.Op.(type) {
+		case *depot.NotEqualCondition, *depot.LTCondition, *depot.LTECondition,
+			*depot.GTCondition, *depot.GTECondition, *depot.ExistsCondition, *depot.NotInCondition,
+			*depot.BetweenCondition, *depot.BeginsWithCondition:
+			return c.Name
+		case *depot.OrCondition, *depot.AndCondition:
+			if f := inequalityField(c.Conditions); f != "" {
+				return f
+			}
+		case *depot.NotCondition:
+			if n, err := c.Conditions[0].Negate(); err == nil {
+				if f := inequalityField([]depot.EntityCondition{n}); f != "" {
+					return f
 				}
-				q = q.OrderBy(sortField, firestore.Desc)
 			}
 		}
 	}
+	return ""
+}
+
+func encodePage(last *document, orders []string) (encoded string, err error) {
+	var (
+		bytes []byte
+		m     = make(map[string]interface{})
+	)
+	for _, f := range orders {
+		if f == firestore.DocumentID {
+			m[f] = last.id
+		} else {
+			m[f] = depot.StoredValue(last.data, f)
+		}
+	}
+	if bytes, err = json.Marshal(m); err != nil {
+		return
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// decodePage returns the values of the ordering fields in a page token, typed
+// like the entity's fields, or the values at their paths, so they compare the
+// same way as stored values.
+func decodePage(s depot.Struct, t reflect.Type, encoded string, orders []string) (values []interface{}, err error) {
+	var (
+		bytes []byte
+		m     map[string]json.RawMessage
+	)
+	if bytes, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+		return nil, ErrInvalidPageCursor
+	}
+	if err = json.Unmarshal(bytes, &m); err != nil {
+		return nil, ErrInvalidPageCursor
+	}
+	for _, f := range orders {
+		var ft reflect.Type
+		raw, ok := m[f]
+		if !ok {
+			return nil, ErrInvalidPageCursor
+		}
+		if f == firestore.DocumentID {
+			ft = reflect.TypeOf("")
+		} else if depot.IsPath(f) {
+			if ft, err = depot.PathType(t, f); err != nil {
+				return nil, ErrInvalidPageCursor
+			}
+		}
+		for i := range s {
+			if s[i].Name != f {
+				continue
+			}
+			ft = t.Field(i).Type
+			if s[i].TTL {
+				ft = reflect.TypeOf(time.Time{})
+			}
+		}
+		if ft == nil {
+			return nil, ErrInvalidPageCursor
+		}
+		v := reflect.New(ft)
+		if err = json.Unmarshal(raw, v.Interface()); err != nil {
+			return nil, ErrInvalidPageCursor
+		}
+		values = append(values, v.Elem().Interface())
+	}
+	return
+}
+
+type transaction struct {
+	d     *DB
+	tx    *firestore.Transaction
+	bumps depot.VersionBumps
+}
+
+var _ depot.Tx = &transaction{}
+
+func (t *transaction) Get(table string, entity interface{}, op ...depot.GetOp) (err error) {
+	var (
+		doc *firestore.DocumentRef
+		res *firestore.DocumentSnapshot
+	)
+	// A transaction reads the present state it is to write over.
+	if !depot.ReadTime(op).IsZero() {
+		return depot.ErrUnsupported
+	}
+	if doc, err = t.d.doc(table, entity); err != nil {
+		return
+	}
+	if res, err = t.tx.Get(doc); status.Code(err) == codes.NotFound {
+		return depot.ErrEntityNotFound
+	} else if err != nil {
+		return
+	}
+	return loadDocument(res, entity, op)
+}
+
+func (t *transaction) Put(table string, entity interface{}, op ...depot.Condition) (err error) {
+	var (
+		doc       *firestore.DocumentRef
+		m         map[string]interface{}
+		version   depot.Version
+		versioned bool
+		ts        depot.Timestamps
+	)
+	if doc, err = t.d.doc(table, entity); err != nil {
+		return
+	}
+	if ts, err = depot.EntityTimestamps(entity); err != nil {
+		return
+	}
+	if version, versioned, err = t.check(doc, entity, op, &ts); err != nil {
+		return
+	}
+	if m, err = depot.EntityMap(entity, true); err != nil {
+		return
+	}
+	if versioned {
+		m[version.Name] = version.Next()
+		t.bumps.Add(entity, version.Next())
+	}
+	ts.Write(m)
+	if err = ts.Set(entity); err != nil {
+		return
+	}
+	return t.tx.Set(doc, m)
+}
+
+func (t *transaction) Delete(table string, entity interface{}, op ...depot.Condition) (err error) {
+	var doc *firestore.DocumentRef
+	if doc, err = t.d.doc(table, entity); err != nil {
+		return
+	}
+	if _, _, err = t.check(doc, entity, op, nil); err != nil {
+		return
+	}
+	return t.tx.Delete(doc)
+}
+
+func (t *transaction) Create(table string, entity interface{}) (err error) {
+	var (
+		doc       *firestore.DocumentRef
+		m         map[string]interface{}
+		version   depot.Version
+		versioned bool
+		ts        depot.Timestamps
+	)
+	if doc, err = t.d.doc(table, entity); err != nil {
+		return
+	}
+	if m, err = depot.EntityMap(entity, true); err != nil {
+		return
+	}
+	if version, versioned, err = depot.EntityVersion(entity); err != nil {
+		return
+	}
+	if ts, err = depot.EntityTimestamps(entity); err != nil {
+		return
+	}
+	if versioned {
+		m[version.Name] = version.Next()
+		t.bumps.Add(entity, version.Next())
+	}
+	ts.Create(t.d.clock())
+	ts.Write(m)
+	if err = ts.Set(entity); err != nil {
+		return
+	}
+	return t.tx.Create(doc, m)
+}
+
+func (t *transaction) Update(table string, entity interface{}, op ...depot.UpdateOp) error {
+	return t.update(table, entity, op)
+}
+
+// check reads doc and fails with depot.ErrVersionConflict unless it holds the
+// version of entity, and with a *depot.ConditionError unless it satisfies the
+// conditions. A put passes its timestamps, which are stamped over the created
+// time doc holds.
+func (t *transaction) check(doc *firestore.DocumentRef, entity interface{}, op []depot.Condition, ts *depot.Timestamps) (version depot.Version, versioned bool, err error) {
+	var (
+		conditions []depot.EntityCondition
+		res        *firestore.DocumentSnapshot
+		existing   map[string]interface{}
+	)
+	if version, versioned, err = depot.EntityVersion(entity); err != nil {
+		return
+	}
+	if len(op) > 0 || versioned || (ts != nil && ts.Created != "") {
+		if res, err = t.tx.Get(doc); status.Code(err) == codes.NotFound {
+			err = nil
+		} else if err != nil {
+			return
+		} else {
+			existing = res.Data()
+		}
+	}
+	if ts != nil {
+		ts.Put(t.d.clock(), existing)
+	}
+	if versioned {
+		if err = depot.CheckVersion(version, existing); err != nil {
+			return
+		}
+	}
+	if len(op) == 0 {
+		return
+	}
+	if conditions, err = depot.EntityPreconditions(entity, op); err != nil {
+		return
+	}
+	err = depot.CheckConditions(conditions, existing)
+	return
+}
+
+func keyMap(k depot.Key) (m map[string]interface{}) {
+	m = make(map[string]interface{})
+	m[k.Partition.Name] = k.Partition.Value
+	if k.Sort.Name != "" {
+		m[k.Sort.Name] = k.Sort.Value
+	}
 	return
 }
 
@@ -0,0 +1,138 @@
+package firestore
+
+import (
+	"context"
+	"encoding/base64"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"github.com/andyday/depot"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type entry struct {
+	TenantID  string                 `depot:"tenantId,pk"`
+	ID        int64                  `depot:"id,sk"`
+	Count     int64                  `depot:"count"`
+	CreatedAt time.Time              `depot:"createdAt"`
+	Stats     stats                  `depot:"stats"`
+	Data      map[string]interface{} `depot:"data"`
+}
+
+type stats struct {
+	Views int64 `depot:"views"`
+}
+
+func TestQueryDirectives(t *testing.T) {
+	eq := []depot.EntityCondition{{Name: "tenantId", Op: depot.Equal("tenantId")}}
+	gt := append(eq, depot.EntityCondition{Name: "count", Op: depot.GreaterThan("count")})
+
+	limit, page, orders, dir, err := queryDirectives([]depot.QueryOp{depot.Limit(2), depot.Page("p")}, eq, "id")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, limit)
+	assert.Equal(t, "p", page)
+	assert.Equal(t, []string{firestore.DocumentID}, orders)
+	assert.Equal(t, firestore.Asc, dir)
+
+	_, _, orders, dir, err = queryDirectives([]depot.QueryOp{depot.Desc()}, gt, "id")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", firestore.DocumentID}, orders)
+	assert.Equal(t, firestore.Desc, dir)
+
+	_, _, orders, _, err = queryDirectives(nil, gt, "id")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"count", firestore.DocumentID}, orders)
+
+	_, _, _, _, err = queryDirectives([]depot.QueryOp{depot.Asc()}, eq, "")
+	assert.ErrorIs(t, err, depot.ErrNoSortField)
+}
+
+func TestDecodePage(t *testing.T) {
+	s, v, err := depot.GetStruct(reflect.ValueOf(entry{}))
+	assert.NoError(t, err)
+	orders := []string{"createdAt", "id", firestore.DocumentID}
+	encode := func(json string) string { return base64.RawURLEncoding.EncodeToString([]byte(json)) }
+
+	values, err := decodePage(s, v.Type(), encode(`{"createdAt":"2024-01-02T03:04:05Z","id":7,"__name__":"tenant:7"}`), orders)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), int64(7), "tenant:7"}, values)
+
+	for _, page := range []string{"!!!", encode("[]"), encode(`{"id":7}`), encode(`{"createdAt":1,"id":7,"__name__":"x"}`)} {
+		_, err = decodePage(s, v.Type(), page, orders)
+		assert.ErrorIs(t, err, ErrInvalidPageCursor, page)
+	}
+	_, err = decodePage(s, v.Type(), encode(`{"missing":1,"__name__":"x"}`), []string{"missing", firestore.DocumentID})
+	assert.ErrorIs(t, err, ErrInvalidPageCursor)
+}
+
+func TestDecodePagePath(t *testing.T) {
+	s, v, err := depot.GetStruct(reflect.ValueOf(entry{}))
+	assert.NoError(t, err)
+	orders := []string{"stats.views", "data.c", firestore.DocumentID}
+	page := base64.RawURLEncoding.EncodeToString([]byte(`{"stats.views":3,"data.c":"d","__name__":"tenant:7"}`))
+
+	values, err := decodePage(s, v.Type(), page, orders)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(3), "d", "tenant:7"}, values)
+
+	page = base64.RawURLEncoding.EncodeToString([]byte(`{"stats.missing":3,"__name__":"tenant:7"}`))
+	_, err = decodePage(s, v.Type(), page, []string{"stats.missing", firestore.DocumentID})
+	assert.ErrorIs(t, err, ErrInvalidPageCursor)
+}
+
+func TestProtoDocument(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	doc, err := (&DB{}).protoDocument(&firestorepb.Document{
+		Name: "projects/p/databases/d/documents/entry/tenant:7",
+		Fields: map[string]*firestorepb.Value{
+			"id":        {ValueType: &firestorepb.Value_IntegerValue{IntegerValue: 7}},
+			"createdAt": {ValueType: &firestorepb.Value_TimestampValue{TimestampValue: timestamppb.New(created)}},
+			"stats": {ValueType: &firestorepb.Value_MapValue{MapValue: &firestorepb.MapValue{Fields: map[string]*firestorepb.Value{
+				"views": {ValueType: &firestorepb.Value_IntegerValue{IntegerValue: 3}},
+			}}}},
+			"data": {ValueType: &firestorepb.Value_MapValue{MapValue: &firestorepb.MapValue{Fields: map[string]*firestorepb.Value{
+				"tags": {ValueType: &firestorepb.Value_ArrayValue{ArrayValue: &firestorepb.ArrayValue{Values: []*firestorepb.Value{
+					{ValueType: &firestorepb.Value_StringValue{StringValue: "a"}},
+					{ValueType: &firestorepb.Value_NullValue{}},
+				}}}},
+			}}}},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "tenant:7", doc.id)
+	assert.Equal(t, map[string]interface{}{
+		"id":        int64(7),
+		"createdAt": created,
+		"stats":     map[string]interface{}{"views": int64(3)},
+		"data":      map[string]interface{}{"tags": []interface{}{"a", nil}},
+	}, doc.data)
+
+	var e entry
+	assert.NoError(t, depot.EntityFromMap(doc.data, &e, true))
+	assert.Equal(t, entry{ID: 7, CreatedAt: created, Stats: stats{Views: 3}, Data: map[string]interface{}{"tags": []interface{}{"a", nil}}}, e)
+
+	_, err = (&DB{}).protoDocument(&firestorepb.Document{Fields: map[string]*firestorepb.Value{"x": {}}})
+	assert.Error(t, err)
+}
+
+func TestReaderClient(t *testing.T) {
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "localhost:8681")
+	ctx := context.Background()
+	d, err := NewDatabase(ctx, "project", "")
+	assert.NoError(t, err)
+	assert.Nil(t, d.reader)
+
+	reader, err := d.readerClient(ctx)
+	assert.NoError(t, err)
+	assert.NotNil(t, reader)
+	again, err := d.readerClient(ctx)
+	assert.NoError(t, err)
+	assert.Same(t, reader, again)
+
+	assert.NoError(t, d.Close())
+	assert.Nil(t, d.reader)
+}
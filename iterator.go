@@ -0,0 +1,55 @@
+package depot
+
+import "context"
+
+// Iterator walks every entity matched by a query, fetching pages from the
+// backend only as they are needed.
+//
+//	it := widgets.Iterate(ctx, "", filter, depot.Limit(100))
+//	for it.Next() {
+//		process(it.Value())
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+type Iterator[T any] struct {
+	ctx   context.Context
+	fetch func(ctx context.Context, page string) ([]T, string, error)
+	page  string
+	done  bool
+	buf   []T
+	value T
+	err   error
+}
+
+// Next advances to the next entity, returning false once the results are
+// exhausted, the context is done or a page could not be fetched.
+func (it *Iterator[T]) Next() bool {
+	if it.err == nil {
+		it.err = it.ctx.Err()
+	}
+	for it.err == nil && len(it.buf) == 0 {
+		if it.done {
+			return false
+		}
+		if it.buf, it.page, it.err = it.fetch(it.ctx, it.page); it.err != nil {
+			return false
+		}
+		it.done = it.page == ""
+	}
+	if it.err != nil {
+		return false
+	}
+	it.value, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+// Value returns the entity Next advanced to.
+func (it *Iterator[T]) Value() T {
+	return it.value
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
@@ -1,6 +1,11 @@
 package depot
 
-import "fmt"
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
 
 type numbers interface {
 	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~float32 | ~float64
@@ -151,6 +156,15 @@ func NegateValue(in interface{}) interface{} {
 	}
 }
 
+func ValueIn(a interface{}, list []interface{}) bool {
+	for _, b := range list {
+		if ValuesEqual(a, b) {
+			return true
+		}
+	}
+	return false
+}
+
 func ValuesEqual(a, b interface{}) bool {
 	switch v := b.(type) {
 	case int8:
@@ -179,8 +193,11 @@ func ValuesEqual(a, b interface{}) bool {
 		return numbersEqual(a, v)
 	case string:
 		return fmt.Sprintf("%v", a) == v
+	case time.Time:
+		at, ok := a.(time.Time)
+		return ok && at.Equal(v)
 	default:
-		return a == b
+		return reflect.DeepEqual(a, b)
 	}
 }
 
@@ -246,8 +263,11 @@ func ValuesNotEqual(a, b interface{}) bool {
 		return numbersNotEqual(a, v)
 	case string:
 		return fmt.Sprintf("%v", a) != v
+	case time.Time:
+		at, ok := a.(time.Time)
+		return !ok || !at.Equal(v)
 	default:
-		return a != b
+		return !reflect.DeepEqual(a, b)
 	}
 }
 
@@ -315,6 +335,9 @@ func ValuesGreaterThan(a, b interface{}) bool {
 			return false
 		}
 		return fmt.Sprintf("%v", a) > v
+	case time.Time:
+		at, ok := a.(time.Time)
+		return ok && at.After(v)
 	default:
 		return false
 	}
@@ -384,6 +407,9 @@ func ValuesGreaterThanOrEqual(a, b interface{}) bool {
 			return false
 		}
 		return fmt.Sprintf("%v", a) >= v
+	case time.Time:
+		at, ok := a.(time.Time)
+		return ok && !at.Before(v)
 	default:
 		return false
 	}
@@ -453,6 +479,9 @@ func ValuesLessThan(a, b interface{}) bool {
 			return false
 		}
 		return fmt.Sprintf("%v", a) < v
+	case time.Time:
+		at, ok := a.(time.Time)
+		return ok && at.Before(v)
 	default:
 		return false
 	}
@@ -522,6 +551,9 @@ func ValuesLessThanOrEqual(a, b interface{}) bool {
 			return false
 		}
 		return fmt.Sprintf("%v", a) <= v
+	case time.Time:
+		at, ok := a.(time.Time)
+		return ok && !at.After(v)
 	default:
 		return false
 	}
@@ -559,3 +591,121 @@ func numbersLessThanOrEqual[T numbers](a interface{}, b T) bool {
 		return false
 	}
 }
+
+// ListValues returns the elements of the slice or array v, or nil when v is
+// neither.
+func ListValues(v interface{}) (list []interface{}) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil
+	}
+	for i := 0; i < rv.Len(); i++ {
+		list = append(list, rv.Index(i).Interface())
+	}
+	return
+}
+
+// AppendValues returns the stored list a with the elements of b added to its
+// end, typed like b.
+func AppendValues(a, b interface{}) interface{} {
+	return listLike(b, append(ListValues(a), ListValues(b)...))
+}
+
+// PrependValues returns the stored list a with the elements of b added to its
+// start, typed like b.
+func PrependValues(a, b interface{}) interface{} {
+	return listLike(b, append(ListValues(b), ListValues(a)...))
+}
+
+// UnionValues returns the stored list a with the elements of b it lacks added
+// to its end, typed like b.
+func UnionValues(a, b interface{}) interface{} {
+	list := ListValues(a)
+	for _, v := range ListValues(b) {
+		if !listContains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return listLike(b, list)
+}
+
+// DifferenceValues returns the stored list a without the elements of b, typed
+// like b.
+func DifferenceValues(a, b interface{}) interface{} {
+	var (
+		list    []interface{}
+		removed = ListValues(b)
+	)
+	for _, v := range ListValues(a) {
+		if !listContains(removed, v) {
+			list = append(list, v)
+		}
+	}
+	return listLike(b, list)
+}
+
+// ValueContains reports whether the stored value a contains b, as a substring
+// when a is a string or as elements when a is a list. A list b is contained
+// when all of its elements are.
+func ValueContains(a, b interface{}) bool {
+	if s, ok := a.(string); ok {
+		sub, ok := b.(string)
+		return ok && strings.Contains(s, sub)
+	}
+	list := ListValues(a)
+	if list == nil {
+		return false
+	}
+	if elems := ListValues(b); elems != nil {
+		for _, e := range elems {
+			if !listContains(list, e) {
+				return false
+			}
+		}
+		return true
+	}
+	return listContains(list, b)
+}
+
+func listContains(list []interface{}, v interface{}) bool {
+	for _, e := range list {
+		if ValuesEqual(Normalize(e), Normalize(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+// listLike returns list as a slice of the type of like, falling back to
+// []interface{} when its elements do not fit.
+func listLike(like interface{}, list []interface{}) interface{} {
+	t := reflect.TypeOf(like)
+	if t == nil || t.Kind() != reflect.Slice {
+		return list
+	}
+	out := reflect.MakeSlice(t, 0, len(list))
+	for _, e := range list {
+		ev := reflect.ValueOf(e)
+		switch {
+		case !ev.IsValid():
+			return list
+		case ev.Type().AssignableTo(t.Elem()):
+		case isNumberKind(ev.Kind()) && isNumberKind(t.Elem().Kind()):
+			ev = ev.Convert(t.Elem())
+		default:
+			return list
+		}
+		out = reflect.Append(out, ev)
+	}
+	return out.Interface()
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
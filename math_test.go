@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -217,3 +218,48 @@ func TestValuesLessThanOrEqual(t *testing.T) {
 		}
 	}
 }
+
+func TestValuesTime(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Minute)
+	assert.True(t, ValuesEqual(now, now.UTC()))
+	assert.False(t, ValuesEqual(earlier, now))
+	assert.False(t, ValuesEqual(nil, now))
+	assert.True(t, ValuesNotEqual(earlier, now))
+	assert.True(t, ValuesNotEqual(nil, now))
+	assert.False(t, ValuesNotEqual(now, now.UTC()))
+	assert.True(t, ValuesGreaterThan(now, earlier))
+	assert.False(t, ValuesGreaterThan(earlier, now))
+	assert.True(t, ValuesGreaterThanOrEqual(now, now))
+	assert.False(t, ValuesGreaterThanOrEqual(nil, now))
+	assert.True(t, ValuesLessThan(earlier, now))
+	assert.False(t, ValuesLessThan(now, earlier))
+	assert.True(t, ValuesLessThanOrEqual(now, now))
+	assert.False(t, ValuesLessThanOrEqual(nil, now))
+}
+
+func TestValuesEqualUncomparable(t *testing.T) {
+	assert.True(t, ValuesEqual([]string{"a"}, []string{"a"}))
+	assert.False(t, ValuesEqual([]string{"a"}, []string{"b"}))
+	assert.False(t, ValuesNotEqual([]string{"a"}, []string{"a"}))
+	assert.True(t, ValuesNotEqual([]string{"a"}, []string{"b"}))
+}
+
+func TestListValues(t *testing.T) {
+	assert.Equal(t, []interface{}{1, 2}, ListValues([]int{1, 2}))
+	assert.Equal(t, []interface{}{"a"}, ListValues([1]string{"a"}))
+	assert.Nil(t, ListValues("a"))
+	assert.Nil(t, ListValues(nil))
+
+	assert.Equal(t, []string{"a", "b", "c"}, AppendValues([]string{"a", "b"}, []string{"c"}))
+	assert.Equal(t, []string{"c", "a", "b"}, PrependValues([]string{"a", "b"}, []string{"c"}))
+	assert.Equal(t, []string{"c"}, AppendValues(nil, []string{"c"}))
+	assert.Equal(t, []string{"a", "b", "c"}, UnionValues([]string{"a", "b"}, []string{"b", "c", "c"}))
+	assert.Equal(t, []string{"a"}, DifferenceValues([]string{"a", "b", "b"}, []string{"b", "z"}))
+	assert.Equal(t, []string{}, DifferenceValues(nil, []string{"b"}))
+
+	// Stored lists come back from some backends untyped.
+	assert.Equal(t, []int{1, 2, 3}, AppendValues([]interface{}{int64(1), int64(2)}, []int{3}))
+	assert.Equal(t, []int{1, 2}, UnionValues([]interface{}{int64(1)}, []int{1, 2}))
+	assert.Equal(t, []interface{}{"a", 1}, AppendValues([]interface{}{"a"}, []int{1}))
+}
@@ -0,0 +1,809 @@
+package memory
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andyday/depot"
+)
+
+var (
+	ErrIndexNotFound = errors.New("memory: index not found")
+	// Deprecated: Update returns depot.ErrConditionFailed like every backend.
+	ErrConditionFailed   = depot.ErrConditionFailed
+	ErrInvalidPageCursor = fmt.Errorf("memory: %w", depot.ErrInvalidPage)
+)
+
+type item map[string]interface{}
+
+type tables map[string]map[string]item
+
+type DB struct {
+	mu     sync.RWMutex
+	tables tables
+	pages  depot.PageCodec
+	clock  func() time.Time
+}
+
+var _ depot.Database = &DB{}
+
+func NewDatabase(opts ...depot.Option) *DB {
+	o := depot.NewOptions(opts...)
+	return &DB{tables: make(tables), pages: o.PageCodec, clock: o.Clock}
+}
+
+func (d *DB) Get(_ context.Context, table string, entity interface{}, op ...depot.GetOp) (err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.tables.get(table, entity, op)
+}
+
+func (d *DB) Put(_ context.Context, table string, entity interface{}, op ...depot.Condition) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tables.put(table, entity, op, d.clock())
+}
+
+func (d *DB) Delete(_ context.Context, table string, entity interface{}, op ...depot.Condition) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tables.delete(table, entity, op)
+}
+
+func (d *DB) Create(_ context.Context, table string, entity interface{}) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tables.create(table, entity, d.clock())
+}
+
+func (d *DB) Update(_ context.Context, table string, entity interface{}, op ...depot.UpdateOp) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tables.update(table, entity, op, d.clock())
+}
+
+// RunInTransaction holds the write lock while fn runs, so fn must only use tx
+// and never d itself.
+func (d *DB) RunInTransaction(_ context.Context, fn func(tx depot.Tx) error) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tx := &transaction{tables: d.tables.copy(), clock: d.clock}
+	if err = fn(tx); err != nil {
+		return
+	}
+	d.tables = tx.tables
+	return
+}
+
+func (d *DB) Query(_ context.Context, table, kind string, entity interface{}, entities interface{}, op ...depot.QueryOp) (nextPage string, err error) {
+	var (
+		conditions []depot.EntityCondition
+		sortField  string
+		s          depot.Struct
+		ev         reflect.Value
+		indexed    []string
+		order      []string
+		limit      int
+		start      item
+		desc       bool
+		matched    []item
+		projection []string
+	)
+	if !depot.ReadTime(op).IsZero() {
+		return "", depot.ErrUnsupported
+	}
+	if sortField, conditions, err = depot.EntityConditions(kind, entity, op); err != nil {
+		return
+	}
+	shape := depot.PageShape(table, kind, conditions, op)
+	if op, err = depot.DecodePageOps(d.pages, shape, op); err != nil {
+		return
+	}
+	if s, ev, err = depot.GetStruct(reflect.ValueOf(entity)); err != nil {
+		return
+	}
+	if indexed, order, err = indexFields(s, kind); err != nil {
+		return
+	}
+	if limit, start, desc, err = queryDirectives(s, ev.Type(), op, sortField); err != nil {
+		return
+	}
+	if fields := depot.Selected(op); fields != nil {
+		if projection, err = depot.Projection(kind, entity, fields); err != nil {
+			return
+		}
+	}
+
+	matched = d.matching(table, indexed, conditions)
+	sort.Slice(matched, func(i, j int) bool {
+		if desc {
+			return compareItems(matched[j], matched[i], order) < 0
+		}
+		return compareItems(matched[i], matched[j], order) < 0
+	})
+	if start != nil {
+		i := sort.Search(len(matched), func(i int) bool {
+			if desc {
+				return compareItems(start, matched[i], order) > 0
+			}
+			return compareItems(matched[i], start, order) > 0
+		})
+		matched = matched[i:]
+	}
+	if limit > 0 && len(matched) > limit {
+		matched = matched[:limit]
+		if nextPage, err = encodePage(matched[limit-1], order); err != nil {
+			return
+		}
+		if nextPage, err = d.pages.Encode(shape, nextPage); err != nil {
+			return
+		}
+	}
+	return nextPage, unmarshalEntities(matched, entities, projection)
+}
+
+func (d *DB) Aggregate(_ context.Context, table, kind string, entity interface{}, agg depot.Aggregate, field string, op ...depot.QueryOp) (result float64, err error) {
+	var (
+		conditions []depot.EntityCondition
+		s          depot.Struct
+		indexed    []string
+		a          = depot.Aggregator{Aggregate: agg, Field: field}
+	)
+	if !depot.ReadTime(op).IsZero() {
+		return 0, depot.ErrUnsupported
+	}
+	if err = depot.CheckAggregate(entity, agg, field); err != nil {
+		return
+	}
+	if _, conditions, err = depot.EntityConditions(kind, entity, op); err != nil {
+		return
+	}
+	if s, _, err = depot.GetStruct(reflect.ValueOf(entity)); err != nil {
+		return
+	}
+	if indexed, _, err = indexFields(s, kind); err != nil {
+		return
+	}
+	for _, it := range d.matching(table, indexed, conditions) {
+		a.Add(it)
+	}
+	return a.Result(), nil
+}
+
+// matching returns copies of the items of the table that appear in the index
+// and meet the conditions.
+func (d *DB) matching(table string, indexed []string, conditions []depot.EntityCondition) (matched []item) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, it := range d.tables[table] {
+		if it.indexed(indexed) && it.matches(conditions) {
+			matched = append(matched, it.clone())
+		}
+	}
+	return
+}
+
+func (d *DB) BatchGet(_ context.Context, table string, entities interface{}) (err error) {
+	var (
+		v  reflect.Value
+		it item
+		ok bool
+	)
+	if v, err = depot.EntitySlice(entities); err != nil {
+		return
+	}
+	found := make([]bool, v.Len())
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for i := 0; i < v.Len(); i++ {
+		var k string
+		entity := v.Index(i).Addr().Interface()
+		if k, err = loadKey(entity); err != nil {
+			return
+		}
+		if it, ok = d.tables[table][k]; !ok {
+			continue
+		}
+		if err = depot.EntityFromMap(it.clone(), entity, false); err != nil {
+			return
+		}
+		found[i] = true
+	}
+	return depot.KeepEntities(v, found)
+}
+
+func (d *DB) BatchPut(_ context.Context, table string, entities interface{}) (err error) {
+	var (
+		v     reflect.Value
+		keys  []string
+		items []item
+	)
+	if v, err = depot.EntitySlice(entities); err != nil {
+		return
+	}
+	for i := 0; i < v.Len(); i++ {
+		var (
+			k string
+			m map[string]interface{}
+		)
+		entity := v.Index(i).Addr().Interface()
+		if k, err = loadKey(entity); err != nil {
+			return
+		}
+		if m, err = depot.EntityMap(entity, false); err != nil {
+			return
+		}
+		keys = append(keys, k)
+		items = append(items, item(m).clone())
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tbl := d.tables.table(table)
+	for i, k := range keys {
+		tbl[k] = items[i]
+	}
+	return
+}
+
+func (d *DB) BatchDelete(_ context.Context, table string, entities interface{}) (err error) {
+	var (
+		v    reflect.Value
+		keys []string
+	)
+	if v, err = depot.EntitySlice(entities); err != nil {
+		return
+	}
+	for i := 0; i < v.Len(); i++ {
+		var k string
+		if k, err = loadKey(v.Index(i).Addr().Interface()); err != nil {
+			return
+		}
+		keys = append(keys, k)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, k := range keys {
+		delete(d.tables[table], k)
+	}
+	return
+}
+
+func (t tables) table(table string) map[string]item {
+	tbl, ok := t[table]
+	if !ok {
+		tbl = make(map[string]item)
+		t[table] = tbl
+	}
+	return tbl
+}
+
+// copy returns a copy of every table. Stored items are never modified in place
+// so they are shared rather than cloned.
+func (t tables) copy() tables {
+	out := make(tables, len(t))
+	for name, tbl := range t {
+		c := make(map[string]item, len(tbl))
+		for k, it := range tbl {
+			c[k] = it
+		}
+		out[name] = c
+	}
+	return out
+}
+
+func (t tables) get(table string, entity interface{}, op []depot.GetOp) (err error) {
+	var (
+		k          string
+		projection []string
+	)
+	// Only the present state is kept, so there is nothing to read as of a time.
+	if !depot.ReadTime(op).IsZero() {
+		return depot.ErrUnsupported
+	}
+	if k, err = loadKey(entity); err != nil {
+		return
+	}
+	if fields := depot.Selected(op); fields != nil {
+		if projection, err = depot.Projection("", entity, fields); err != nil {
+			return
+		}
+	}
+	it, ok := t[table][k]
+	if !ok {
+		return depot.ErrEntityNotFound
+	}
+	m := map[string]interface{}(it.clone())
+	if projection != nil {
+		if err = depot.ResetEntity(entity); err != nil {
+			return
+		}
+		m = depot.ProjectMap(m, projection)
+	}
+	return depot.EntityFromMap(m, entity, false)
+}
+
+func (t tables) put(table string, entity interface{}, op []depot.Condition, now time.Time) (err error) {
+	var (
+		k         string
+		m         map[string]interface{}
+		v         depot.Version
+		versioned bool
+		ts        depot.Timestamps
+	)
+	if k, err = loadKey(entity); err != nil {
+		return
+	}
+	if ts, err = depot.EntityTimestamps(entity); err != nil {
+		return
+	}
+	if v, versioned, err = t.check(table, k, entity, op); err != nil {
+		return
+	}
+	if versioned {
+		if err = depot.SetEntityVersion(entity, v.Next()); err != nil {
+			return
+		}
+	}
+	if ts.Stamped() {
+		ts.Put(now, t[table][k])
+		if err = ts.Set(entity); err != nil {
+			return
+		}
+	}
+	if m, err = depot.EntityMap(entity, false); err != nil {
+		return
+	}
+	ts.Write(m)
+	t.table(table)[k] = item(m).clone()
+	return
+}
+
+func (t tables) delete(table string, entity interface{}, op []depot.Condition) (err error) {
+	var k string
+	if k, err = loadKey(entity); err != nil {
+		return
+	}
+	if _, _, err = t.check(table, k, entity, op); err != nil {
+		return
+	}
+	it, ok := t[table][k]
+	if !ok {
+		return
+	}
+	delete(t[table], k)
+	return depot.EntityFromMap(it.clone(), entity, false)
+}
+
+// check fails with depot.ErrVersionConflict unless the item stored under k
+// holds the version of entity, and with a *depot.ConditionError unless it
+// satisfies the conditions.
+func (t tables) check(table, k string, entity interface{}, op []depot.Condition) (v depot.Version, versioned bool, err error) {
+	var conditions []depot.EntityCondition
+	if v, versioned, err = depot.EntityVersion(entity); err != nil {
+		return
+	}
+	if versioned {
+		if err = depot.CheckVersion(v, t[table][k]); err != nil {
+			return
+		}
+	}
+	if len(op) == 0 {
+		return
+	}
+	if conditions, err = depot.EntityPreconditions(entity, op); err != nil {
+		return
+	}
+	err = depot.CheckConditions(conditions, t[table][k])
+	return
+}
+
+func (t tables) create(table string, entity interface{}, now time.Time) (err error) {
+	var (
+		k         string
+		m         map[string]interface{}
+		v         depot.Version
+		versioned bool
+		ts        depot.Timestamps
+	)
+	if k, err = loadKey(entity); err != nil {
+		return
+	}
+	if v, versioned, err = depot.EntityVersion(entity); err != nil {
+		return
+	}
+	if ts, err = depot.EntityTimestamps(entity); err != nil {
+		return
+	}
+	tbl := t.table(table)
+	if _, ok := tbl[k]; ok {
+		return depot.ErrEntityAlreadyExists
+	}
+	if versioned {
+		if err = depot.SetEntityVersion(entity, v.Next()); err != nil {
+			return
+		}
+	}
+	if ts.Stamped() {
+		ts.Create(now)
+		if err = ts.Set(entity); err != nil {
+			return
+		}
+	}
+	if m, err = depot.EntityMap(entity, false); err != nil {
+		return
+	}
+	ts.Write(m)
+	tbl[k] = item(m).clone()
+	return
+}
+
+func (t tables) update(table string, entity interface{}, op []depot.UpdateOp, now time.Time) (err error) {
+	var (
+		key       depot.Key
+		updates   []depot.Update
+		v         depot.Version
+		versioned bool
+		ts        depot.Timestamps
+	)
+	if key, err = depot.EntityKey(entity); err != nil {
+		return
+	}
+	if updates, err = depot.EntityUpdates(entity, op); err != nil {
+		return
+	}
+	if v, versioned, err = depot.EntityVersion(entity); err != nil {
+		return
+	}
+	if ts, err = depot.EntityTimestamps(entity); err != nil {
+		return
+	}
+	ts.Update(now)
+	updates = append(updates, ts.Updates()...)
+	k := key.String()
+
+	tbl := t.table(table)
+	existing, ok := tbl[k]
+	if ok {
+		existing = existing.clone()
+	} else {
+		existing = keyItem(key)
+	}
+	if versioned {
+		if err = depot.CheckVersion(v, existing); err != nil {
+			return
+		}
+	}
+	if err = depot.CheckConditions(depot.UpdateConditions(updates), existing); err != nil {
+		return
+	}
+	if versioned {
+		existing[v.Name] = v.Next()
+	}
+	for _, u := range updates {
+		v := depot.StoredValue(existing, u.Name)
+		switch u.Op.(type) {
+		case *depot.AddUpdateOp:
+			v = depot.AddValues(v, u.Value)
+		case *depot.SubtractUpdateOp:
+			v = depot.SubtractValues(v, u.Value)
+		case *depot.RemoveUpdateOp:
+			if err = depot.DeletePathValue(existing, u.Name); err != nil {
+				return
+			}
+			continue
+		case *depot.AppendUpdateOp:
+			v = depot.AppendValues(v, clone(u.Value))
+		case *depot.PrependUpdateOp:
+			v = depot.PrependValues(v, clone(u.Value))
+		case *depot.AddToSetUpdateOp:
+			v = depot.UnionValues(v, clone(u.Value))
+		case *depot.RemoveFromSetUpdateOp:
+			v = depot.DifferenceValues(v, u.Value)
+		case *depot.SetIfAbsentUpdateOp, *depot.MaxUpdateOp, *depot.MinUpdateOp:
+			if !depot.UpdateApplies(u, v) {
+				continue
+			}
+			v = clone(u.Value)
+		case depot.Condition:
+			// condition fields are only checked, never written
+			continue
+		default:
+			v = clone(u.Value)
+		}
+		if err = depot.SetPathValue(existing, u.Name, v); err != nil {
+			return
+		}
+	}
+	tbl[k] = existing
+	if err = depot.ClearFields(entity, depot.RemovedFields(updates)...); err != nil {
+		return
+	}
+	return depot.EntityFromMap(existing.clone(), entity, false)
+}
+
+type transaction struct {
+	tables tables
+	clock  func() time.Time
+}
+
+var _ depot.Tx = &transaction{}
+
+func (t *transaction) Get(table string, entity interface{}, op ...depot.GetOp) error {
+	return t.tables.get(table, entity, op)
+}
+
+func (t *transaction) Put(table string, entity interface{}, op ...depot.Condition) error {
+	return t.tables.put(table, entity, op, t.clock())
+}
+
+func (t *transaction) Delete(table string, entity interface{}, op ...depot.Condition) error {
+	return t.tables.delete(table, entity, op)
+}
+
+func (t *transaction) Create(table string, entity interface{}) error {
+	return t.tables.create(table, entity, t.clock())
+}
+
+func (t *transaction) Update(table string, entity interface{}, op ...depot.UpdateOp) error {
+	return t.tables.update(table, entity, op, t.clock())
+}
+
+func (it item) clone() item {
+	out := make(item, len(it))
+	for k, v := range it {
+		if v != nil {
+			out[k] = clone(v)
+		}
+	}
+	return out
+}
+
+func (it item) indexed(fields []string) bool {
+	for _, f := range fields {
+		if depot.Normalize(it[f]) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (it item) matches(conditions []depot.EntityCondition) bool {
+	for _, c := range conditions {
+		if !c.Matches(it) {
+			return false
+		}
+	}
+	return true
+}
+
+func compareItems(a, b item, order []string) int {
+	for _, f := range order {
+		av, bv := depot.Normalize(a[f]), depot.Normalize(b[f])
+		switch {
+		case av == nil && bv == nil:
+			continue
+		case av == nil:
+			return -1
+		case bv == nil:
+			return 1
+		case depot.ValuesLessThan(av, bv):
+			return -1
+		case depot.ValuesGreaterThan(av, bv):
+			return 1
+		}
+	}
+	return 0
+}
+
+// indexFields returns the fields an item must have to appear in the named
+// index and the fields that determine the order of the query results.
+func indexFields(s depot.Struct, kind string) (indexed, order []string, err error) {
+	var pk, sk, ipk, isk string
+	for _, f := range s {
+		switch f.Mode {
+		case depot.FieldModePartition:
+			pk = f.Name
+		case depot.FieldModeSort:
+			sk = f.Name
+		}
+		for _, index := range f.Indexes {
+			if index.Name != kind {
+				continue
+			}
+			indexed = append(indexed, f.Name)
+			switch index.Mode {
+			case depot.FieldModePartition:
+				ipk = f.Name
+			case depot.FieldModeSort:
+				isk = f.Name
+			}
+		}
+	}
+	if kind != "" && len(indexed) == 0 {
+		return nil, nil, ErrIndexNotFound
+	}
+	for _, f := range []string{ipk, isk, pk, sk} {
+		if f != "" && !contains(order, f) {
+			order = append(order, f)
+		}
+	}
+	return
+}
+
+func queryDirectives(s depot.Struct, t reflect.Type, ops []depot.QueryOp, sortField string) (limit int, start item, desc bool, err error) {
+	for _, op := range ops {
+		if d, ok := op.(depot.QueryDirective); ok {
+			switch v := d.(type) {
+			case *depot.LimitQueryDirective:
+				limit = v.Limit
+			case *depot.PageQueryDirective:
+				if start, err = decodePage(s, t, v.Page); err != nil {
+					return
+				}
+			case *depot.AscQueryDirective:
+				if sortField == "" {
+					return 0, nil, false, depot.ErrNoSortField
+				}
+				desc = false
+			case *depot.DescQueryDirective:
+				if sortField == "" {
+					return 0, nil, false, depot.ErrNoSortField
+				}
+				desc = true
+			}
+		}
+	}
+	return
+}
+
+// encodePage captures the ordering fields of the last item of a page so the
+// next page can resume directly after it even if that item has since been
+// removed.
+func encodePage(last item, order []string) (encoded string, err error) {
+	var (
+		bytes []byte
+		m     = make(map[string]interface{})
+	)
+	for _, f := range order {
+		m[f] = last[f]
+	}
+	if bytes, err = json.Marshal(m); err != nil {
+		return
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+func decodePage(s depot.Struct, t reflect.Type, encoded string) (decoded item, err error) {
+	if encoded == "" {
+		return
+	}
+	var (
+		bytes []byte
+		m     map[string]json.RawMessage
+	)
+	if bytes, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+		return nil, ErrInvalidPageCursor
+	}
+	if err = json.Unmarshal(bytes, &m); err != nil {
+		return nil, ErrInvalidPageCursor
+	}
+	decoded = make(item)
+	for i, f := range s {
+		raw, ok := m[f.Name]
+		if !ok {
+			continue
+		}
+		v := reflect.New(t.Field(i).Type)
+		if err = json.Unmarshal(raw, v.Interface()); err != nil {
+			return nil, ErrInvalidPageCursor
+		}
+		decoded[f.Name] = v.Elem().Interface()
+	}
+	return
+}
+
+// unmarshalEntities appends the items to the list entities, keeping only the
+// fields in projection unless it is nil.
+func unmarshalEntities(items []item, entities interface{}, projection []string) (err error) {
+	lv := reflect.ValueOf(entities)
+	if lv.Kind() == reflect.Ptr {
+		lv = lv.Elem()
+	}
+	if lv.Kind() != reflect.Slice || !lv.CanSet() {
+		return depot.ErrInvalidEntityType
+	}
+	et := lv.Type().Elem()
+	for _, it := range items {
+		m := map[string]interface{}(it)
+		if projection != nil {
+			m = depot.ProjectMap(m, projection)
+		}
+		ev := reflect.New(et)
+		if err = depot.EntityFromMap(m, ev.Interface(), false); err != nil {
+			return
+		}
+		lv.Set(reflect.Append(lv, ev.Elem()))
+	}
+	return
+}
+
+func loadKey(entity interface{}) (k string, err error) {
+	var key depot.Key
+	if key, err = depot.EntityKey(entity); err != nil {
+		return
+	}
+	return key.String(), nil
+}
+
+func keyItem(key depot.Key) item {
+	it := item{key.Partition.Name: key.Partition.Value}
+	if key.Sort.Name != "" {
+		it[key.Sort.Name] = key.Sort.Value
+	}
+	return it
+}
+
+// clone deep copies maps, slices and pointers so stored items never share
+// memory with the entities passed in or handed back to callers.
+func clone(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return cloneValue(reflect.ValueOf(v)).Interface()
+}
+
+func cloneValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(cloneValue(v.Elem()))
+		return out
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(cloneValue(v.Elem()))
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(cloneValue(v.Index(i)))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), cloneValue(iter.Value()))
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
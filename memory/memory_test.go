@@ -0,0 +1,335 @@
+package memory_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andyday/depot"
+	"github.com/andyday/depot/depottest"
+	"github.com/andyday/depot/memory"
+	"github.com/stretchr/testify/suite"
+)
+
+type Widget struct {
+	TenantID   string            `depot:"tenantId,pk,index:created:pk,index:expired:pk"`
+	ID         string            `depot:"id,sk"`
+	Name       string            `depot:"name"`
+	Status     string            `depot:"status,omitempty"`
+	Count      int64             `depot:"count,omitempty"`
+	Refs       []string          `depot:"refs,omitempty"`
+	Data       map[string]string `depot:"data,omitempty"`
+	Expiration *time.Time        `depot:"expiration,omitempty,index:expired:sk"`
+	CreatedAt  time.Time         `depot:"createdAt,index:created:sk"`
+}
+
+type MemorySuite struct {
+	suite.Suite
+	ctx     context.Context
+	db      *memory.DB
+	widgets depot.Table[Widget]
+	now     time.Time
+}
+
+func TestMemorySuite(t *testing.T) {
+	suite.Run(t, new(MemorySuite))
+}
+
+func (s *MemorySuite) SetupTest() {
+	s.ctx = context.Background()
+	s.db = memory.NewDatabase()
+	s.widgets = depot.NewTable[Widget](s.db, "widget")
+	s.now = time.Now().UTC()
+}
+
+func (s *MemorySuite) seed(n int) (widgets []Widget) {
+	for i := 0; i < n; i++ {
+		w := Widget{
+			TenantID:  "tenant",
+			ID:        string(rune('a' + i)),
+			Name:      "Widget",
+			Count:     int64(i),
+			CreatedAt: s.now.Add(time.Duration(i) * time.Minute),
+		}
+		if i%2 == 0 {
+			w.Expiration = &w.CreatedAt
+		}
+		_, err := s.widgets.Put(s.ctx, w)
+		s.Require().NoError(err)
+		widgets = append(widgets, w)
+	}
+	return
+}
+
+func (s *MemorySuite) TestPutGet() {
+	expected := Widget{
+		TenantID:  "tenant",
+		ID:        "widget",
+		Name:      "Widget",
+		Refs:      []string{"a"},
+		Data:      map[string]string{"b": "c"},
+		CreatedAt: s.now,
+	}
+	_, err := s.widgets.Put(s.ctx, expected)
+	s.NoError(err)
+
+	widget, err := s.widgets.Get(s.ctx, Widget{TenantID: "tenant", ID: "widget"})
+	s.NoError(err)
+	s.Equal(expected, widget)
+
+	widget.Refs[0] = "changed"
+	widget.Data["b"] = "changed"
+	widget, err = s.widgets.Get(s.ctx, Widget{TenantID: "tenant", ID: "widget"})
+	s.NoError(err)
+	s.Equal(expected, widget)
+
+	_, err = s.widgets.Get(s.ctx, Widget{TenantID: "tenant", ID: "missing"})
+	s.ErrorIs(err, depot.ErrEntityNotFound)
+
+	s.ErrorIs(s.db.Put(s.ctx, "widget", "widget"), depot.ErrInvalidEntityType)
+	s.ErrorIs(s.db.Get(s.ctx, "widget", "widget"), depot.ErrInvalidEntityType)
+}
+
+func (s *MemorySuite) TestCreate() {
+	expected := Widget{TenantID: "tenant", ID: "widget", Name: "Widget", CreatedAt: s.now}
+	_, err := s.widgets.Create(s.ctx, expected)
+	s.NoError(err)
+	_, err = s.widgets.Create(s.ctx, expected)
+	s.ErrorIs(err, depot.ErrEntityAlreadyExists)
+	s.ErrorIs(s.db.Create(s.ctx, "widget", "widget"), depot.ErrInvalidEntityType)
+}
+
+func (s *MemorySuite) TestDelete() {
+	expected := Widget{TenantID: "tenant", ID: "widget", Name: "Widget", CreatedAt: s.now}
+	_, err := s.widgets.Put(s.ctx, expected)
+	s.NoError(err)
+
+	deleted, err := s.widgets.Delete(s.ctx, Widget{TenantID: "tenant", ID: "widget"})
+	s.NoError(err)
+	s.Equal(expected, deleted)
+	_, err = s.widgets.Get(s.ctx, Widget{TenantID: "tenant", ID: "widget"})
+	s.ErrorIs(err, depot.ErrEntityNotFound)
+
+	_, err = s.widgets.Delete(s.ctx, Widget{TenantID: "tenant", ID: "widget"})
+	s.NoError(err)
+	s.ErrorIs(s.db.Delete(s.ctx, "widget", "widget"), depot.ErrInvalidEntityType)
+}
+
+func (s *MemorySuite) TestUpdate() {
+	_, err := s.widgets.Create(s.ctx, Widget{TenantID: "tenant", ID: "widget", Name: "Widget", Count: 5, CreatedAt: s.now})
+	s.NoError(err)
+
+	widget, err := s.widgets.Update(s.ctx, Widget{TenantID: "tenant", ID: "widget", Name: "Renamed", Count: 2}, depot.Add("count"))
+	s.NoError(err)
+	s.Equal("Renamed", widget.Name)
+	s.Equal(int64(7), widget.Count)
+	s.Equal(s.now, widget.CreatedAt)
+
+	widget, err = s.widgets.Update(s.ctx, Widget{TenantID: "tenant", ID: "widget", Count: 3}, depot.Subtract("count"))
+	s.NoError(err)
+	s.Equal(int64(4), widget.Count)
+
+	widget, err = s.widgets.Update(s.ctx, Widget{TenantID: "tenant", ID: "widget", Name: "Equal", Count: 4}, depot.Equal("count"))
+	s.NoError(err)
+	s.Equal("Equal", widget.Name)
+	s.Equal(int64(4), widget.Count)
+
+	_, err = s.widgets.Update(s.ctx, Widget{TenantID: "tenant", ID: "widget", Name: "Failed", Count: 4}, depot.GreaterThan("count"))
+	s.ErrorIs(err, depot.ErrConditionFailed)
+	var ce *depot.ConditionError
+	if s.ErrorAs(err, &ce) {
+		s.Equal([]string{"count"}, ce.Fields)
+	}
+	widget, err = s.widgets.Get(s.ctx, Widget{TenantID: "tenant", ID: "widget"})
+	s.NoError(err)
+	s.Equal("Equal", widget.Name)
+
+	widget, err = s.widgets.Update(s.ctx, Widget{TenantID: "tenant", ID: "new", Count: 2}, depot.Subtract("count"))
+	s.NoError(err)
+	s.Equal(Widget{TenantID: "tenant", ID: "new", Count: -2}, widget)
+
+	s.ErrorIs(s.db.Update(s.ctx, "widget", "widget"), depot.ErrInvalidEntityType)
+}
+
+func (s *MemorySuite) TestQuery() {
+	expected := s.seed(5)
+
+	widgets, page, err := s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant"})
+	s.NoError(err)
+	s.Empty(page)
+	s.Equal(expected, widgets)
+
+	widgets, page, err = s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant", Count: 2}, depot.GreaterThanOrEqual("count"), depot.Desc())
+	s.NoError(err)
+	s.Empty(page)
+	s.Equal([]Widget{expected[4], expected[3], expected[2]}, widgets)
+
+	widgets, _, err = s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant", Count: 2}, depot.NotEqual("count"))
+	s.NoError(err)
+	s.Equal([]Widget{expected[1], expected[3], expected[4]}, widgets)
+
+	widgets, _, err = s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant", ID: "c"}, depot.LessThanOrEqual("id"), depot.Exists("expiration"))
+	s.NoError(err)
+	s.Equal([]Widget{expected[0], expected[2]}, widgets)
+
+	widgets, _, err = s.widgets.Query(s.ctx, "", Widget{TenantID: "other"})
+	s.NoError(err)
+	s.Empty(widgets)
+}
+
+func (s *MemorySuite) TestQueryIndex() {
+	expected := s.seed(5)
+
+	widgets, _, err := s.widgets.Query(s.ctx, "created", Widget{TenantID: "tenant", CreatedAt: s.now.Add(90 * time.Second)}, depot.GreaterThan("createdAt"), depot.Desc())
+	s.NoError(err)
+	s.Equal([]Widget{expected[4], expected[3], expected[2]}, widgets)
+
+	widgets, _, err = s.widgets.Query(s.ctx, "expired", Widget{TenantID: "tenant"}, depot.Asc())
+	s.NoError(err)
+	s.Equal([]Widget{expected[0], expected[2], expected[4]}, widgets)
+
+	_, _, err = s.widgets.Query(s.ctx, "missing", Widget{TenantID: "tenant"})
+	s.ErrorIs(err, memory.ErrIndexNotFound)
+}
+
+func (s *MemorySuite) TestQueryPages() {
+	expected := s.seed(5)
+
+	widgets, page, err := s.widgets.Query(s.ctx, "created", Widget{TenantID: "tenant"}, depot.Limit(2), depot.Desc())
+	s.NoError(err)
+	s.NotEmpty(page)
+	s.Equal([]Widget{expected[4], expected[3]}, widgets)
+
+	_, err = s.widgets.Delete(s.ctx, expected[3])
+	s.NoError(err)
+
+	widgets, page, err = s.widgets.Query(s.ctx, "created", Widget{TenantID: "tenant"}, depot.Limit(2), depot.Desc(), depot.Page(page))
+	s.NoError(err)
+	s.NotEmpty(page)
+	s.Equal([]Widget{expected[2], expected[1]}, widgets)
+
+	widgets, page, err = s.widgets.Query(s.ctx, "created", Widget{TenantID: "tenant"}, depot.Limit(2), depot.Desc(), depot.Page(page))
+	s.NoError(err)
+	s.Empty(page)
+	s.Equal([]Widget{expected[0]}, widgets)
+
+	widgets, page, err = s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant"}, depot.Limit(3))
+	s.NoError(err)
+	s.Equal([]Widget{expected[0], expected[1], expected[2]}, widgets)
+	widgets, page, err = s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant"}, depot.Limit(3), depot.Page(page))
+	s.NoError(err)
+	s.Empty(page)
+	s.Equal([]Widget{expected[4]}, widgets)
+
+	_, _, err = s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant"}, depot.Page("!"))
+	s.ErrorIs(err, depot.ErrInvalidPage)
+
+	// Cursors are checked even when the page codec passes them through as is.
+	raw := depot.NewTable[Widget](memory.NewDatabase(depot.WithPageCodec(rawPages{})), "widget")
+	for _, page := range []string{"!", "bm90anNvbg", "eyJpZCI6MX0"} {
+		_, _, err = raw.Query(s.ctx, "", Widget{TenantID: "tenant"}, depot.Page(page))
+		s.ErrorIs(err, memory.ErrInvalidPageCursor, page)
+	}
+}
+
+func (s *MemorySuite) TestQueryPageBinding() {
+	s.seed(5)
+	_, page, err := s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant"}, depot.Limit(2))
+	s.NoError(err)
+
+	_, _, err = s.widgets.Query(s.ctx, "", Widget{TenantID: "other"}, depot.Limit(2), depot.Page(page))
+	s.ErrorIs(err, depot.ErrInvalidPage)
+	_, _, err = s.widgets.Query(s.ctx, "created", Widget{TenantID: "tenant"}, depot.Limit(2), depot.Page(page))
+	s.ErrorIs(err, depot.ErrInvalidPage)
+	_, _, err = s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant"}, depot.Limit(2), depot.Desc(), depot.Page(page))
+	s.ErrorIs(err, depot.ErrInvalidPage)
+	_, _, err = s.widgets.Query(s.ctx, "", Widget{TenantID: "tenant"}, depot.Limit(3), depot.Page(page))
+	s.NoError(err)
+}
+
+// rawPages is a page codec that hands out backend pages unchanged.
+type rawPages struct{}
+
+func (rawPages) Encode(_ []byte, page string) (string, error)  { return page, nil }
+func (rawPages) Decode(_ []byte, token string) (string, error) { return token, nil }
+
+func (s *MemorySuite) TestQueryErrors() {
+	type Unsorted struct {
+		ID string `depot:"id,pk"`
+	}
+	var list []Unsorted
+	_, err := s.db.Query(s.ctx, "unsorted", "", &Unsorted{ID: "a"}, &list, depot.Asc())
+	s.ErrorIs(err, depot.ErrNoSortField)
+	_, err = s.db.Query(s.ctx, "unsorted", "", &Unsorted{ID: "a"}, &list, depot.Desc())
+	s.ErrorIs(err, depot.ErrNoSortField)
+	_, err = s.db.Query(s.ctx, "unsorted", "", "entity", &list)
+	s.ErrorIs(err, depot.ErrInvalidEntityType)
+
+	s.NoError(s.db.Put(s.ctx, "unsorted", &Unsorted{ID: "a"}))
+	_, err = s.db.Query(s.ctx, "unsorted", "", &Unsorted{ID: "a"}, list)
+	s.ErrorIs(err, depot.ErrInvalidEntityType)
+}
+
+func (s *MemorySuite) TestTimestampsClock() {
+	type Note struct {
+		ID        string     `depot:"id,pk"`
+		Body      string     `depot:"body"`
+		CreatedAt time.Time  `depot:"createdAt,created"`
+		UpdatedAt *time.Time `depot:"updatedAt,updated"`
+	}
+	now := s.now
+	db := memory.NewDatabase(depot.WithClock(func() time.Time { return now }))
+	notes := depot.NewTable[Note](db, "note")
+	created := now
+
+	note, err := notes.Create(s.ctx, Note{ID: "a", Body: "created"})
+	s.NoError(err)
+	s.Equal(created, note.CreatedAt)
+	s.Equal(created, *note.UpdatedAt)
+
+	now = now.Add(time.Minute)
+	note, err = notes.Put(s.ctx, Note{ID: "a", Body: "put"})
+	s.NoError(err)
+	s.Equal(created, note.CreatedAt)
+	s.Equal(now, *note.UpdatedAt)
+
+	now = now.Add(time.Minute)
+	note, err = notes.Update(s.ctx, Note{ID: "a", Body: "updated", CreatedAt: now})
+	s.NoError(err)
+	s.Equal(created, note.CreatedAt)
+	s.Equal(now, *note.UpdatedAt)
+
+	// Nothing is stored, so the created time the entity carries is kept.
+	note, err = notes.Put(s.ctx, Note{ID: "b", CreatedAt: created})
+	s.NoError(err)
+	s.Equal(created, note.CreatedAt)
+	s.Equal(now, *note.UpdatedAt)
+}
+
+// Gadget is only read concurrently, so its first reads fill the struct cache
+// from many goroutines at once.
+type Gadget struct {
+	ID   string `depot:"id,pk"`
+	Name string `depot:"name"`
+}
+
+func (s *MemorySuite) TestConcurrentReads() {
+	db := memory.NewDatabase()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := db.Get(s.ctx, "gadget", &Gadget{ID: "a"})
+			s.ErrorIs(err, depot.ErrEntityNotFound)
+			_, err = db.Query(s.ctx, "gadget", "", &Gadget{ID: "a"}, &[]Gadget{})
+			s.NoError(err)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConformance(t *testing.T) {
+	depottest.RunConformance(t, func() depot.Database { return memory.NewDatabase() })
+}
@@ -22,6 +22,226 @@ func (_m *Database) EXPECT() *Database_Expecter {
 	return &Database_Expecter{mock: &_m.Mock}
 }
 
+// Aggregate provides a mock function with given fields: ctx, table, kind, entity, agg, field, op
+func (_m *Database) Aggregate(ctx context.Context, table string, kind string, entity interface{}, agg depot.Aggregate, field string, op ...depot.QueryOp) (float64, error) {
+	_va := make([]interface{}, len(op))
+	for _i := range op {
+		_va[_i] = op[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, table, kind, entity, agg, field)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Aggregate")
+	}
+
+	var r0 float64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, interface{}, depot.Aggregate, string, ...depot.QueryOp) (float64, error)); ok {
+		return rf(ctx, table, kind, entity, agg, field, op...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, interface{}, depot.Aggregate, string, ...depot.QueryOp) float64); ok {
+		r0 = rf(ctx, table, kind, entity, agg, field, op...)
+	} else {
+		r0 = ret.Get(0).(float64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, interface{}, depot.Aggregate, string, ...depot.QueryOp) error); ok {
+		r1 = rf(ctx, table, kind, entity, agg, field, op...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Database_Aggregate_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Aggregate'
+type Database_Aggregate_Call struct {
+	*mock.Call
+}
+
+// Aggregate is a helper method to define mock.On call
+//   - ctx context.Context
+//   - table string
+//   - kind string
+//   - entity interface{}
+//   - agg depot.Aggregate
+//   - field string
+//   - op ...depot.QueryOp
+func (_e *Database_Expecter) Aggregate(ctx interface{}, table interface{}, kind interface{}, entity interface{}, agg interface{}, field interface{}, op ...interface{}) *Database_Aggregate_Call {
+	return &Database_Aggregate_Call{Call: _e.mock.On("Aggregate",
+		append([]interface{}{ctx, table, kind, entity, agg, field}, op...)...)}
+}
+
+func (_c *Database_Aggregate_Call) Run(run func(ctx context.Context, table string, kind string, entity interface{}, agg depot.Aggregate, field string, op ...depot.QueryOp)) *Database_Aggregate_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]depot.QueryOp, len(args)-6)
+		for i, a := range args[6:] {
+			if a != nil {
+				variadicArgs[i] = a.(depot.QueryOp)
+			}
+		}
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(interface{}), args[4].(depot.Aggregate), args[5].(string), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *Database_Aggregate_Call) Return(_a0 float64, _a1 error) *Database_Aggregate_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Database_Aggregate_Call) RunAndReturn(run func(context.Context, string, string, interface{}, depot.Aggregate, string, ...depot.QueryOp) (float64, error)) *Database_Aggregate_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// BatchDelete provides a mock function with given fields: ctx, table, entities
+func (_m *Database) BatchDelete(ctx context.Context, table string, entities interface{}) error {
+	ret := _m.Called(ctx, table, entities)
+
+	if len(ret) == 0 {
+		panic("no return value specified for BatchDelete")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, interface{}) error); ok {
+		r0 = rf(ctx, table, entities)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Database_BatchDelete_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'BatchDelete'
+type Database_BatchDelete_Call struct {
+	*mock.Call
+}
+
+// BatchDelete is a helper method to define mock.On call
+//   - ctx context.Context
+//   - table string
+//   - entities interface{}
+func (_e *Database_Expecter) BatchDelete(ctx interface{}, table interface{}, entities interface{}) *Database_BatchDelete_Call {
+	return &Database_BatchDelete_Call{Call: _e.mock.On("BatchDelete", ctx, table, entities)}
+}
+
+func (_c *Database_BatchDelete_Call) Run(run func(ctx context.Context, table string, entities interface{})) *Database_BatchDelete_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(interface{}))
+	})
+	return _c
+}
+
+func (_c *Database_BatchDelete_Call) Return(_a0 error) *Database_BatchDelete_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Database_BatchDelete_Call) RunAndReturn(run func(context.Context, string, interface{}) error) *Database_BatchDelete_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// BatchGet provides a mock function with given fields: ctx, table, entities
+func (_m *Database) BatchGet(ctx context.Context, table string, entities interface{}) error {
+	ret := _m.Called(ctx, table, entities)
+
+	if len(ret) == 0 {
+		panic("no return value specified for BatchGet")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, interface{}) error); ok {
+		r0 = rf(ctx, table, entities)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Database_BatchGet_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'BatchGet'
+type Database_BatchGet_Call struct {
+	*mock.Call
+}
+
+// BatchGet is a helper method to define mock.On call
+//   - ctx context.Context
+//   - table string
+//   - entities interface{}
+func (_e *Database_Expecter) BatchGet(ctx interface{}, table interface{}, entities interface{}) *Database_BatchGet_Call {
+	return &Database_BatchGet_Call{Call: _e.mock.On("BatchGet", ctx, table, entities)}
+}
+
+func (_c *Database_BatchGet_Call) Run(run func(ctx context.Context, table string, entities interface{})) *Database_BatchGet_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(interface{}))
+	})
+	return _c
+}
+
+func (_c *Database_BatchGet_Call) Return(_a0 error) *Database_BatchGet_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Database_BatchGet_Call) RunAndReturn(run func(context.Context, string, interface{}) error) *Database_BatchGet_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// BatchPut provides a mock function with given fields: ctx, table, entities
+func (_m *Database) BatchPut(ctx context.Context, table string, entities interface{}) error {
+	ret := _m.Called(ctx, table, entities)
+
+	if len(ret) == 0 {
+		panic("no return value specified for BatchPut")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, interface{}) error); ok {
+		r0 = rf(ctx, table, entities)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Database_BatchPut_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'BatchPut'
+type Database_BatchPut_Call struct {
+	*mock.Call
+}
+
+// BatchPut is a helper method to define mock.On call
+//   - ctx context.Context
+//   - table string
+//   - entities interface{}
+func (_e *Database_Expecter) BatchPut(ctx interface{}, table interface{}, entities interface{}) *Database_BatchPut_Call {
+	return &Database_BatchPut_Call{Call: _e.mock.On("BatchPut", ctx, table, entities)}
+}
+
+func (_c *Database_BatchPut_Call) Run(run func(ctx context.Context, table string, entities interface{})) *Database_BatchPut_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(interface{}))
+	})
+	return _c
+}
+
+func (_c *Database_BatchPut_Call) Return(_a0 error) *Database_BatchPut_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Database_BatchPut_Call) RunAndReturn(run func(context.Context, string, interface{}) error) *Database_BatchPut_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Create provides a mock function with given fields: ctx, table, entity
 func (_m *Database) Create(ctx context.Context, table string, entity interface{}) error {
 	ret := _m.Called(ctx, table, entity)
@@ -70,17 +290,24 @@ func (_c *Database_Create_Call) RunAndReturn(run func(context.Context, string, i
 	return _c
 }
 
-// Delete provides a mock function with given fields: ctx, table, entity
-func (_m *Database) Delete(ctx context.Context, table string, entity interface{}) error {
-	ret := _m.Called(ctx, table, entity)
+// Delete provides a mock function with given fields: ctx, table, entity, op
+func (_m *Database) Delete(ctx context.Context, table string, entity interface{}, op ...depot.Condition) error {
+	_va := make([]interface{}, len(op))
+	for _i := range op {
+		_va[_i] = op[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, table, entity)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
 
 	if len(ret) == 0 {
 		panic("no return value specified for Delete")
 	}
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, interface{}) error); ok {
-		r0 = rf(ctx, table, entity)
+	if rf, ok := ret.Get(0).(func(context.Context, string, interface{}, ...depot.Condition) error); ok {
+		r0 = rf(ctx, table, entity, op...)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -97,13 +324,21 @@ type Database_Delete_Call struct {
 //   - ctx context.Context
 //   - table string
 //   - entity interface{}
-func (_e *Database_Expecter) Delete(ctx interface{}, table interface{}, entity interface{}) *Database_Delete_Call {
-	return &Database_Delete_Call{Call: _e.mock.On("Delete", ctx, table, entity)}
+//   - op ...depot.Condition
+func (_e *Database_Expecter) Delete(ctx interface{}, table interface{}, entity interface{}, op ...interface{}) *Database_Delete_Call {
+	return &Database_Delete_Call{Call: _e.mock.On("Delete",
+		append([]interface{}{ctx, table, entity}, op...)...)}
 }
 
-func (_c *Database_Delete_Call) Run(run func(ctx context.Context, table string, entity interface{})) *Database_Delete_Call {
+func (_c *Database_Delete_Call) Run(run func(ctx context.Context, table string, entity interface{}, op ...depot.Condition)) *Database_Delete_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string), args[2].(interface{}))
+		variadicArgs := make([]depot.Condition, len(args)-3)
+		for i, a := range args[3:] {
+			if a != nil {
+				variadicArgs[i] = a.(depot.Condition)
+			}
+		}
+		run(args[0].(context.Context), args[1].(string), args[2].(interface{}), variadicArgs...)
 	})
 	return _c
 }
@@ -113,22 +348,29 @@ func (_c *Database_Delete_Call) Return(_a0 error) *Database_Delete_Call {
 	return _c
 }
 
-func (_c *Database_Delete_Call) RunAndReturn(run func(context.Context, string, interface{}) error) *Database_Delete_Call {
+func (_c *Database_Delete_Call) RunAndReturn(run func(context.Context, string, interface{}, ...depot.Condition) error) *Database_Delete_Call {
 	_c.Call.Return(run)
 	return _c
 }
 
-// Get provides a mock function with given fields: ctx, table, entity
-func (_m *Database) Get(ctx context.Context, table string, entity interface{}) error {
-	ret := _m.Called(ctx, table, entity)
+// Get provides a mock function with given fields: ctx, table, entity, op
+func (_m *Database) Get(ctx context.Context, table string, entity interface{}, op ...depot.GetOp) error {
+	_va := make([]interface{}, len(op))
+	for _i := range op {
+		_va[_i] = op[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, table, entity)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
 
 	if len(ret) == 0 {
 		panic("no return value specified for Get")
 	}
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, interface{}) error); ok {
-		r0 = rf(ctx, table, entity)
+	if rf, ok := ret.Get(0).(func(context.Context, string, interface{}, ...depot.GetOp) error); ok {
+		r0 = rf(ctx, table, entity, op...)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -145,13 +387,21 @@ type Database_Get_Call struct {
 //   - ctx context.Context
 //   - table string
 //   - entity interface{}
-func (_e *Database_Expecter) Get(ctx interface{}, table interface{}, entity interface{}) *Database_Get_Call {
-	return &Database_Get_Call{Call: _e.mock.On("Get", ctx, table, entity)}
+//   - op ...depot.GetOp
+func (_e *Database_Expecter) Get(ctx interface{}, table interface{}, entity interface{}, op ...interface{}) *Database_Get_Call {
+	return &Database_Get_Call{Call: _e.mock.On("Get",
+		append([]interface{}{ctx, table, entity}, op...)...)}
 }
 
-func (_c *Database_Get_Call) Run(run func(ctx context.Context, table string, entity interface{})) *Database_Get_Call {
+func (_c *Database_Get_Call) Run(run func(ctx context.Context, table string, entity interface{}, op ...depot.GetOp)) *Database_Get_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string), args[2].(interface{}))
+		variadicArgs := make([]depot.GetOp, len(args)-3)
+		for i, a := range args[3:] {
+			if a != nil {
+				variadicArgs[i] = a.(depot.GetOp)
+			}
+		}
+		run(args[0].(context.Context), args[1].(string), args[2].(interface{}), variadicArgs...)
 	})
 	return _c
 }
@@ -161,22 +411,29 @@ func (_c *Database_Get_Call) Return(_a0 error) *Database_Get_Call {
 	return _c
 }
 
-func (_c *Database_Get_Call) RunAndReturn(run func(context.Context, string, interface{}) error) *Database_Get_Call {
+func (_c *Database_Get_Call) RunAndReturn(run func(context.Context, string, interface{}, ...depot.GetOp) error) *Database_Get_Call {
 	_c.Call.Return(run)
 	return _c
 }
 
-// Put provides a mock function with given fields: ctx, table, entity
-func (_m *Database) Put(ctx context.Context, table string, entity interface{}) error {
-	ret := _m.Called(ctx, table, entity)
+// Put provides a mock function with given fields: ctx, table, entity, op
+func (_m *Database) Put(ctx context.Context, table string, entity interface{}, op ...depot.Condition) error {
+	_va := make([]interface{}, len(op))
+	for _i := range op {
+		_va[_i] = op[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, table, entity)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
 
 	if len(ret) == 0 {
 		panic("no return value specified for Put")
 	}
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, interface{}) error); ok {
-		r0 = rf(ctx, table, entity)
+	if rf, ok := ret.Get(0).(func(context.Context, string, interface{}, ...depot.Condition) error); ok {
+		r0 = rf(ctx, table, entity, op...)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -193,13 +450,21 @@ type Database_Put_Call struct {
 //   - ctx context.Context
 //   - table string
 //   - entity interface{}
-func (_e *Database_Expecter) Put(ctx interface{}, table interface{}, entity interface{}) *Database_Put_Call {
-	return &Database_Put_Call{Call: _e.mock.On("Put", ctx, table, entity)}
+//   - op ...depot.Condition
+func (_e *Database_Expecter) Put(ctx interface{}, table interface{}, entity interface{}, op ...interface{}) *Database_Put_Call {
+	return &Database_Put_Call{Call: _e.mock.On("Put",
+		append([]interface{}{ctx, table, entity}, op...)...)}
 }
 
-func (_c *Database_Put_Call) Run(run func(ctx context.Context, table string, entity interface{})) *Database_Put_Call {
+func (_c *Database_Put_Call) Run(run func(ctx context.Context, table string, entity interface{}, op ...depot.Condition)) *Database_Put_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(string), args[2].(interface{}))
+		variadicArgs := make([]depot.Condition, len(args)-3)
+		for i, a := range args[3:] {
+			if a != nil {
+				variadicArgs[i] = a.(depot.Condition)
+			}
+		}
+		run(args[0].(context.Context), args[1].(string), args[2].(interface{}), variadicArgs...)
 	})
 	return _c
 }
@@ -209,7 +474,7 @@ func (_c *Database_Put_Call) Return(_a0 error) *Database_Put_Call {
 	return _c
 }
 
-func (_c *Database_Put_Call) RunAndReturn(run func(context.Context, string, interface{}) error) *Database_Put_Call {
+func (_c *Database_Put_Call) RunAndReturn(run func(context.Context, string, interface{}, ...depot.Condition) error) *Database_Put_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -289,6 +554,53 @@ func (_c *Database_Query_Call) RunAndReturn(run func(context.Context, string, st
 	return _c
 }
 
+// RunInTransaction provides a mock function with given fields: ctx, fn
+func (_m *Database) RunInTransaction(ctx context.Context, fn func(depot.Tx) error) error {
+	ret := _m.Called(ctx, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RunInTransaction")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func(depot.Tx) error) error); ok {
+		r0 = rf(ctx, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Database_RunInTransaction_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'RunInTransaction'
+type Database_RunInTransaction_Call struct {
+	*mock.Call
+}
+
+// RunInTransaction is a helper method to define mock.On call
+//   - ctx context.Context
+//   - fn func(depot.Tx) error
+func (_e *Database_Expecter) RunInTransaction(ctx interface{}, fn interface{}) *Database_RunInTransaction_Call {
+	return &Database_RunInTransaction_Call{Call: _e.mock.On("RunInTransaction", ctx, fn)}
+}
+
+func (_c *Database_RunInTransaction_Call) Run(run func(ctx context.Context, fn func(depot.Tx) error)) *Database_RunInTransaction_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(func(depot.Tx) error))
+	})
+	return _c
+}
+
+func (_c *Database_RunInTransaction_Call) Return(_a0 error) *Database_RunInTransaction_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Database_RunInTransaction_Call) RunAndReturn(run func(context.Context, func(depot.Tx) error) error) *Database_RunInTransaction_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Update provides a mock function with given fields: ctx, table, entity, op
 func (_m *Database) Update(ctx context.Context, table string, entity interface{}, op ...depot.UpdateOp) error {
 	_va := make([]interface{}, len(op))
@@ -22,6 +22,306 @@ func (_m *Table[T]) EXPECT() *Table_Expecter[T] {
 	return &Table_Expecter[T]{mock: &_m.Mock}
 }
 
+// Avg provides a mock function with given fields: ctx, kind, entity, field, op
+func (_m *Table[T]) Avg(ctx context.Context, kind string, entity T, field string, op ...depot.QueryOp) (float64, error) {
+	_va := make([]interface{}, len(op))
+	for _i := range op {
+		_va[_i] = op[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, kind, entity, field)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Avg")
+	}
+
+	var r0 float64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, T, string, ...depot.QueryOp) (float64, error)); ok {
+		return rf(ctx, kind, entity, field, op...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, T, string, ...depot.QueryOp) float64); ok {
+		r0 = rf(ctx, kind, entity, field, op...)
+	} else {
+		r0 = ret.Get(0).(float64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, T, string, ...depot.QueryOp) error); ok {
+		r1 = rf(ctx, kind, entity, field, op...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Table_Avg_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Avg'
+type Table_Avg_Call[T interface{}] struct {
+	*mock.Call
+}
+
+// Avg is a helper method to define mock.On call
+//   - ctx context.Context
+//   - kind string
+//   - entity T
+//   - field string
+//   - op ...depot.QueryOp
+func (_e *Table_Expecter[T]) Avg(ctx interface{}, kind interface{}, entity interface{}, field interface{}, op ...interface{}) *Table_Avg_Call[T] {
+	return &Table_Avg_Call[T]{Call: _e.mock.On("Avg",
+		append([]interface{}{ctx, kind, entity, field}, op...)...)}
+}
+
+func (_c *Table_Avg_Call[T]) Run(run func(ctx context.Context, kind string, entity T, field string, op ...depot.QueryOp)) *Table_Avg_Call[T] {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]depot.QueryOp, len(args)-4)
+		for i, a := range args[4:] {
+			if a != nil {
+				variadicArgs[i] = a.(depot.QueryOp)
+			}
+		}
+		run(args[0].(context.Context), args[1].(string), args[2].(T), args[3].(string), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *Table_Avg_Call[T]) Return(_a0 float64, _a1 error) *Table_Avg_Call[T] {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Table_Avg_Call[T]) RunAndReturn(run func(context.Context, string, T, string, ...depot.QueryOp) (float64, error)) *Table_Avg_Call[T] {
+	_c.Call.Return(run)
+	return _c
+}
+
+// BatchDelete provides a mock function with given fields: ctx, entities
+func (_m *Table[T]) BatchDelete(ctx context.Context, entities []T) error {
+	ret := _m.Called(ctx, entities)
+
+	if len(ret) == 0 {
+		panic("no return value specified for BatchDelete")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []T) error); ok {
+		r0 = rf(ctx, entities)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Table_BatchDelete_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'BatchDelete'
+type Table_BatchDelete_Call[T interface{}] struct {
+	*mock.Call
+}
+
+// BatchDelete is a helper method to define mock.On call
+//   - ctx context.Context
+//   - entities []T
+func (_e *Table_Expecter[T]) BatchDelete(ctx interface{}, entities interface{}) *Table_BatchDelete_Call[T] {
+	return &Table_BatchDelete_Call[T]{Call: _e.mock.On("BatchDelete", ctx, entities)}
+}
+
+func (_c *Table_BatchDelete_Call[T]) Run(run func(ctx context.Context, entities []T)) *Table_BatchDelete_Call[T] {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].([]T))
+	})
+	return _c
+}
+
+func (_c *Table_BatchDelete_Call[T]) Return(_a0 error) *Table_BatchDelete_Call[T] {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Table_BatchDelete_Call[T]) RunAndReturn(run func(context.Context, []T) error) *Table_BatchDelete_Call[T] {
+	_c.Call.Return(run)
+	return _c
+}
+
+// BatchGet provides a mock function with given fields: ctx, entities
+func (_m *Table[T]) BatchGet(ctx context.Context, entities []T) ([]T, error) {
+	ret := _m.Called(ctx, entities)
+
+	if len(ret) == 0 {
+		panic("no return value specified for BatchGet")
+	}
+
+	var r0 []T
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []T) ([]T, error)); ok {
+		return rf(ctx, entities)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []T) []T); ok {
+		r0 = rf(ctx, entities)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]T)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []T) error); ok {
+		r1 = rf(ctx, entities)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Table_BatchGet_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'BatchGet'
+type Table_BatchGet_Call[T interface{}] struct {
+	*mock.Call
+}
+
+// BatchGet is a helper method to define mock.On call
+//   - ctx context.Context
+//   - entities []T
+func (_e *Table_Expecter[T]) BatchGet(ctx interface{}, entities interface{}) *Table_BatchGet_Call[T] {
+	return &Table_BatchGet_Call[T]{Call: _e.mock.On("BatchGet", ctx, entities)}
+}
+
+func (_c *Table_BatchGet_Call[T]) Run(run func(ctx context.Context, entities []T)) *Table_BatchGet_Call[T] {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].([]T))
+	})
+	return _c
+}
+
+func (_c *Table_BatchGet_Call[T]) Return(_a0 []T, _a1 error) *Table_BatchGet_Call[T] {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Table_BatchGet_Call[T]) RunAndReturn(run func(context.Context, []T) ([]T, error)) *Table_BatchGet_Call[T] {
+	_c.Call.Return(run)
+	return _c
+}
+
+// BatchPut provides a mock function with given fields: ctx, entities
+func (_m *Table[T]) BatchPut(ctx context.Context, entities []T) error {
+	ret := _m.Called(ctx, entities)
+
+	if len(ret) == 0 {
+		panic("no return value specified for BatchPut")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []T) error); ok {
+		r0 = rf(ctx, entities)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Table_BatchPut_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'BatchPut'
+type Table_BatchPut_Call[T interface{}] struct {
+	*mock.Call
+}
+
+// BatchPut is a helper method to define mock.On call
+//   - ctx context.Context
+//   - entities []T
+func (_e *Table_Expecter[T]) BatchPut(ctx interface{}, entities interface{}) *Table_BatchPut_Call[T] {
+	return &Table_BatchPut_Call[T]{Call: _e.mock.On("BatchPut", ctx, entities)}
+}
+
+func (_c *Table_BatchPut_Call[T]) Run(run func(ctx context.Context, entities []T)) *Table_BatchPut_Call[T] {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].([]T))
+	})
+	return _c
+}
+
+func (_c *Table_BatchPut_Call[T]) Return(_a0 error) *Table_BatchPut_Call[T] {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Table_BatchPut_Call[T]) RunAndReturn(run func(context.Context, []T) error) *Table_BatchPut_Call[T] {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Count provides a mock function with given fields: ctx, kind, entity, op
+func (_m *Table[T]) Count(ctx context.Context, kind string, entity T, op ...depot.QueryOp) (int64, error) {
+	_va := make([]interface{}, len(op))
+	for _i := range op {
+		_va[_i] = op[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, kind, entity)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Count")
+	}
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, T, ...depot.QueryOp) (int64, error)); ok {
+		return rf(ctx, kind, entity, op...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, T, ...depot.QueryOp) int64); ok {
+		r0 = rf(ctx, kind, entity, op...)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, T, ...depot.QueryOp) error); ok {
+		r1 = rf(ctx, kind, entity, op...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Table_Count_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Count'
+type Table_Count_Call[T interface{}] struct {
+	*mock.Call
+}
+
+// Count is a helper method to define mock.On call
+//   - ctx context.Context
+//   - kind string
+//   - entity T
+//   - op ...depot.QueryOp
+func (_e *Table_Expecter[T]) Count(ctx interface{}, kind interface{}, entity interface{}, op ...interface{}) *Table_Count_Call[T] {
+	return &Table_Count_Call[T]{Call: _e.mock.On("Count",
+		append([]interface{}{ctx, kind, entity}, op...)...)}
+}
+
+func (_c *Table_Count_Call[T]) Run(run func(ctx context.Context, kind string, entity T, op ...depot.QueryOp)) *Table_Count_Call[T] {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]depot.QueryOp, len(args)-3)
+		for i, a := range args[3:] {
+			if a != nil {
+				variadicArgs[i] = a.(depot.QueryOp)
+			}
+		}
+		run(args[0].(context.Context), args[1].(string), args[2].(T), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *Table_Count_Call[T]) Return(_a0 int64, _a1 error) *Table_Count_Call[T] {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Table_Count_Call[T]) RunAndReturn(run func(context.Context, string, T, ...depot.QueryOp) (int64, error)) *Table_Count_Call[T] {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Create provides a mock function with given fields: ctx, entity
 func (_m *Table[T]) Create(ctx context.Context, entity T) (T, error) {
 	ret := _m.Called(ctx, entity)
@@ -79,9 +379,16 @@ func (_c *Table_Create_Call[T]) RunAndReturn(run func(context.Context, T) (T, er
 	return _c
 }
 
-// Delete provides a mock function with given fields: ctx, entity
-func (_m *Table[T]) Delete(ctx context.Context, entity T) (T, error) {
-	ret := _m.Called(ctx, entity)
+// Delete provides a mock function with given fields: ctx, entity, op
+func (_m *Table[T]) Delete(ctx context.Context, entity T, op ...depot.Condition) (T, error) {
+	_va := make([]interface{}, len(op))
+	for _i := range op {
+		_va[_i] = op[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, entity)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
 
 	if len(ret) == 0 {
 		panic("no return value specified for Delete")
@@ -89,17 +396,17 @@ func (_m *Table[T]) Delete(ctx context.Context, entity T) (T, error) {
 
 	var r0 T
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, T) (T, error)); ok {
-		return rf(ctx, entity)
+	if rf, ok := ret.Get(0).(func(context.Context, T, ...depot.Condition) (T, error)); ok {
+		return rf(ctx, entity, op...)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, T) T); ok {
-		r0 = rf(ctx, entity)
+	if rf, ok := ret.Get(0).(func(context.Context, T, ...depot.Condition) T); ok {
+		r0 = rf(ctx, entity, op...)
 	} else {
 		r0 = ret.Get(0).(T)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, T) error); ok {
-		r1 = rf(ctx, entity)
+	if rf, ok := ret.Get(1).(func(context.Context, T, ...depot.Condition) error); ok {
+		r1 = rf(ctx, entity, op...)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -115,13 +422,21 @@ type Table_Delete_Call[T interface{}] struct {
 // Delete is a helper method to define mock.On call
 //   - ctx context.Context
 //   - entity T
-func (_e *Table_Expecter[T]) Delete(ctx interface{}, entity interface{}) *Table_Delete_Call[T] {
-	return &Table_Delete_Call[T]{Call: _e.mock.On("Delete", ctx, entity)}
+//   - op ...depot.Condition
+func (_e *Table_Expecter[T]) Delete(ctx interface{}, entity interface{}, op ...interface{}) *Table_Delete_Call[T] {
+	return &Table_Delete_Call[T]{Call: _e.mock.On("Delete",
+		append([]interface{}{ctx, entity}, op...)...)}
 }
 
-func (_c *Table_Delete_Call[T]) Run(run func(ctx context.Context, entity T)) *Table_Delete_Call[T] {
+func (_c *Table_Delete_Call[T]) Run(run func(ctx context.Context, entity T, op ...depot.Condition)) *Table_Delete_Call[T] {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(T))
+		variadicArgs := make([]depot.Condition, len(args)-2)
+		for i, a := range args[2:] {
+			if a != nil {
+				variadicArgs[i] = a.(depot.Condition)
+			}
+		}
+		run(args[0].(context.Context), args[1].(T), variadicArgs...)
 	})
 	return _c
 }
@@ -131,28 +446,28 @@ func (_c *Table_Delete_Call[T]) Return(_a0 T, _a1 error) *Table_Delete_Call[T] {
 	return _c
 }
 
-func (_c *Table_Delete_Call[T]) RunAndReturn(run func(context.Context, T) (T, error)) *Table_Delete_Call[T] {
+func (_c *Table_Delete_Call[T]) RunAndReturn(run func(context.Context, T, ...depot.Condition) (T, error)) *Table_Delete_Call[T] {
 	_c.Call.Return(run)
 	return _c
 }
 
-// Get provides a mock function with given fields: ctx, entity
-func (_m *Table[T]) Get(ctx context.Context, entity T) (T, error) {
+// Exists provides a mock function with given fields: ctx, entity
+func (_m *Table[T]) Exists(ctx context.Context, entity T) (bool, error) {
 	ret := _m.Called(ctx, entity)
 
 	if len(ret) == 0 {
-		panic("no return value specified for Get")
+		panic("no return value specified for Exists")
 	}
 
-	var r0 T
+	var r0 bool
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, T) (T, error)); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, T) (bool, error)); ok {
 		return rf(ctx, entity)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, T) T); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, T) bool); ok {
 		r0 = rf(ctx, entity)
 	} else {
-		r0 = ret.Get(0).(T)
+		r0 = ret.Get(0).(bool)
 	}
 
 	if rf, ok := ret.Get(1).(func(context.Context, T) error); ok {
@@ -164,6 +479,70 @@ func (_m *Table[T]) Get(ctx context.Context, entity T) (T, error) {
 	return r0, r1
 }
 
+// Table_Exists_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Exists'
+type Table_Exists_Call[T interface{}] struct {
+	*mock.Call
+}
+
+// Exists is a helper method to define mock.On call
+//   - ctx context.Context
+//   - entity T
+func (_e *Table_Expecter[T]) Exists(ctx interface{}, entity interface{}) *Table_Exists_Call[T] {
+	return &Table_Exists_Call[T]{Call: _e.mock.On("Exists", ctx, entity)}
+}
+
+func (_c *Table_Exists_Call[T]) Run(run func(ctx context.Context, entity T)) *Table_Exists_Call[T] {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(T))
+	})
+	return _c
+}
+
+func (_c *Table_Exists_Call[T]) Return(_a0 bool, _a1 error) *Table_Exists_Call[T] {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Table_Exists_Call[T]) RunAndReturn(run func(context.Context, T) (bool, error)) *Table_Exists_Call[T] {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Get provides a mock function with given fields: ctx, entity, op
+func (_m *Table[T]) Get(ctx context.Context, entity T, op ...depot.GetOp) (T, error) {
+	_va := make([]interface{}, len(op))
+	for _i := range op {
+		_va[_i] = op[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, entity)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Get")
+	}
+
+	var r0 T
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, T, ...depot.GetOp) (T, error)); ok {
+		return rf(ctx, entity, op...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, T, ...depot.GetOp) T); ok {
+		r0 = rf(ctx, entity, op...)
+	} else {
+		r0 = ret.Get(0).(T)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, T, ...depot.GetOp) error); ok {
+		r1 = rf(ctx, entity, op...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Table_Get_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Get'
 type Table_Get_Call[T interface{}] struct {
 	*mock.Call
@@ -172,13 +551,21 @@ type Table_Get_Call[T interface{}] struct {
 // Get is a helper method to define mock.On call
 //   - ctx context.Context
 //   - entity T
-func (_e *Table_Expecter[T]) Get(ctx interface{}, entity interface{}) *Table_Get_Call[T] {
-	return &Table_Get_Call[T]{Call: _e.mock.On("Get", ctx, entity)}
+//   - op ...depot.GetOp
+func (_e *Table_Expecter[T]) Get(ctx interface{}, entity interface{}, op ...interface{}) *Table_Get_Call[T] {
+	return &Table_Get_Call[T]{Call: _e.mock.On("Get",
+		append([]interface{}{ctx, entity}, op...)...)}
 }
 
-func (_c *Table_Get_Call[T]) Run(run func(ctx context.Context, entity T)) *Table_Get_Call[T] {
+func (_c *Table_Get_Call[T]) Run(run func(ctx context.Context, entity T, op ...depot.GetOp)) *Table_Get_Call[T] {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(T))
+		variadicArgs := make([]depot.GetOp, len(args)-2)
+		for i, a := range args[2:] {
+			if a != nil {
+				variadicArgs[i] = a.(depot.GetOp)
+			}
+		}
+		run(args[0].(context.Context), args[1].(T), variadicArgs...)
 	})
 	return _c
 }
@@ -188,14 +575,168 @@ func (_c *Table_Get_Call[T]) Return(_a0 T, _a1 error) *Table_Get_Call[T] {
 	return _c
 }
 
-func (_c *Table_Get_Call[T]) RunAndReturn(run func(context.Context, T) (T, error)) *Table_Get_Call[T] {
+func (_c *Table_Get_Call[T]) RunAndReturn(run func(context.Context, T, ...depot.GetOp) (T, error)) *Table_Get_Call[T] {
 	_c.Call.Return(run)
 	return _c
 }
 
-// Put provides a mock function with given fields: ctx, entity
-func (_m *Table[T]) Put(ctx context.Context, entity T) (T, error) {
-	ret := _m.Called(ctx, entity)
+// Iterate provides a mock function with given fields: ctx, kind, entity, op
+func (_m *Table[T]) Iterate(ctx context.Context, kind string, entity T, op ...depot.QueryOp) *depot.Iterator[T] {
+	_va := make([]interface{}, len(op))
+	for _i := range op {
+		_va[_i] = op[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, kind, entity)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Iterate")
+	}
+
+	var r0 *depot.Iterator[T]
+	if rf, ok := ret.Get(0).(func(context.Context, string, T, ...depot.QueryOp) *depot.Iterator[T]); ok {
+		r0 = rf(ctx, kind, entity, op...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*depot.Iterator[T])
+		}
+	}
+
+	return r0
+}
+
+// Table_Iterate_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Iterate'
+type Table_Iterate_Call[T interface{}] struct {
+	*mock.Call
+}
+
+// Iterate is a helper method to define mock.On call
+//   - ctx context.Context
+//   - kind string
+//   - entity T
+//   - op ...depot.QueryOp
+func (_e *Table_Expecter[T]) Iterate(ctx interface{}, kind interface{}, entity interface{}, op ...interface{}) *Table_Iterate_Call[T] {
+	return &Table_Iterate_Call[T]{Call: _e.mock.On("Iterate",
+		append([]interface{}{ctx, kind, entity}, op...)...)}
+}
+
+func (_c *Table_Iterate_Call[T]) Run(run func(ctx context.Context, kind string, entity T, op ...depot.QueryOp)) *Table_Iterate_Call[T] {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]depot.QueryOp, len(args)-3)
+		for i, a := range args[3:] {
+			if a != nil {
+				variadicArgs[i] = a.(depot.QueryOp)
+			}
+		}
+		run(args[0].(context.Context), args[1].(string), args[2].(T), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *Table_Iterate_Call[T]) Return(_a0 *depot.Iterator[T]) *Table_Iterate_Call[T] {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Table_Iterate_Call[T]) RunAndReturn(run func(context.Context, string, T, ...depot.QueryOp) *depot.Iterator[T]) *Table_Iterate_Call[T] {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Keys provides a mock function with given fields: ctx, kind, entity, op
+func (_m *Table[T]) Keys(ctx context.Context, kind string, entity T, op ...depot.QueryOp) ([]depot.Key, string, error) {
+	_va := make([]interface{}, len(op))
+	for _i := range op {
+		_va[_i] = op[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, kind, entity)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Keys")
+	}
+
+	var r0 []depot.Key
+	var r1 string
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, T, ...depot.QueryOp) ([]depot.Key, string, error)); ok {
+		return rf(ctx, kind, entity, op...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, T, ...depot.QueryOp) []depot.Key); ok {
+		r0 = rf(ctx, kind, entity, op...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]depot.Key)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, T, ...depot.QueryOp) string); ok {
+		r1 = rf(ctx, kind, entity, op...)
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, string, T, ...depot.QueryOp) error); ok {
+		r2 = rf(ctx, kind, entity, op...)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// Table_Keys_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Keys'
+type Table_Keys_Call[T interface{}] struct {
+	*mock.Call
+}
+
+// Keys is a helper method to define mock.On call
+//   - ctx context.Context
+//   - kind string
+//   - entity T
+//   - op ...depot.QueryOp
+func (_e *Table_Expecter[T]) Keys(ctx interface{}, kind interface{}, entity interface{}, op ...interface{}) *Table_Keys_Call[T] {
+	return &Table_Keys_Call[T]{Call: _e.mock.On("Keys",
+		append([]interface{}{ctx, kind, entity}, op...)...)}
+}
+
+func (_c *Table_Keys_Call[T]) Run(run func(ctx context.Context, kind string, entity T, op ...depot.QueryOp)) *Table_Keys_Call[T] {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]depot.QueryOp, len(args)-3)
+		for i, a := range args[3:] {
+			if a != nil {
+				variadicArgs[i] = a.(depot.QueryOp)
+			}
+		}
+		run(args[0].(context.Context), args[1].(string), args[2].(T), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *Table_Keys_Call[T]) Return(_a0 []depot.Key, _a1 string, _a2 error) *Table_Keys_Call[T] {
+	_c.Call.Return(_a0, _a1, _a2)
+	return _c
+}
+
+func (_c *Table_Keys_Call[T]) RunAndReturn(run func(context.Context, string, T, ...depot.QueryOp) ([]depot.Key, string, error)) *Table_Keys_Call[T] {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Put provides a mock function with given fields: ctx, entity, op
+func (_m *Table[T]) Put(ctx context.Context, entity T, op ...depot.Condition) (T, error) {
+	_va := make([]interface{}, len(op))
+	for _i := range op {
+		_va[_i] = op[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, entity)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
 
 	if len(ret) == 0 {
 		panic("no return value specified for Put")
@@ -203,17 +744,17 @@ func (_m *Table[T]) Put(ctx context.Context, entity T) (T, error) {
 
 	var r0 T
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, T) (T, error)); ok {
-		return rf(ctx, entity)
+	if rf, ok := ret.Get(0).(func(context.Context, T, ...depot.Condition) (T, error)); ok {
+		return rf(ctx, entity, op...)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, T) T); ok {
-		r0 = rf(ctx, entity)
+	if rf, ok := ret.Get(0).(func(context.Context, T, ...depot.Condition) T); ok {
+		r0 = rf(ctx, entity, op...)
 	} else {
 		r0 = ret.Get(0).(T)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, T) error); ok {
-		r1 = rf(ctx, entity)
+	if rf, ok := ret.Get(1).(func(context.Context, T, ...depot.Condition) error); ok {
+		r1 = rf(ctx, entity, op...)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -229,13 +770,21 @@ type Table_Put_Call[T interface{}] struct {
 // Put is a helper method to define mock.On call
 //   - ctx context.Context
 //   - entity T
-func (_e *Table_Expecter[T]) Put(ctx interface{}, entity interface{}) *Table_Put_Call[T] {
-	return &Table_Put_Call[T]{Call: _e.mock.On("Put", ctx, entity)}
+//   - op ...depot.Condition
+func (_e *Table_Expecter[T]) Put(ctx interface{}, entity interface{}, op ...interface{}) *Table_Put_Call[T] {
+	return &Table_Put_Call[T]{Call: _e.mock.On("Put",
+		append([]interface{}{ctx, entity}, op...)...)}
 }
 
-func (_c *Table_Put_Call[T]) Run(run func(ctx context.Context, entity T)) *Table_Put_Call[T] {
+func (_c *Table_Put_Call[T]) Run(run func(ctx context.Context, entity T, op ...depot.Condition)) *Table_Put_Call[T] {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(context.Context), args[1].(T))
+		variadicArgs := make([]depot.Condition, len(args)-2)
+		for i, a := range args[2:] {
+			if a != nil {
+				variadicArgs[i] = a.(depot.Condition)
+			}
+		}
+		run(args[0].(context.Context), args[1].(T), variadicArgs...)
 	})
 	return _c
 }
@@ -245,7 +794,7 @@ func (_c *Table_Put_Call[T]) Return(_a0 T, _a1 error) *Table_Put_Call[T] {
 	return _c
 }
 
-func (_c *Table_Put_Call[T]) RunAndReturn(run func(context.Context, T) (T, error)) *Table_Put_Call[T] {
+func (_c *Table_Put_Call[T]) RunAndReturn(run func(context.Context, T, ...depot.Condition) (T, error)) *Table_Put_Call[T] {
 	_c.Call.Return(run)
 	return _c
 }
@@ -332,6 +881,80 @@ func (_c *Table_Query_Call[T]) RunAndReturn(run func(context.Context, string, T,
 	return _c
 }
 
+// Sum provides a mock function with given fields: ctx, kind, entity, field, op
+func (_m *Table[T]) Sum(ctx context.Context, kind string, entity T, field string, op ...depot.QueryOp) (float64, error) {
+	_va := make([]interface{}, len(op))
+	for _i := range op {
+		_va[_i] = op[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, kind, entity, field)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Sum")
+	}
+
+	var r0 float64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, T, string, ...depot.QueryOp) (float64, error)); ok {
+		return rf(ctx, kind, entity, field, op...)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, T, string, ...depot.QueryOp) float64); ok {
+		r0 = rf(ctx, kind, entity, field, op...)
+	} else {
+		r0 = ret.Get(0).(float64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, T, string, ...depot.QueryOp) error); ok {
+		r1 = rf(ctx, kind, entity, field, op...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Table_Sum_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Sum'
+type Table_Sum_Call[T interface{}] struct {
+	*mock.Call
+}
+
+// Sum is a helper method to define mock.On call
+//   - ctx context.Context
+//   - kind string
+//   - entity T
+//   - field string
+//   - op ...depot.QueryOp
+func (_e *Table_Expecter[T]) Sum(ctx interface{}, kind interface{}, entity interface{}, field interface{}, op ...interface{}) *Table_Sum_Call[T] {
+	return &Table_Sum_Call[T]{Call: _e.mock.On("Sum",
+		append([]interface{}{ctx, kind, entity, field}, op...)...)}
+}
+
+func (_c *Table_Sum_Call[T]) Run(run func(ctx context.Context, kind string, entity T, field string, op ...depot.QueryOp)) *Table_Sum_Call[T] {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]depot.QueryOp, len(args)-4)
+		for i, a := range args[4:] {
+			if a != nil {
+				variadicArgs[i] = a.(depot.QueryOp)
+			}
+		}
+		run(args[0].(context.Context), args[1].(string), args[2].(T), args[3].(string), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *Table_Sum_Call[T]) Return(_a0 float64, _a1 error) *Table_Sum_Call[T] {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Table_Sum_Call[T]) RunAndReturn(run func(context.Context, string, T, string, ...depot.QueryOp) (float64, error)) *Table_Sum_Call[T] {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Update provides a mock function with given fields: ctx, entity, op
 func (_m *Table[T]) Update(ctx context.Context, entity T, op ...depot.UpdateOp) (T, error) {
 	_va := make([]interface{}, len(op))
@@ -1,5 +1,14 @@
 package depot
 
+import (
+	"reflect"
+	"time"
+)
+
+// UpdateOp names the field an update writes and how. The field may be a dotted
+// path such as "data.c" into a map or struct field, in which case only the
+// nested value is written. DynamoDB can only write into a map that is already
+// stored.
 type UpdateOp interface {
 	isUpdateOp()
 	Field() string
@@ -8,20 +17,110 @@ type UpdateOp interface {
 type AddUpdateOp struct{ field string }
 type SubtractUpdateOp struct{ field string }
 type ForceUpdateOp struct{ field string }
+type RemoveUpdateOp struct{ field string }
+type AppendUpdateOp struct{ field string }
+type PrependUpdateOp struct{ field string }
+type AddToSetUpdateOp struct{ field string }
+type RemoveFromSetUpdateOp struct{ field string }
+type SetIfAbsentUpdateOp struct{ field string }
+type MaxUpdateOp struct{ field string }
+type MinUpdateOp struct{ field string }
 
-func (*AddUpdateOp) isUpdateOp()      {}
-func (*SubtractUpdateOp) isUpdateOp() {}
-func (*ForceUpdateOp) isUpdateOp()    {}
+func (*AddUpdateOp) isUpdateOp()           {}
+func (*SubtractUpdateOp) isUpdateOp()      {}
+func (*ForceUpdateOp) isUpdateOp()         {}
+func (*RemoveUpdateOp) isUpdateOp()        {}
+func (*AppendUpdateOp) isUpdateOp()        {}
+func (*PrependUpdateOp) isUpdateOp()       {}
+func (*AddToSetUpdateOp) isUpdateOp()      {}
+func (*RemoveFromSetUpdateOp) isUpdateOp() {}
+func (*SetIfAbsentUpdateOp) isUpdateOp()   {}
+func (*MaxUpdateOp) isUpdateOp()           {}
+func (*MinUpdateOp) isUpdateOp()           {}
 
-func (o *AddUpdateOp) Field() string      { return o.field }
-func (o *SubtractUpdateOp) Field() string { return o.field }
-func (o *ForceUpdateOp) Field() string    { return o.field }
+func (o *AddUpdateOp) Field() string           { return o.field }
+func (o *SubtractUpdateOp) Field() string      { return o.field }
+func (o *ForceUpdateOp) Field() string         { return o.field }
+func (o *RemoveUpdateOp) Field() string        { return o.field }
+func (o *AppendUpdateOp) Field() string        { return o.field }
+func (o *PrependUpdateOp) Field() string       { return o.field }
+func (o *AddToSetUpdateOp) Field() string      { return o.field }
+func (o *RemoveFromSetUpdateOp) Field() string { return o.field }
+func (o *SetIfAbsentUpdateOp) Field() string   { return o.field }
+func (o *MaxUpdateOp) Field() string           { return o.field }
+func (o *MinUpdateOp) Field() string           { return o.field }
 
 func Add(field string) *AddUpdateOp           { return &AddUpdateOp{field: field} }
 func Subtract(field string) *SubtractUpdateOp { return &SubtractUpdateOp{field: field} }
 func Force(field string) *ForceUpdateOp       { return &ForceUpdateOp{field: field} }
 
+// Remove deletes the field from the stored entity, whatever its value in the
+// entity passed to Update, and leaves it zero there.
+func Remove(field string) *RemoveUpdateOp { return &RemoveUpdateOp{field: field} }
+
+// Append adds the elements of the slice field to the end of the stored list.
+func Append(field string) *AppendUpdateOp { return &AppendUpdateOp{field: field} }
+
+// Prepend adds the elements of the slice field to the start of the stored list.
+func Prepend(field string) *PrependUpdateOp { return &PrependUpdateOp{field: field} }
+
+// AddToSet adds the elements of the slice field that the stored list lacks. On
+// DynamoDB the field must be stored as a string, number or binary set.
+func AddToSet(field string) *AddToSetUpdateOp { return &AddToSetUpdateOp{field: field} }
+
+// RemoveFromSet removes every element of the slice field from the stored list.
+// On DynamoDB the field must be stored as a string, number or binary set.
+func RemoveFromSet(field string) *RemoveFromSetUpdateOp {
+	return &RemoveFromSetUpdateOp{field: field}
+}
+
+// SetIfAbsent writes the field only when it is not stored yet.
+func SetIfAbsent(field string) *SetIfAbsentUpdateOp { return &SetIfAbsentUpdateOp{field: field} }
+
+// Max writes the field only when it is greater than the stored value or none is
+// stored. Other fields of the update are written either way. DynamoDB compares
+// the values as they are stored, so times compare as strings there.
+func Max(field string) *MaxUpdateOp { return &MaxUpdateOp{field: field} }
+
+// Min writes the field only when it is less than the stored value or none is
+// stored. Other fields of the update are written either way.
+func Min(field string) *MinUpdateOp { return &MinUpdateOp{field: field} }
+
+// UpdateApplies reports whether u is written over the stored value of its
+// field. Only SetIfAbsent, Max and Min ever leave a stored value in place.
+func UpdateApplies(u Update, stored interface{}) bool {
+	a, b := Normalize(u.Value), Normalize(stored)
+	if b == nil {
+		return true
+	}
+	switch u.Op.(type) {
+	case *SetIfAbsentUpdateOp:
+		return false
+	case *MaxUpdateOp:
+		return ValuesGreaterThan(a, b)
+	case *MinUpdateOp:
+		return ValuesLessThan(a, b)
+	default:
+		return true
+	}
+}
+
+// IsListUpdateOp reports whether op merges a slice field into the stored list.
+func IsListUpdateOp(op UpdateOp) bool {
+	switch op.(type) {
+	case *AppendUpdateOp, *PrependUpdateOp, *AddToSetUpdateOp, *RemoveFromSetUpdateOp:
+		return true
+	}
+	return false
+}
+
 type QueryOp interface{ isQueryOp() }
+
+// GetOp is an option of Get.
+type GetOp interface{ isGetOp() }
+
+// Condition compares a field with the value it has in the entity. Like
+// UpdateOp, it may name a dotted path into a map or struct field.
 type Condition interface {
 	isCondition()
 	Field() string
@@ -36,6 +135,8 @@ type LTECondition struct{ field string }
 type GTCondition struct{ field string }
 type GTECondition struct{ field string }
 type ExistsCondition struct{ field string }
+type BeginsWithCondition struct{ field string }
+type ContainsCondition struct{ field string }
 type InCondition struct {
 	field string
 	list  []interface{}
@@ -45,55 +146,68 @@ type NotInCondition struct {
 	list  []interface{}
 }
 
-func (*EqualCondition) isQueryOp()    {}
-func (*NotEqualCondition) isQueryOp() {}
-func (*LTCondition) isQueryOp()       {}
-func (*LTECondition) isQueryOp()      {}
-func (*GTCondition) isQueryOp()       {}
-func (*GTECondition) isQueryOp()      {}
-func (*ExistsCondition) isQueryOp()   {}
-func (*InCondition) isQueryOp()       {}
-func (*NotInCondition) isQueryOp()    {}
-
-func (*EqualCondition) isUpdateOp()    {}
-func (*NotEqualCondition) isUpdateOp() {}
-func (*LTCondition) isUpdateOp()       {}
-func (*LTECondition) isUpdateOp()      {}
-func (*GTCondition) isUpdateOp()       {}
-func (*GTECondition) isUpdateOp()      {}
-func (*ExistsCondition) isUpdateOp()   {}
-func (*InCondition) isUpdateOp()       {}
-func (*NotInCondition) isUpdateOp()    {}
-
-func (q *EqualCondition) Field() string    { return q.field }
-func (q *NotEqualCondition) Field() string { return q.field }
-func (q *LTCondition) Field() string       { return q.field }
-func (q *LTECondition) Field() string      { return q.field }
-func (q *GTCondition) Field() string       { return q.field }
-func (q *GTECondition) Field() string      { return q.field }
-func (q *ExistsCondition) Field() string   { return q.field }
-func (q *InCondition) Field() string       { return q.field }
-func (q *NotInCondition) Field() string    { return q.field }
-
-func (*EqualCondition) Valueless() bool    { return false }
-func (*NotEqualCondition) Valueless() bool { return false }
-func (*LTCondition) Valueless() bool       { return false }
-func (*LTECondition) Valueless() bool      { return false }
-func (*GTCondition) Valueless() bool       { return false }
-func (*GTECondition) Valueless() bool      { return false }
-func (*ExistsCondition) Valueless() bool   { return true }
-func (*InCondition) Valueless() bool       { return true }
-func (*NotInCondition) Valueless() bool    { return true }
-
-func (*EqualCondition) isCondition()    {}
-func (*NotEqualCondition) isCondition() {}
-func (*LTCondition) isCondition()       {}
-func (*LTECondition) isCondition()      {}
-func (*GTCondition) isCondition()       {}
-func (*GTECondition) isCondition()      {}
-func (*ExistsCondition) isCondition()   {}
-func (*InCondition) isCondition()       {}
-func (*NotInCondition) isCondition()    {}
+func (*EqualCondition) isQueryOp()      {}
+func (*NotEqualCondition) isQueryOp()   {}
+func (*LTCondition) isQueryOp()         {}
+func (*LTECondition) isQueryOp()        {}
+func (*GTCondition) isQueryOp()         {}
+func (*GTECondition) isQueryOp()        {}
+func (*ExistsCondition) isQueryOp()     {}
+func (*BeginsWithCondition) isQueryOp() {}
+func (*ContainsCondition) isQueryOp()   {}
+func (*InCondition) isQueryOp()         {}
+func (*NotInCondition) isQueryOp()      {}
+
+func (*EqualCondition) isUpdateOp()      {}
+func (*NotEqualCondition) isUpdateOp()   {}
+func (*LTCondition) isUpdateOp()         {}
+func (*LTECondition) isUpdateOp()        {}
+func (*GTCondition) isUpdateOp()         {}
+func (*GTECondition) isUpdateOp()        {}
+func (*ExistsCondition) isUpdateOp()     {}
+func (*BeginsWithCondition) isUpdateOp() {}
+func (*ContainsCondition) isUpdateOp()   {}
+func (*InCondition) isUpdateOp()         {}
+func (*NotInCondition) isUpdateOp()      {}
+
+func (q *EqualCondition) Field() string      { return q.field }
+func (q *NotEqualCondition) Field() string   { return q.field }
+func (q *LTCondition) Field() string         { return q.field }
+func (q *LTECondition) Field() string        { return q.field }
+func (q *GTCondition) Field() string         { return q.field }
+func (q *GTECondition) Field() string        { return q.field }
+func (q *ExistsCondition) Field() string     { return q.field }
+func (q *BeginsWithCondition) Field() string { return q.field }
+func (q *ContainsCondition) Field() string   { return q.field }
+func (q *InCondition) Field() string         { return q.field }
+func (q *NotInCondition) Field() string      { return q.field }
+
+func (q *InCondition) List() []interface{}    { return q.list }
+func (q *NotInCondition) List() []interface{} { return q.list }
+
+func (*EqualCondition) Valueless() bool      { return false }
+func (*NotEqualCondition) Valueless() bool   { return false }
+func (*LTCondition) Valueless() bool         { return false }
+func (*LTECondition) Valueless() bool        { return false }
+func (*GTCondition) Valueless() bool         { return false }
+func (*GTECondition) Valueless() bool        { return false }
+func (*ExistsCondition) Valueless() bool     { return true }
+func (*BeginsWithCondition) Valueless() bool { return false }
+func (*ContainsCondition) Valueless() bool   { return false }
+func (*InCondition) Valueless() bool         { return true }
+func (*NotInCondition) Valueless() bool      { return true }
+
+func (*EqualCondition) isCondition()      {}
+func (*NotEqualCondition) isCondition()   {}
+func (*LTCondition) isCondition()         {}
+func (*LTECondition) isCondition()        {}
+func (*GTCondition) isCondition()         {}
+func (*GTECondition) isCondition()        {}
+func (*ExistsCondition) isCondition()     {}
+func (*BeginsWithCondition) isCondition() {}
+func (*ContainsCondition) isCondition()   {}
+func (*InCondition) isCondition()         {}
+func (*NotInCondition) isCondition()      {}
 
 func Equal(field string) *EqualCondition            { return &EqualCondition{field: field} }
 func NotEqual(field string) *NotEqualCondition      { return &NotEqualCondition{field: field} }
@@ -103,6 +217,17 @@ func GreaterThan(field string) *GTCondition         { return &GTCondition{field:
 func GreaterThanOrEqual(field string) *GTECondition { return &GTECondition{field: field} }
 func Exists(field string) *ExistsCondition          { return &ExistsCondition{field: field} }
 
+// BeginsWith matches a string that starts with the value of the field.
+func BeginsWith(field string) *BeginsWithCondition { return &BeginsWithCondition{field: field} }
+
+// Contains matches a string that contains the value of the field, or a list
+// that contains it, or all of its elements when it is a list too. Firestore and
+// Datastore only look in lists, and Firestore for a single element.
+func Contains(field string) *ContainsCondition { return &ContainsCondition{field: field} }
+
+// In and NotIn match a field whose value is, or is not, one of list. An empty
+// list is rejected with ErrInvalidCondition, as not every backend can express
+// it.
 func In(field string, list ...interface{}) *InCondition {
 	return &InCondition{field: field, list: list}
 }
@@ -110,22 +235,215 @@ func NotIn(field string, list ...interface{}) *NotInCondition {
 	return &NotInCondition{field: field, list: list}
 }
 
+// OrCondition, AndCondition and NotCondition combine other conditions, whose
+// values are resolved as they would be on their own. They name no field of their
+// own, and the entity fields they compare are only compared through them.
+type OrCondition struct{ conditions []Condition }
+type AndCondition struct{ conditions []Condition }
+type NotCondition struct{ condition Condition }
+
+func (*OrCondition) isQueryOp()  {}
+func (*AndCondition) isQueryOp() {}
+func (*NotCondition) isQueryOp() {}
+
+func (*OrCondition) isUpdateOp()  {}
+func (*AndCondition) isUpdateOp() {}
+func (*NotCondition) isUpdateOp() {}
+
+func (*OrCondition) isCondition()  {}
+func (*AndCondition) isCondition() {}
+func (*NotCondition) isCondition() {}
+
+func (*OrCondition) Field() string  { return "" }
+func (*AndCondition) Field() string { return "" }
+func (*NotCondition) Field() string { return "" }
+
+func (*OrCondition) Valueless() bool  { return true }
+func (*AndCondition) Valueless() bool { return true }
+func (*NotCondition) Valueless() bool { return true }
+
+func (q *OrCondition) Conditions() []Condition  { return q.conditions }
+func (q *AndCondition) Conditions() []Condition { return q.conditions }
+func (q *NotCondition) Conditions() []Condition { return []Condition{q.condition} }
+
+// Or matches when any of the conditions does.
+func Or(conditions ...Condition) *OrCondition { return &OrCondition{conditions: conditions} }
+
+// And matches when all of the conditions do.
+func And(conditions ...Condition) *AndCondition { return &AndCondition{conditions: conditions} }
+
+// Not matches when the condition does not.
+func Not(condition Condition) *NotCondition { return &NotCondition{condition: condition} }
+
+// CompositeCondition is implemented by Or, And and Not.
+type CompositeCondition interface {
+	Condition
+	Conditions() []Condition
+}
+
+// WhereCondition and BetweenCondition carry the values they compare a field
+// with, so they may compare zero values or the same field more than once. The
+// field in the entity is left to the other ops.
+type WhereCondition struct {
+	field    string
+	operator string
+	value    interface{}
+}
+type BetweenCondition struct {
+	field    string
+	from, to interface{}
+}
+
+func (*WhereCondition) isQueryOp()   {}
+func (*BetweenCondition) isQueryOp() {}
+
+func (*WhereCondition) isUpdateOp()   {}
+func (*BetweenCondition) isUpdateOp() {}
+
+func (*WhereCondition) isCondition()   {}
+func (*BetweenCondition) isCondition() {}
+
+func (*WhereCondition) isValueCondition()   {}
+func (*BetweenCondition) isValueCondition() {}
+
+func (q *WhereCondition) Field() string   { return q.field }
+func (q *BetweenCondition) Field() string { return q.field }
+
+func (*WhereCondition) Valueless() bool   { return true }
+func (*BetweenCondition) Valueless() bool { return true }
+
+func (q *WhereCondition) Operator() string    { return q.operator }
+func (q *WhereCondition) Value() interface{}  { return q.value }
+func (q *BetweenCondition) From() interface{} { return q.from }
+func (q *BetweenCondition) To() interface{}   { return q.to }
+
+// Condition returns the condition the operator stands for, which compares the
+// field with Value. It fails with ErrInvalidCondition for an unknown operator
+// or an "in" or "not-in" value that is not a slice or is empty.
+func (q *WhereCondition) Condition() (Condition, error) {
+	switch q.operator {
+	case "=", "==":
+		return Equal(q.field), nil
+	case "!=":
+		return NotEqual(q.field), nil
+	case "<":
+		return LessThan(q.field), nil
+	case "<=":
+		return LessThanOrEqual(q.field), nil
+	case ">":
+		return GreaterThan(q.field), nil
+	case ">=":
+		return GreaterThanOrEqual(q.field), nil
+	case "begins-with":
+		return BeginsWith(q.field), nil
+	case "contains":
+		return Contains(q.field), nil
+	case "in", "not-in":
+		v := reflect.ValueOf(q.value)
+		if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Len() == 0 {
+			return nil, ErrInvalidCondition
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = v.Index(i).Interface()
+		}
+		if q.operator == "in" {
+			return In(q.field, list...), nil
+		}
+		return NotIn(q.field, list...), nil
+	}
+	return nil, ErrInvalidCondition
+}
+
+// Where compares field with value using one of the operators "=", "!=", "<",
+// "<=", ">", ">=", "begins-with", "contains", "in" and "not-in". The value of an
+// "in" or "not-in" is a slice.
+func Where(field, operator string, value interface{}) *WhereCondition {
+	return &WhereCondition{field: field, operator: operator, value: value}
+}
+
+// Between matches when field lies between from and to, both included.
+func Between(field string, from, to interface{}) *BetweenCondition {
+	return &BetweenCondition{field: field, from: from, to: to}
+}
+
+// ValueCondition is implemented by Where and Between.
+type ValueCondition interface {
+	Condition
+	isValueCondition()
+}
+
 type AscQueryDirective struct{}
 type DescQueryDirective struct{}
 type LimitQueryDirective struct{ Limit int }
 type PageQueryDirective struct{ Page string }
+type SelectQueryDirective struct{ Fields []string }
+type ConsistentQueryDirective struct{}
+type AsOfQueryDirective struct{ Time time.Time }
+
+func (*AscQueryDirective) isQueryOp()        {}
+func (*DescQueryDirective) isQueryOp()       {}
+func (*LimitQueryDirective) isQueryOp()      {}
+func (*PageQueryDirective) isQueryOp()       {}
+func (*SelectQueryDirective) isQueryOp()     {}
+func (*ConsistentQueryDirective) isQueryOp() {}
+func (*AsOfQueryDirective) isQueryOp()       {}
 
-func (*AscQueryDirective) isQueryOp()   {}
-func (*DescQueryDirective) isQueryOp()  {}
-func (*LimitQueryDirective) isQueryOp() {}
-func (*PageQueryDirective) isQueryOp()  {}
+func (*AscQueryDirective) isQueryDirective()        {}
+func (*DescQueryDirective) isQueryDirective()       {}
+func (*LimitQueryDirective) isQueryDirective()      {}
+func (*PageQueryDirective) isQueryDirective()       {}
+func (*SelectQueryDirective) isQueryDirective()     {}
+func (*ConsistentQueryDirective) isQueryDirective() {}
+func (*AsOfQueryDirective) isQueryDirective()       {}
 
-func (*AscQueryDirective) isQueryDirective()   {}
-func (*DescQueryDirective) isQueryDirective()  {}
-func (*LimitQueryDirective) isQueryDirective() {}
-func (*PageQueryDirective) isQueryDirective()  {}
+func (*SelectQueryDirective) isGetOp()     {}
+func (*ConsistentQueryDirective) isGetOp() {}
+func (*AsOfQueryDirective) isGetOp()       {}
 
 func Asc() *AscQueryDirective              { return &AscQueryDirective{} }
 func Desc() *DescQueryDirective            { return &DescQueryDirective{} }
 func Limit(limit int) *LimitQueryDirective { return &LimitQueryDirective{Limit: limit} }
 func Page(page string) *PageQueryDirective { return &PageQueryDirective{Page: page} }
+
+// Select loads only the fields named, which may be dotted paths, along with the
+// key fields. The other fields are left at their zero values, so a Select of no
+// fields loads the key alone.
+func Select(fields ...string) *SelectQueryDirective {
+	return &SelectQueryDirective{Fields: fields}
+}
+
+// Consistent makes a read strongly consistent, so that it sees every write
+// completed before it. DynamoDB cannot read its global secondary indexes
+// consistently and fails with ErrConsistentIndex.
+func Consistent() *ConsistentQueryDirective {
+	return &ConsistentQueryDirective{}
+}
+
+// ConsistentRead reports whether ops ask for a consistent read.
+func ConsistentRead[O any](ops []O) bool {
+	for _, op := range ops {
+		if _, ok := any(op).(*ConsistentQueryDirective); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AsOf reads the database as it was at time t, so that the pages of a query
+// all come from one snapshot. Only the backends that keep past versions can,
+// and the others fail with ErrUnsupported, as do transactions.
+func AsOf(t time.Time) *AsOfQueryDirective {
+	return &AsOfQueryDirective{Time: t}
+}
+
+// ReadTime returns the time ops read the database as of, or the zero time when
+// they read its present state.
+func ReadTime[O any](ops []O) time.Time {
+	for _, op := range ops {
+		if a, ok := any(op).(*AsOfQueryDirective); ok {
+			return a.Time
+		}
+	}
+	return time.Time{}
+}
@@ -2,12 +2,17 @@ package depot
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestUpdateOp(t *testing.T) {
-	updateOps := []UpdateOp{Add("a"), Subtract("a"), Force("a")}
+	updateOps := []UpdateOp{
+		Add("a"), Subtract("a"), Force("a"), Remove("a"),
+		Append("a"), Prepend("a"), AddToSet("a"), RemoveFromSet("a"),
+		SetIfAbsent("a"), Max("a"), Min("a"),
+	}
 	for _, o := range updateOps {
 		o.isUpdateOp()
 		assert.Equal(t, "a", o.Field())
@@ -16,7 +21,7 @@ func TestUpdateOp(t *testing.T) {
 	conditions := []Condition{
 		Equal("a"), NotEqual("a"), LessThan("a"), LessThanOrEqual("a"),
 		GreaterThan("a"), GreaterThanOrEqual("a"), Exists("a"),
-		In("a", 1), NotIn("a", 1),
+		In("a", 1), NotIn("a", 1), BeginsWith("a"), Contains("a"),
 	}
 
 	for _, o := range conditions {
@@ -35,8 +40,34 @@ func TestUpdateOp(t *testing.T) {
 			assert.False(t, o.Valueless())
 		}
 	}
+	assert.Equal(t, []interface{}{1, 2}, In("a", 1, 2).List())
 
-	directives := []QueryDirective{Asc(), Desc(), Limit(10), Page("p")}
+	a, b := Equal("a"), Exists("b")
+	composites := []CompositeCondition{Or(a, b), And(a, b), Not(a)}
+	for _, o := range composites {
+		o.isCondition()
+		o.(UpdateOp).isUpdateOp()
+		o.(QueryOp).isQueryOp()
+		assert.Equal(t, "", o.Field())
+		assert.True(t, o.Valueless())
+	}
+	assert.Equal(t, []Condition{a, b}, Or(a, b).Conditions())
+	assert.Equal(t, []Condition{a, b}, And(a, b).Conditions())
+	assert.Equal(t, []Condition{a}, Not(a).Conditions())
+
+	for _, o := range []ValueCondition{Where("a", "=", 0), Between("a", 1, 2)} {
+		o.isCondition()
+		o.isValueCondition()
+		o.(UpdateOp).isUpdateOp()
+		o.(QueryOp).isQueryOp()
+		assert.Equal(t, "a", o.Field())
+		assert.True(t, o.Valueless())
+	}
+	assert.Equal(t, 1, Between("a", 1, 2).From())
+	assert.Equal(t, 2, Between("a", 1, 2).To())
+	assert.Equal(t, []interface{}{1, 2}, NotIn("a", 1, 2).List())
+
+	directives := []QueryDirective{Asc(), Desc(), Limit(10), Page("p"), Select("a")}
 	for _, o := range directives {
 		o.isQueryDirective()
 		q, ok := o.(QueryOp)
@@ -47,6 +78,63 @@ func TestUpdateOp(t *testing.T) {
 			assert.Equal(t, 10, v.Limit)
 		case *PageQueryDirective:
 			assert.Equal(t, "p", v.Page)
+		case *SelectQueryDirective:
+			v.isGetOp()
+			assert.Equal(t, []string{"a"}, v.Fields)
 		}
 	}
 }
+
+func TestUpdateApplies(t *testing.T) {
+	early := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+	assert.True(t, UpdateApplies(Update{Name: "a", Op: SetIfAbsent("a"), Value: 1}, nil))
+	assert.False(t, UpdateApplies(Update{Name: "a", Op: SetIfAbsent("a"), Value: 1}, 2))
+	assert.True(t, UpdateApplies(Update{Name: "a", Op: Max("a"), Value: int64(3)}, int64(2)))
+	assert.False(t, UpdateApplies(Update{Name: "a", Op: Max("a"), Value: int64(2)}, int64(2)))
+	assert.True(t, UpdateApplies(Update{Name: "a", Op: Max("a"), Value: &late}, early))
+	assert.False(t, UpdateApplies(Update{Name: "a", Op: Max("a"), Value: early}, late))
+	assert.True(t, UpdateApplies(Update{Name: "a", Op: Min("a"), Value: 1}, int64(2)))
+	assert.False(t, UpdateApplies(Update{Name: "a", Op: Min("a"), Value: 3}, int64(2)))
+	assert.True(t, UpdateApplies(Update{Name: "a", Op: Add("a"), Value: 3}, int64(2)))
+}
+
+func TestWhereCondition(t *testing.T) {
+	for operator, expected := range map[string]Condition{
+		"=":           Equal("a"),
+		"==":          Equal("a"),
+		"!=":          NotEqual("a"),
+		"<":           LessThan("a"),
+		"<=":          LessThanOrEqual("a"),
+		">":           GreaterThan("a"),
+		">=":          GreaterThanOrEqual("a"),
+		"begins-with": BeginsWith("a"),
+		"contains":    Contains("a"),
+		"in":          In("a", 1, 2),
+		"not-in":      NotIn("a", 1, 2),
+	} {
+		w := Where("a", operator, []int{1, 2})
+		assert.Equal(t, operator, w.Operator())
+		assert.Equal(t, []int{1, 2}, w.Value())
+		c, err := w.Condition()
+		assert.NoError(t, err, operator)
+		assert.Equal(t, expected, c, operator)
+	}
+
+	_, err := Where("a", "~", 1).Condition()
+	assert.ErrorIs(t, err, ErrInvalidCondition)
+	_, err = Where("a", "in", 1).Condition()
+	assert.ErrorIs(t, err, ErrInvalidCondition)
+}
+
+func TestConsistentRead(t *testing.T) {
+	assert.False(t, ConsistentRead([]QueryOp{Limit(1)}))
+	assert.True(t, ConsistentRead([]GetOp{Select(), Consistent()}))
+}
+
+func TestReadTime(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	assert.True(t, ReadTime([]QueryOp{Limit(1)}).IsZero())
+	assert.Equal(t, at, ReadTime([]QueryOp{Limit(1), AsOf(at)}))
+	assert.Equal(t, at, ReadTime([]GetOp{Select(), AsOf(at)}))
+}
@@ -0,0 +1,42 @@
+package depot
+
+import "time"
+
+// Options holds the settings shared by every backend.
+type Options struct {
+	PageCodec PageCodec
+	Clock     func() time.Time
+}
+
+// Option changes the Options a backend is created with.
+type Option func(*Options)
+
+// NewOptions returns the default options with opts applied.
+func NewOptions(opts ...Option) (o Options) {
+	o.PageCodec = NewPageCodec()
+	o.Clock = Now
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return
+}
+
+// WithPageCodec sets the codec used for the page tokens returned by Query.
+func WithPageCodec(codec PageCodec) Option {
+	return func(o *Options) {
+		o.PageCodec = codec
+	}
+}
+
+// WithClock sets the clock that created and updated fields are stamped from.
+func WithClock(clock func() time.Time) Option {
+	return func(o *Options) {
+		o.Clock = clock
+	}
+}
+
+// Now is the default clock. It returns the current time in UTC truncated to
+// microseconds, the precision Firestore and Datastore store.
+func Now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
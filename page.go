@@ -0,0 +1,217 @@
+package depot
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+// PageCodec turns the pagination state of a backend into the page tokens
+// returned by Query and back. The shape identifies the query a token belongs
+// to, so a token is only accepted by the query that produced it. An empty page
+// always encodes to an empty token.
+type PageCodec interface {
+	Encode(shape []byte, page string) (string, error)
+	Decode(shape []byte, token string) (string, error)
+}
+
+const (
+	pageVersionPlain byte = iota + 1
+	pageVersionSigned
+	pageVersionEncrypted
+)
+
+const (
+	pageShapeSize = 8
+	pageTagSize   = 16
+)
+
+// PageShape hashes the parts of a query that a page token is bound to: the
+// table, the index, the filter and the sort order.
+func PageShape(table, kind string, conditions []EntityCondition, ops []QueryOp) []byte {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", table, kind)
+	shapeConditions(h, conditions)
+	for _, op := range ops {
+		switch op.(type) {
+		case *AscQueryDirective, *DescQueryDirective:
+			fmt.Fprintf(h, "%T\x00", op)
+		}
+	}
+	return h.Sum(nil)
+}
+
+// shapeConditions writes the conditions to w, those an Or, And or Not combines
+// in place of the composite itself.
+func shapeConditions(w io.Writer, conditions []EntityCondition) {
+	for _, c := range conditions {
+		if _, ok := c.Op.(CompositeCondition); ok {
+			fmt.Fprintf(w, "%T\x00(", c.Op)
+			shapeConditions(w, c.Conditions)
+			fmt.Fprint(w, ")\x00")
+			continue
+		}
+		fmt.Fprintf(w, "%s\x00%T\x00%v\x00%v\x00", c.Name, c.Op, c.Op, c.Value)
+	}
+}
+
+// DecodePageOps returns ops with the token of every Page op replaced by the
+// backend page it encodes.
+func DecodePageOps(codec PageCodec, shape []byte, ops []QueryOp) (out []QueryOp, err error) {
+	var page string
+	out = make([]QueryOp, len(ops))
+	for i, op := range ops {
+		if p, ok := op.(*PageQueryDirective); ok {
+			if page, err = codec.Decode(shape, p.Page); err != nil {
+				return nil, err
+			}
+			op = Page(page)
+		}
+		out[i] = op
+	}
+	return
+}
+
+type plainPageCodec struct{}
+
+// NewPageCodec returns the default codec, which versions tokens and binds them
+// to the query shape but neither signs nor encrypts them.
+func NewPageCodec() PageCodec {
+	return plainPageCodec{}
+}
+
+func (plainPageCodec) Encode(shape []byte, page string) (string, error) {
+	if page == "" {
+		return "", nil
+	}
+	b := append([]byte{pageVersionPlain}, shape[:pageShapeSize]...)
+	return encodeToken(append(b, page...)), nil
+}
+
+func (plainPageCodec) Decode(shape []byte, token string) (page string, err error) {
+	var b []byte
+	if token == "" {
+		return
+	}
+	if b, err = decodeToken(token, pageVersionPlain, pageShapeSize); err != nil {
+		return
+	}
+	if !bytes.Equal(b[:pageShapeSize], shape[:pageShapeSize]) {
+		return "", ErrInvalidPage
+	}
+	return string(b[pageShapeSize:]), nil
+}
+
+type signedPageCodec struct {
+	key []byte
+}
+
+// NewSignedPageCodec returns a codec that signs tokens with HMAC-SHA256 so they
+// cannot be forged or moved to another query. The page itself stays readable.
+func NewSignedPageCodec(key []byte) PageCodec {
+	return &signedPageCodec{key: key}
+}
+
+func (c *signedPageCodec) Encode(shape []byte, page string) (string, error) {
+	if page == "" {
+		return "", nil
+	}
+	b := append([]byte{pageVersionSigned}, page...)
+	return encodeToken(append(b, c.tag(shape, b)...)), nil
+}
+
+func (c *signedPageCodec) Decode(shape []byte, token string) (page string, err error) {
+	var b []byte
+	if token == "" {
+		return
+	}
+	if b, err = decodeToken(token, pageVersionSigned, pageTagSize); err != nil {
+		return
+	}
+	n := len(b) - pageTagSize
+	if !hmac.Equal(b[n:], c.tag(shape, append([]byte{pageVersionSigned}, b[:n]...))) {
+		return "", ErrInvalidPage
+	}
+	return string(b[:n]), nil
+}
+
+func (c *signedPageCodec) tag(shape, b []byte) []byte {
+	m := hmac.New(sha256.New, c.key)
+	m.Write(shape)
+	m.Write(b)
+	return m.Sum(nil)[:pageTagSize]
+}
+
+type encryptedPageCodec struct {
+	aead cipher.AEAD
+}
+
+// NewEncryptedPageCodec returns a codec that encrypts tokens with AES-GCM so
+// they cannot be read, forged or moved to another query. The key must be 16,
+// 24 or 32 bytes long.
+func NewEncryptedPageCodec(key []byte) (_ PageCodec, err error) {
+	var (
+		block cipher.Block
+		aead  cipher.AEAD
+	)
+	if block, err = aes.NewCipher(key); err != nil {
+		return
+	}
+	if aead, err = cipher.NewGCM(block); err != nil {
+		return
+	}
+	return &encryptedPageCodec{aead: aead}, nil
+}
+
+func (c *encryptedPageCodec) Encode(shape []byte, page string) (string, error) {
+	if page == "" {
+		return "", nil
+	}
+	b := make([]byte, 1+c.aead.NonceSize(), 1+c.aead.NonceSize()+len(page)+c.aead.Overhead())
+	b[0] = pageVersionEncrypted
+	if _, err := io.ReadFull(rand.Reader, b[1:]); err != nil {
+		return "", err
+	}
+	return encodeToken(c.aead.Seal(b, b[1:], []byte(page), c.data(shape))), nil
+}
+
+func (c *encryptedPageCodec) Decode(shape []byte, token string) (page string, err error) {
+	var b, plain []byte
+	if token == "" {
+		return
+	}
+	if b, err = decodeToken(token, pageVersionEncrypted, c.aead.NonceSize()+c.aead.Overhead()); err != nil {
+		return
+	}
+	n := c.aead.NonceSize()
+	if plain, err = c.aead.Open(nil, b[:n], b[n:], c.data(shape)); err != nil {
+		return "", ErrInvalidPage
+	}
+	return string(plain), nil
+}
+
+func (c *encryptedPageCodec) data(shape []byte) []byte {
+	return append([]byte{pageVersionEncrypted}, shape...)
+}
+
+func encodeToken(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeToken returns the bytes of a token after its version, which must be
+// at least size bytes long.
+func decodeToken(token string, version byte, size int) (b []byte, err error) {
+	if b, err = base64.RawURLEncoding.DecodeString(token); err != nil {
+		return nil, ErrInvalidPage
+	}
+	if len(b) < 1+size || b[0] != version {
+		return nil, ErrInvalidPage
+	}
+	return b[1:], nil
+}
@@ -0,0 +1,101 @@
+package depot
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageShape(t *testing.T) {
+	conditions := []EntityCondition{{Name: "tenantId", Value: "a", KeyType: KeyTypePartition}}
+	shape := PageShape("table", "", conditions, []QueryOp{Limit(1)})
+	assert.Equal(t, shape, PageShape("table", "", conditions, []QueryOp{Limit(2), Page("p")}))
+
+	other := []EntityCondition{{Name: "tenantId", Value: "b", KeyType: KeyTypePartition}}
+	assert.NotEqual(t, shape, PageShape("table", "", other, nil))
+	assert.NotEqual(t, shape, PageShape("other", "", conditions, nil))
+	assert.NotEqual(t, shape, PageShape("table", "index", conditions, nil))
+	assert.NotEqual(t, shape, PageShape("table", "", conditions, []QueryOp{Desc()}))
+	assert.NotEqual(t, PageShape("table", "", []EntityCondition{{Name: "a", Op: In("a", 1)}}, nil),
+		PageShape("table", "", []EntityCondition{{Name: "a", Op: In("a", 2)}}, nil))
+}
+
+func TestPageCodecs(t *testing.T) {
+	encrypted, err := NewEncryptedPageCodec([]byte("0123456789abcdef"))
+	assert.NoError(t, err)
+	_, err = NewEncryptedPageCodec([]byte("short"))
+	assert.Error(t, err)
+
+	shape := PageShape("table", "", nil, nil)
+	otherShape := PageShape("other", "", nil, nil)
+	codecs := map[string]PageCodec{
+		"plain":     NewPageCodec(),
+		"signed":    NewSignedPageCodec([]byte("secret")),
+		"encrypted": encrypted,
+	}
+	for name, codec := range codecs {
+		token, err := codec.Encode(shape, "page")
+		assert.NoError(t, err, name)
+		assert.NotEqual(t, "page", token, name)
+
+		page, err := codec.Decode(shape, token)
+		assert.NoError(t, err, name)
+		assert.Equal(t, "page", page, name)
+
+		token, err = codec.Encode(shape, "")
+		assert.NoError(t, err, name)
+		assert.Empty(t, token, name)
+		page, err = codec.Decode(shape, "")
+		assert.NoError(t, err, name)
+		assert.Empty(t, page, name)
+
+		token, _ = codec.Encode(shape, "page")
+		_, err = codec.Decode(otherShape, token)
+		assert.ErrorIs(t, err, ErrInvalidPage, name)
+
+		b, _ := base64.RawURLEncoding.DecodeString(token)
+		b[len(b)-1] ^= 1
+		_, err = codec.Decode(shape, base64.RawURLEncoding.EncodeToString(b))
+		if name != "plain" {
+			assert.ErrorIs(t, err, ErrInvalidPage, name)
+		}
+
+		for _, bad := range []string{"!", "AA"} {
+			_, err = codec.Decode(shape, bad)
+			assert.ErrorIs(t, err, ErrInvalidPage, name)
+		}
+		for other, c := range codecs {
+			if other == name {
+				continue
+			}
+			token, _ = c.Encode(shape, "page")
+			_, err = codec.Decode(shape, token)
+			assert.ErrorIs(t, err, ErrInvalidPage, name+" decoding "+other)
+		}
+	}
+
+	token, _ := NewSignedPageCodec([]byte("secret")).Encode(shape, "page")
+	_, err = NewSignedPageCodec([]byte("other")).Decode(shape, token)
+	assert.ErrorIs(t, err, ErrInvalidPage)
+}
+
+func TestDecodePageOps(t *testing.T) {
+	codec := NewPageCodec()
+	shape := PageShape("table", "", nil, nil)
+	token, _ := codec.Encode(shape, "page")
+	limit := Limit(2)
+
+	ops, err := DecodePageOps(codec, shape, []QueryOp{limit, Page(token)})
+	assert.NoError(t, err)
+	assert.Equal(t, []QueryOp{limit, Page("page")}, ops)
+
+	_, err = DecodePageOps(codec, shape, []QueryOp{Page("!")})
+	assert.ErrorIs(t, err, ErrInvalidPage)
+}
+
+func TestNewOptions(t *testing.T) {
+	assert.Equal(t, NewPageCodec(), NewOptions().PageCodec)
+	codec := NewSignedPageCodec([]byte("secret"))
+	assert.Equal(t, codec, NewOptions(WithPageCodec(codec)).PageCodec)
+}
@@ -0,0 +1,293 @@
+package depot
+
+import (
+	"reflect"
+	"strings"
+)
+
+var anyType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// IsPath reports whether name is a dotted path to a value nested in a map or
+// struct field rather than the name of a top-level field.
+func IsPath(name string) bool {
+	return strings.Contains(name, ".")
+}
+
+// PathParts splits a dotted path into the names it is made of.
+func PathParts(path string) []string {
+	return strings.Split(path, ".")
+}
+
+// CheckPath fails with ErrInvalidFieldPath unless path leads from a field of
+// the entity type t through struct fields and map keys. Anything may follow a
+// map of interfaces.
+func CheckPath(t reflect.Type, path string) error {
+	_, err := PathType(t, path)
+	return err
+}
+
+// PathType returns the type of the value at path within the entity type t,
+// which is an interface type once the path passes a map of interfaces. It
+// fails as CheckPath does.
+func PathType(t reflect.Type, path string) (reflect.Type, error) {
+	for _, name := range PathParts(path) {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch {
+		case t.Kind() == reflect.Interface:
+			return t, nil
+		case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String:
+			t = t.Elem()
+		case t.Kind() == reflect.Struct && t != timeType:
+			i, ok := structField(t, name)
+			if !ok {
+				return nil, ErrInvalidFieldPath
+			}
+			t = t.Field(i).Type
+		default:
+			return nil, ErrInvalidFieldPath
+		}
+	}
+	return t, nil
+}
+
+// PathValue returns the value at path within v, which may be an entity or a
+// stored item, or nil when there is none.
+func PathValue(v interface{}, path string) interface{} {
+	rv := reflect.ValueOf(v)
+	for _, name := range PathParts(path) {
+		if rv = pathElem(rv, name); !rv.IsValid() {
+			return nil
+		}
+	}
+	return rv.Interface()
+}
+
+// StoredValue returns the value of the field or dotted path name in the stored
+// item m.
+func StoredValue(m map[string]interface{}, name string) interface{} {
+	if IsPath(name) {
+		return PathValue(m, name)
+	}
+	return m[name]
+}
+
+// SetPathValue stores value at path within the item m. Maps and structs along
+// the path are copied rather than changed in place, and missing ones are made.
+func SetPathValue(m map[string]interface{}, path string, value interface{}) (err error) {
+	var (
+		parts = PathParts(path)
+		v     reflect.Value
+	)
+	if v, err = setPath(reflect.ValueOf(m[parts[0]]), anyType, parts[1:], value); err != nil {
+		return
+	}
+	m[parts[0]] = v.Interface()
+	return
+}
+
+// DeletePathValue removes the value at path from the item m, copying the maps
+// and structs along the path rather than changing them in place.
+func DeletePathValue(m map[string]interface{}, path string) (err error) {
+	var (
+		parts = PathParts(path)
+		v     reflect.Value
+	)
+	if len(parts) == 1 {
+		delete(m, path)
+		return
+	}
+	if _, ok := m[parts[0]]; !ok {
+		return
+	}
+	if v, err = deletePath(reflect.ValueOf(m[parts[0]]), parts[1:]); err != nil {
+		return
+	}
+	m[parts[0]] = v.Interface()
+	return
+}
+
+// structField returns the index of the field of the struct type t that is
+// stored under name.
+func structField(t reflect.Type, name string) (int, bool) {
+	s, _, err := GetStruct(reflect.New(t))
+	if err != nil {
+		return 0, false
+	}
+	for i, f := range s {
+		if f.Name == name && f.Mode != FieldModeExclude {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// pathElem returns the value stored under name in the map or struct v.
+func pathElem(v reflect.Value, name string) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	switch {
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		return v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+	case v.Kind() == reflect.Struct && v.Type() != timeType:
+		if i, ok := structField(v.Type(), name); ok {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// setPath returns a copy of v, which holds a t, with value stored at path.
+func setPath(v reflect.Value, t reflect.Type, path []string, value interface{}) (reflect.Value, error) {
+	if v.IsValid() && v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if len(path) == 0 {
+		return convertValue(reflect.ValueOf(value), t)
+	}
+	if t.Kind() == reflect.Interface {
+		t = reflect.TypeOf(map[string]interface{}{})
+		if v.IsValid() {
+			t = v.Type()
+		}
+	}
+	switch {
+	case t.Kind() == reflect.Ptr:
+		n := reflect.New(t.Elem())
+		if v.IsValid() && !v.IsNil() {
+			n.Elem().Set(v.Elem())
+		}
+		elem, err := setPath(n.Elem(), t.Elem(), path, value)
+		if err != nil {
+			return v, err
+		}
+		n.Elem().Set(elem)
+		return n, nil
+	case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String:
+		n := copyMap(v, t)
+		k := reflect.ValueOf(path[0]).Convert(t.Key())
+		elem, err := setPath(n.MapIndex(k), t.Elem(), path[1:], value)
+		if err != nil {
+			return v, err
+		}
+		n.SetMapIndex(k, elem)
+		return n, nil
+	case t.Kind() == reflect.Struct && t != timeType:
+		i, ok := structField(t, path[0])
+		if !ok {
+			return v, ErrInvalidFieldPath
+		}
+		n := reflect.New(t).Elem()
+		if v.IsValid() {
+			n.Set(v)
+		}
+		elem, err := setPath(n.Field(i), t.Field(i).Type, path[1:], value)
+		if err != nil {
+			return v, err
+		}
+		n.Field(i).Set(elem)
+		return n, nil
+	}
+	return v, ErrInvalidFieldPath
+}
+
+// deletePath returns a copy of v without the value at path.
+func deletePath(v reflect.Value, path []string) (reflect.Value, error) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return v, nil
+	}
+	switch {
+	case v.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			return v, nil
+		}
+		elem, err := deletePath(v.Elem(), path)
+		if err != nil {
+			return v, err
+		}
+		n := reflect.New(v.Type().Elem())
+		n.Elem().Set(elem)
+		return n, nil
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		k := reflect.ValueOf(path[0]).Convert(v.Type().Key())
+		elem := v.MapIndex(k)
+		if !elem.IsValid() {
+			return v, nil
+		}
+		n := copyMap(v, v.Type())
+		if len(path) == 1 {
+			n.SetMapIndex(k, reflect.Value{})
+			return n, nil
+		}
+		elem, err := deletePath(elem, path[1:])
+		if err != nil {
+			return v, err
+		}
+		n.SetMapIndex(k, elem)
+		return n, nil
+	case v.Kind() == reflect.Struct && v.Type() != timeType:
+		i, ok := structField(v.Type(), path[0])
+		if !ok {
+			return v, ErrInvalidFieldPath
+		}
+		n := reflect.New(v.Type()).Elem()
+		n.Set(v)
+		if len(path) == 1 {
+			n.Field(i).SetZero()
+			return n, nil
+		}
+		elem, err := deletePath(n.Field(i), path[1:])
+		if err != nil {
+			return v, err
+		}
+		n.Field(i).Set(elem)
+		return n, nil
+	}
+	return v, ErrInvalidFieldPath
+}
+
+// copyMap returns a copy of the map v, of type t, which may be missing or nil.
+func copyMap(v reflect.Value, t reflect.Type) reflect.Value {
+	n := reflect.MakeMap(t)
+	if v.IsValid() && !v.IsNil() {
+		iter := v.MapRange()
+		for iter.Next() {
+			n.SetMapIndex(iter.Key(), iter.Value())
+		}
+	}
+	return n
+}
+
+// convertValue converts v to the type t, failing with ErrInvalidTransform when
+// it cannot be. Numbers convert between kinds, other values only between types
+// of the same kind.
+func convertValue(v reflect.Value, t reflect.Type) (reflect.Value, error) {
+	switch {
+	case !v.IsValid():
+		return reflect.Zero(t), nil
+	case t.Kind() == reflect.Interface || v.Type() == t:
+		return v, nil
+	case convertible(v.Type(), t):
+		return v.Convert(t), nil
+	case t.Kind() == reflect.Ptr && convertible(v.Type(), t.Elem()):
+		n := reflect.New(t.Elem())
+		n.Elem().Set(v.Convert(t.Elem()))
+		return n, nil
+	}
+	return v, ErrInvalidTransform
+}
+
+func convertible(from, to reflect.Type) bool {
+	if !from.ConvertibleTo(to) {
+		return false
+	}
+	return from.Kind() == to.Kind() || (isNumberKind(from.Kind()) && isNumberKind(to.Kind()))
+}
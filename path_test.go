@@ -0,0 +1,80 @@
+package depot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type pathStats struct {
+	Views int64 `depot:"views"`
+	Skip  int64 `depot:"-"`
+}
+
+type pathEntity struct {
+	ID    string                     `depot:"id,pk"`
+	Name  string                     `depot:"name"`
+	Stats pathStats                  `depot:"stats"`
+	Prefs map[string]map[string]bool `depot:"prefs"`
+	Data  map[string]interface{}     `depot:"data"`
+}
+
+func TestCheckPath(t *testing.T) {
+	typ := reflect.TypeOf(pathEntity{})
+	assert.NoError(t, CheckPath(typ, "stats.views"))
+	assert.NoError(t, CheckPath(typ, "prefs.a.b"))
+	assert.NoError(t, CheckPath(typ, "data.a.b.c"))
+	assert.ErrorIs(t, CheckPath(typ, "stats.skip"), ErrInvalidFieldPath)
+	assert.ErrorIs(t, CheckPath(typ, "stats.views.x"), ErrInvalidFieldPath)
+	assert.ErrorIs(t, CheckPath(typ, "prefs.a.b.c"), ErrInvalidFieldPath)
+	assert.ErrorIs(t, CheckPath(typ, "name.x"), ErrInvalidFieldPath)
+}
+
+func TestPathValue(t *testing.T) {
+	e := pathEntity{Stats: pathStats{Views: 2}, Prefs: map[string]map[string]bool{"a": {"b": true}}}
+	assert.Equal(t, int64(2), PathValue(e, "stats.views"))
+	assert.Equal(t, true, PathValue(&e, "prefs.a.b"))
+	assert.Nil(t, PathValue(e, "prefs.x.b"))
+	assert.Nil(t, PathValue(e, "data.c"))
+
+	m := map[string]interface{}{"data": map[string]interface{}{"c": "d"}, "name": "n"}
+	assert.Equal(t, "d", StoredValue(m, "data.c"))
+	assert.Equal(t, "n", StoredValue(m, "name"))
+}
+
+func TestSetPathValue(t *testing.T) {
+	prefs := map[string]map[string]bool{"a": {"b": true}}
+	m := map[string]interface{}{"prefs": prefs, "stats": pathStats{Views: 1}}
+	assert.NoError(t, SetPathValue(m, "prefs.a.c", true))
+	assert.NoError(t, SetPathValue(m, "prefs.x.y", true))
+	assert.NoError(t, SetPathValue(m, "stats.views", 3))
+	assert.NoError(t, SetPathValue(m, "data.c.d", "e"))
+	assert.NoError(t, SetPathValue(m, "name", "n"))
+	assert.Equal(t, map[string]interface{}{
+		"prefs": map[string]map[string]bool{"a": {"b": true, "c": true}, "x": {"y": true}},
+		"stats": pathStats{Views: 3},
+		"data":  map[string]interface{}{"c": map[string]interface{}{"d": "e"}},
+		"name":  "n",
+	}, m)
+	// The maps along the path are copied.
+	assert.Equal(t, map[string]map[string]bool{"a": {"b": true}}, prefs)
+
+	assert.ErrorIs(t, SetPathValue(m, "prefs.a.c", "yes"), ErrInvalidTransform)
+	assert.ErrorIs(t, SetPathValue(m, "stats.unknown", 1), ErrInvalidFieldPath)
+	assert.ErrorIs(t, SetPathValue(m, "name.x", 1), ErrInvalidFieldPath)
+}
+
+func TestDeletePathValue(t *testing.T) {
+	prefs := map[string]map[string]bool{"a": {"b": true, "c": false}}
+	m := map[string]interface{}{"prefs": prefs, "stats": pathStats{Views: 1}, "name": "n"}
+	assert.NoError(t, DeletePathValue(m, "prefs.a.b"))
+	assert.NoError(t, DeletePathValue(m, "stats.views"))
+	assert.NoError(t, DeletePathValue(m, "data.c"))
+	assert.NoError(t, DeletePathValue(m, "name"))
+	assert.Equal(t, map[string]interface{}{
+		"prefs": map[string]map[string]bool{"a": {"c": false}},
+		"stats": pathStats{},
+	}, m)
+	assert.Equal(t, map[string]map[string]bool{"a": {"b": true, "c": false}}, prefs)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -113,6 +114,13 @@ func EntityFromMap(m map[string]any, entity any, convertTTL bool) (err error) {
 		f := s[i]
 		fld := ev.Field(i)
 		if v, ok := m[f.Name]; ok {
+			// Nested structs are stored as maps once a path has been set in them.
+			if sub, isMap := v.(map[string]interface{}); isMap && fld.Kind() == reflect.Struct && fld.Type() != timeType {
+				if err = EntityFromMap(sub, fld.Addr().Interface(), convertTTL); err != nil {
+					return
+				}
+				continue
+			}
 			v = RealSlice(v)
 			if fld.Kind() == reflect.Map && fld.Type().Elem().Kind() != reflect.Interface {
 				v = RealMap(v)
@@ -156,35 +164,214 @@ type Update struct {
 	Op    UpdateOp
 }
 
+// EntityUpdates returns the fields of entity to write and the ops to write them
+// with. Ops on a dotted path write the nested value alone, so the field holding
+// it is not written as a whole, and the entity fields an Or, And or Not compares
+// are only checked. Where and Between leave the field they compare to be
+// written.
 func EntityUpdates(entity interface{}, ops []UpdateOp) (updates []Update, err error) {
 	var (
-		s Struct
-		v = reflect.ValueOf(entity)
+		s      Struct
+		v      = reflect.ValueOf(entity)
+		nested = make(map[string]bool)
+		paths  []Update
+		u      Update
+		ok     bool
 	)
+	if err = checkLists(ops); err != nil {
+		return
+	}
 	if s, v, err = GetStruct(v); err != nil {
 		return
 	}
+	for _, op := range ops {
+		if c, ok := op.(Condition); ok && resolved(c) {
+			var ec EntityCondition
+			if ec, err = resolveCondition(s, v, c); err != nil {
+				return
+			}
+			for _, name := range entityFields(c) {
+				nested[PathParts(name)[0]] = true
+			}
+			paths = append(paths, Update{Value: ec, Op: op})
+			continue
+		}
+		if !IsPath(op.Field()) {
+			continue
+		}
+		var fv reflect.Value
+		if fv, err = entityPath(s, v, op.Field()); err != nil {
+			return
+		}
+		nested[PathParts(op.Field())[0]] = true
+		if u, ok, err = fieldUpdate(op.Field(), fv, op); err != nil {
+			return
+		} else if ok {
+			paths = append(paths, u)
+		}
+	}
 	ln := len(s)
 	for i := 0; i < ln; i++ {
 		f := s[i]
-		fv := v.Field(i)
-		op := GetUpdateOp(ops, f.Name)
-		_, force := op.(*ForceUpdateOp)
 		if f.Mode == FieldModeExclude ||
 			f.Mode == FieldModePartition ||
 			f.Mode == FieldModeSort ||
-			(fv.IsZero() && !force) {
+			f.Version ||
+			f.Created ||
+			f.Updated ||
+			nested[f.Name] {
 			continue
 		}
-		updates = append(updates, Update{
-			Name:  f.Name,
-			Value: fv.Interface(),
-			Op:    GetUpdateOp(ops, f.Name),
-		})
+		if u, ok, err = fieldUpdate(f.Name, v.Field(i), GetUpdateOp(ops, f.Name)); err != nil {
+			return
+		} else if ok {
+			updates = append(updates, u)
+		}
+	}
+	return append(updates, paths...), nil
+}
+
+// fieldUpdate returns the update of the field or path name, which holds fv, and
+// whether there is one. Zero values are only written by the ops that need no
+// value, and conditions compare them as they are, like those of a Put.
+func fieldUpdate(name string, fv reflect.Value, op UpdateOp) (u Update, ok bool, err error) {
+	_, force := op.(*ForceUpdateOp)
+	_, remove := op.(*RemoveUpdateOp)
+	_, isCondition := op.(Condition)
+	if IsListUpdateOp(op) {
+		if fv.Kind() != reflect.Slice && fv.Kind() != reflect.Array {
+			return u, false, ErrInvalidTransform
+		}
+		// An empty list changes nothing.
+		if fv.Len() == 0 {
+			return
+		}
+	}
+	if !fv.IsValid() || fv.IsZero() {
+		if !force && !remove && !isCondition {
+			return
+		}
+		if !fv.IsValid() {
+			return Update{Name: name, Op: op}, true, nil
+		}
+	}
+	return Update{Name: name, Value: fv.Interface(), Op: op}, true, nil
+}
+
+// entityPath returns the value at path within the entity struct v, which is
+// invalid when a map along it lacks a key. The path must lead from a field that
+// is not a key, version or timestamp.
+func entityPath(s Struct, v reflect.Value, path string) (fv reflect.Value, err error) {
+	parts := PathParts(path)
+	for i, f := range s {
+		if f.Name != parts[0] {
+			continue
+		}
+		if f.Mode == FieldModeExclude || f.Mode == FieldModePartition || f.Mode == FieldModeSort ||
+			f.Version || f.Created || f.Updated {
+			break
+		}
+		if err = CheckPath(v.Type(), path); err != nil {
+			return
+		}
+		fv = v.Field(i)
+		for _, name := range parts[1:] {
+			if fv = pathElem(fv, name); !fv.IsValid() {
+				return
+			}
+		}
+		if fv.Kind() == reflect.Interface {
+			fv = fv.Elem()
+		}
+		return
+	}
+	return fv, ErrInvalidFieldPath
+}
+
+// ClearFields sets the named fields of entity, which must be a pointer to a
+// struct, to their zero values. Names may be dotted paths, whose map keys are
+// deleted.
+func ClearFields(entity interface{}, names ...string) (err error) {
+	var (
+		s Struct
+		v = reflect.ValueOf(entity)
+	)
+	if v.Kind() != reflect.Ptr {
+		return ErrInvalidEntityType
+	}
+	if s, v, err = GetStruct(v); err != nil {
+		return
+	}
+	for _, name := range names {
+		parts := PathParts(name)
+		for i, f := range s {
+			if f.Name == parts[0] {
+				clearPath(v.Field(i), parts[1:])
+			}
+		}
+	}
+	return
+}
+
+// clearPath zeroes the value at path within v, or deletes it from its map.
+func clearPath(v reflect.Value, path []string) {
+	if len(path) == 0 {
+		if v.CanSet() {
+			v.SetZero()
+		}
+		return
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String && !v.IsNil() && len(path) == 1 {
+		v.SetMapIndex(reflect.ValueOf(path[0]).Convert(v.Type().Key()), reflect.Value{})
+		return
+	}
+	clearPath(pathElem(v, path[0]), path[1:])
+}
+
+// RemovedFields returns the names of the fields the updates remove.
+func RemovedFields(updates []Update) (names []string) {
+	for _, u := range updates {
+		if _, ok := u.Op.(*RemoveUpdateOp); ok {
+			names = append(names, u.Name)
+		}
 	}
 	return
 }
 
+// EntitySlice returns the slice value behind entities, which may be a slice of
+// structs or a pointer to one.
+func EntitySlice(entities interface{}) (v reflect.Value, err error) {
+	v = reflect.ValueOf(entities)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Struct {
+		return v, ErrInvalidEntityType
+	}
+	return
+}
+
+// KeepEntities shrinks the slice v to the elements flagged in keep.
+func KeepEntities(v reflect.Value, keep []bool) (err error) {
+	if !v.CanSet() {
+		return ErrInvalidEntityType
+	}
+	out := reflect.MakeSlice(v.Type(), 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if keep[i] {
+			out = reflect.Append(out, v.Index(i))
+		}
+	}
+	v.Set(out)
+	return
+}
+
 type KeyType uint8
 
 const (
@@ -193,22 +380,211 @@ const (
 	KeyTypeSort
 )
 
+// EntityCondition pairs a condition with the value it compares. The
+// conditions combined by an Or, And or Not are held in Conditions, and the
+// composite itself has no name or value.
 type EntityCondition struct {
-	Name    string
-	Value   interface{}
-	KeyType KeyType
-	Op      Condition
+	Name       string
+	Value      interface{}
+	KeyType    KeyType
+	Op         Condition
+	Conditions []EntityCondition
 }
 
+// Fields returns the names of the fields c compares, once each.
+func (c EntityCondition) Fields() (names []string) {
+	if len(c.Conditions) == 0 {
+		return []string{c.Name}
+	}
+	for _, sub := range c.Conditions {
+		for _, name := range sub.Fields() {
+			if !contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return
+}
+
+// resolveCondition pairs the condition c with the value of its field in the
+// entity struct v, resolving the conditions a composite combines in turn.
+func resolveCondition(s Struct, v reflect.Value, c Condition) (ec EntityCondition, err error) {
+	var fv reflect.Value
+	ec.Op = c
+	if cc, ok := c.(CompositeCondition); ok {
+		for _, sub := range cc.Conditions() {
+			var r EntityCondition
+			if r, err = resolveCondition(s, v, sub); err != nil {
+				return
+			}
+			ec.Conditions = append(ec.Conditions, r)
+		}
+		return
+	}
+	ec.Name = c.Field()
+	if vc, ok := c.(ValueCondition); ok {
+		return valueCondition(s, v, ec, vc)
+	}
+	if IsPath(ec.Name) {
+		if fv, err = entityPath(s, v, ec.Name); err != nil {
+			return
+		}
+	} else {
+		i, ok := fieldIndex(s, ec.Name)
+		if !ok {
+			return ec, ErrInvalidFieldPath
+		}
+		fv = v.Field(i)
+	}
+	if fv.IsValid() {
+		ec.Value = fv.Interface()
+	}
+	return
+}
+
+// valueCondition resolves the Where or Between c, which carries its values,
+// checking only that the entity has the field it compares.
+func valueCondition(s Struct, v reflect.Value, ec EntityCondition, c ValueCondition) (EntityCondition, error) {
+	if IsPath(ec.Name) {
+		if err := CheckPath(v.Type(), ec.Name); err != nil {
+			return ec, err
+		}
+	} else if _, ok := fieldIndex(s, ec.Name); !ok {
+		return ec, ErrInvalidFieldPath
+	}
+	if w, ok := c.(*WhereCondition); ok {
+		op, err := w.Condition()
+		if err != nil {
+			return ec, err
+		}
+		ec.Op, ec.Value = op, w.Value()
+	}
+	return ec, nil
+}
+
+// resolved reports whether c is resolved as a whole rather than paired with the
+// field it names: an Or, And or Not, or a condition that carries its values.
+func resolved(c Condition) bool {
+	switch c.(type) {
+	case CompositeCondition, ValueCondition:
+		return true
+	}
+	return false
+}
+
+// entityFields returns the fields whose values c takes from the entity.
+func entityFields(c Condition) (names []string) {
+	switch o := c.(type) {
+	case ValueCondition:
+	case CompositeCondition:
+		for _, sub := range o.Conditions() {
+			names = append(names, entityFields(sub)...)
+		}
+	default:
+		names = append(names, c.Field())
+	}
+	return
+}
+
+// checkLists fails with ErrInvalidCondition when any of the ops, or of the
+// conditions they combine, is an In or NotIn with an empty list.
+func checkLists[O any](ops []O) error {
+	for _, op := range ops {
+		if c, ok := any(op).(Condition); ok && emptyList(c) {
+			return ErrInvalidCondition
+		}
+	}
+	return nil
+}
+
+func emptyList(c Condition) bool {
+	switch o := c.(type) {
+	case *InCondition:
+		return len(o.List()) == 0
+	case *NotInCondition:
+		return len(o.List()) == 0
+	case CompositeCondition:
+		for _, sub := range o.Conditions() {
+			if emptyList(sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func fieldIndex(s Struct, name string) (int, bool) {
+	for i, f := range s {
+		if f.Name == name && f.Mode != FieldModeExclude {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// EntityConditions pairs the non-zero fields of entity with the conditions the
+// query ops name for them, Equal by default. A field that conditions on dotted
+// paths address is only compared through them.
 func EntityConditions(kind string, entity interface{}, ops []QueryOp) (sortField string, conditions []EntityCondition, err error) {
 	var (
-		s  Struct
-		v  = reflect.ValueOf(entity)
-		kt KeyType
+		s      Struct
+		v      = reflect.ValueOf(entity)
+		kt     KeyType
+		nested = make(map[string]bool)
+		paths  []EntityCondition
 	)
+	if err = checkLists(ops); err != nil {
+		return
+	}
 	if s, v, err = GetStruct(v); err != nil {
 		return
 	}
+	for _, op := range ops {
+		if c, ok := op.(Condition); ok && resolved(c) {
+			var ec EntityCondition
+			if ec, err = resolveCondition(s, v, c); err != nil {
+				return
+			}
+			for _, name := range entityFields(c) {
+				nested[PathParts(name)[0]] = true
+			}
+			if i, ok := fieldIndex(s, ec.Name); ok {
+				switch GetMode(kind, s[i]) {
+				case FieldModePartition:
+					ec.KeyType = KeyTypePartition
+				case FieldModeSort:
+					ec.KeyType = KeyTypeSort
+				}
+			}
+			paths = append(paths, ec)
+			continue
+		}
+		c, ok := op.(Condition)
+		if !ok || !IsPath(c.Field()) {
+			continue
+		}
+		var fv reflect.Value
+		if fv, err = entityPath(s, v, c.Field()); err != nil {
+			return
+		}
+		nested[PathParts(c.Field())[0]] = true
+		var value interface{}
+		if fv.IsValid() && !fv.IsZero() {
+			value = fv.Interface()
+		} else if !c.Valueless() {
+			continue
+		}
+		paths = append(paths, EntityCondition{Name: c.Field(), Value: value, Op: c})
+	}
 	ln := len(s)
 	for i := 0; i < ln; i++ {
 		f := s[i]
@@ -226,6 +602,9 @@ func EntityConditions(kind string, entity interface{}, ops []QueryOp) (sortField
 			kt = KeyTypeSort
 			sortField = f.Name
 		default:
+			if nested[f.Name] {
+				continue
+			}
 			kt = KeyTypeNone
 		}
 		if fv.IsZero() {
@@ -241,6 +620,50 @@ func EntityConditions(kind string, entity interface{}, ops []QueryOp) (sortField
 			Op:      GetCondition(ops, f.Name),
 		})
 	}
+	return sortField, append(conditions, paths...), nil
+}
+
+// EntityPreconditions pairs each of the conditions with the value of its field
+// in entity. Unlike query conditions, zero values are compared as they are.
+func EntityPreconditions(entity interface{}, ops []Condition) (conditions []EntityCondition, err error) {
+	var (
+		s Struct
+		v = reflect.ValueOf(entity)
+	)
+	if err = checkLists(ops); err != nil {
+		return
+	}
+	if s, v, err = GetStruct(v); err != nil {
+		return
+	}
+	for _, op := range ops {
+		if resolved(op) || IsPath(op.Field()) {
+			var ec EntityCondition
+			if ec, err = resolveCondition(s, v, op); err != nil {
+				return
+			}
+			conditions = append(conditions, ec)
+			continue
+		}
+		for i, f := range s {
+			if f.Name != op.Field() || f.Mode == FieldModeExclude {
+				continue
+			}
+			kt := KeyTypeNone
+			switch f.Mode {
+			case FieldModePartition:
+				kt = KeyTypePartition
+			case FieldModeSort:
+				kt = KeyTypeSort
+			}
+			conditions = append(conditions, EntityCondition{
+				Name:    f.Name,
+				Value:   v.Field(i).Interface(),
+				KeyType: kt,
+				Op:      op,
+			})
+		}
+	}
 	return
 }
 
@@ -339,8 +762,11 @@ func GetMode(kind string, f Field) FieldMode {
 	return f.Mode
 }
 
+// NeedsIndex reports whether backends that index properties selectively must
+// index the field: keys, index sort keys and fields tagged indexed, which
+// queries filter on outside of any declared index.
 func NeedsIndex(f Field) bool {
-	if f.Mode == FieldModePartition || f.Mode == FieldModeSort {
+	if f.Indexed || f.Mode == FieldModePartition || f.Mode == FieldModeSort {
 		return true
 	}
 	for _, index := range f.Indexes {
@@ -353,7 +779,7 @@ func NeedsIndex(f Field) bool {
 
 func GetUpdateOp(ops []UpdateOp, field string) UpdateOp {
 	for _, op := range ops {
-		if op.Field() == field {
+		if _, ok := op.(ValueCondition); !ok && op.Field() == field {
 			return op
 		}
 	}
@@ -362,7 +788,7 @@ func GetUpdateOp(ops []UpdateOp, field string) UpdateOp {
 
 func GetCondition(ops []QueryOp, field string) Condition {
 	for _, op := range ops {
-		if qc, ok := op.(Condition); ok && qc.Field() == field {
+		if qc, ok := op.(Condition); ok && !resolved(qc) && qc.Field() == field {
 			return qc
 		}
 	}
@@ -379,11 +805,26 @@ const (
 	FieldModeSort
 )
 
+// Field describes a struct field from its depot tag, which holds the stored
+// name followed by options:
+//
+//   - pk and sk mark the partition and sort key
+//   - omitempty leaves zero values unstored
+//   - index:<name>:pk and index:<name>:sk place the field in a secondary index
+//   - indexed keeps the field indexed in backends that index properties
+//     selectively, such as Datastore, so queries can filter on it outside of
+//     any declared index
+//   - ttl, version, created and updated mark the expiry, optimistic locking
+//     version and timestamp fields
 type Field struct {
 	Name    string
 	Mode    FieldMode
 	Indexes []Index
+	Indexed bool
 	TTL     bool
+	Version bool
+	Created bool
+	Updated bool
 }
 
 type Index struct {
@@ -393,10 +834,11 @@ type Index struct {
 
 type Struct []Field
 
-var structs = make(map[reflect.Type]Struct)
+// structs caches the Struct of each entity type. Backends read entities from
+// many goroutines at once, so it is a sync.Map.
+var structs sync.Map
 
 func GetStruct(v reflect.Value) (s Struct, sv reflect.Value, err error) {
-	var ok bool
 	sv = v
 	if sv.Kind() == reflect.Ptr {
 		sv = v.Elem()
@@ -410,15 +852,15 @@ func GetStruct(v reflect.Value) (s Struct, sv reflect.Value, err error) {
 	}
 
 	t := sv.Type()
-	if s, ok = structs[t]; ok {
-		return
+	if cached, ok := structs.Load(t); ok {
+		return cached.(Struct), sv, nil
 	}
 
 	s = make(Struct, t.NumField())
 	for i := 0; i < t.NumField(); i++ {
 		s[i] = field(t, i)
 	}
-	structs[t] = s
+	structs.Store(t, s)
 	return
 }
 
@@ -445,8 +887,16 @@ func field(typ reflect.Type, i int) (fld Field) {
 				fld.Mode = FieldModeSort
 			case "omitempty":
 				fld.Mode = FieldModeOmitEmpty
+			case "indexed":
+				fld.Indexed = true
 			case "ttl":
 				fld.TTL = true
+			case "version":
+				fld.Version = true
+			case "created":
+				fld.Created = true
+			case "updated":
+				fld.Updated = true
 			default:
 				if strings.HasPrefix(p, "index:") {
 					indexParts := strings.Split(p, ":")
@@ -77,6 +77,16 @@ func TestEntityProperties(t *testing.T) {
 		{Name: "updatedAt", Value: updatedAt},
 	}, props)
 
+	props, err = EntityProperties(struct {
+		A string `depot:"a,indexed"`
+		B string `depot:"b"`
+	}{A: "av", B: "bv"})
+	assert.NoError(t, err)
+	assert.Equal(t, []Property{
+		{Name: "a", Value: "av", Index: true},
+		{Name: "b", Value: "bv"},
+	}, props)
+
 	_, err = EntityProperties("entity")
 	assert.ErrorIs(t, err, ErrInvalidEntityType)
 }
@@ -292,6 +302,14 @@ func TestEntityUpdates(t *testing.T) {
 		{Name: "updatedAt", Value: updatedAt},
 	}, updates)
 
+	equal := Equal("status")
+	updates, err = EntityUpdates(Widget{TenantID: "tv", ID: "iv", Name: "nv"}, []UpdateOp{equal})
+	assert.NoError(t, err)
+	assert.Equal(t, []Update{
+		{Name: "name", Value: "nv"},
+		{Name: "status", Value: WidgetStatus(""), Op: equal},
+	}, updates)
+
 	_, err = EntityUpdates("entity", nil)
 	assert.ErrorIs(t, err, ErrInvalidEntityType)
 }
@@ -326,8 +344,182 @@ func TestEntityConditions(t *testing.T) {
 	assert.ErrorIs(t, err, ErrInvalidEntityType)
 }
 
+func TestEntityPreconditions(t *testing.T) {
+	exists := Exists("id")
+	version := Equal("version")
+	missing := Equal("missing")
+	conditions, err := EntityPreconditions(&Widget{
+		TenantID: "tv",
+		ID:       "iv",
+		Name:     "nv",
+	}, []Condition{version, exists, missing})
+	assert.NoError(t, err)
+	assert.Equal(t, []EntityCondition{
+		{Name: "version", Value: int64(0), Op: version},
+		{Name: "id", Value: "iv", KeyType: KeyTypeSort, Op: exists},
+	}, conditions)
+
+	_, err = EntityPreconditions("entity", nil)
+	assert.ErrorIs(t, err, ErrInvalidEntityType)
+}
+
 func TestRealSlice(t *testing.T) {
 	assert.Equal(t, []string{"a", "b"}, RealSlice([]interface{}{"a", "b"}))
 	assert.Equal(t, []int{1, 2}, RealSlice([]interface{}{1, 2}))
 	assert.Equal(t, []int64{1, 2}, RealSlice([]interface{}{int64(1), int64(2)}))
 }
+
+func TestEntitySlice(t *testing.T) {
+	widgets := []Widget{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	v, err := EntitySlice(widgets)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, v.Len())
+	assert.ErrorIs(t, KeepEntities(v, []bool{true, false, true}), ErrInvalidEntityType)
+
+	v, err = EntitySlice(&widgets)
+	assert.NoError(t, err)
+	assert.NoError(t, KeepEntities(v, []bool{true, false, true}))
+	assert.Equal(t, []Widget{{ID: "a"}, {ID: "c"}}, widgets)
+
+	_, err = EntitySlice(Widget{})
+	assert.ErrorIs(t, err, ErrInvalidEntityType)
+	_, err = EntitySlice([]string{"a"})
+	assert.ErrorIs(t, err, ErrInvalidEntityType)
+}
+
+func TestRemoveUpdates(t *testing.T) {
+	type entity struct {
+		ID         string     `depot:"id,pk"`
+		Name       string     `depot:"name"`
+		Expiration *time.Time `depot:"expiration,omitempty"`
+	}
+	now := time.Now()
+	updates, err := EntityUpdates(&entity{ID: "a", Name: "n"}, []UpdateOp{Remove("expiration")})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"expiration"}, RemovedFields(updates))
+	assert.Len(t, updates, 2)
+
+	e := &entity{ID: "a", Name: "n", Expiration: &now}
+	assert.NoError(t, ClearFields(e, "expiration", "unknown"))
+	assert.Equal(t, &entity{ID: "a", Name: "n"}, e)
+	assert.ErrorIs(t, ClearFields(entity{}, "name"), ErrInvalidEntityType)
+}
+
+func TestListUpdates(t *testing.T) {
+	type entity struct {
+		ID   string   `depot:"id,pk"`
+		Name string   `depot:"name"`
+		Refs []string `depot:"refs"`
+	}
+	updates, err := EntityUpdates(&entity{ID: "a", Refs: []string{"r"}}, []UpdateOp{Append("refs")})
+	assert.NoError(t, err)
+	assert.Equal(t, []Update{{Name: "refs", Value: []string{"r"}, Op: Append("refs")}}, updates)
+
+	updates, err = EntityUpdates(&entity{ID: "a", Name: "n", Refs: []string{}}, []UpdateOp{AddToSet("refs")})
+	assert.NoError(t, err)
+	assert.Equal(t, []Update{{Name: "name", Value: "n"}}, updates)
+
+	_, err = EntityUpdates(&entity{ID: "a", Name: "n"}, []UpdateOp{Prepend("name")})
+	assert.ErrorIs(t, err, ErrInvalidTransform)
+}
+
+func TestPathUpdates(t *testing.T) {
+	e := &pathEntity{ID: "a", Name: "n", Stats: pathStats{Views: 2}, Data: map[string]interface{}{"c": 1}}
+	updates, err := EntityUpdates(e, []UpdateOp{Add("stats.views"), Remove("data.e")})
+	assert.NoError(t, err)
+	assert.Equal(t, []Update{
+		{Name: "name", Value: "n"},
+		{Name: "stats.views", Value: int64(2), Op: Add("stats.views")},
+		{Name: "data.e", Op: Remove("data.e")},
+	}, updates)
+
+	_, err = EntityUpdates(e, []UpdateOp{Add("stats.unknown")})
+	assert.ErrorIs(t, err, ErrInvalidFieldPath)
+	_, err = EntityUpdates(e, []UpdateOp{Add("id.x")})
+	assert.ErrorIs(t, err, ErrInvalidFieldPath)
+
+	conditions, err := EntityPreconditions(e, []Condition{Equal("data.c"), Exists("stats.views")})
+	assert.NoError(t, err)
+	assert.Equal(t, []EntityCondition{
+		{Name: "data.c", Value: 1, Op: Equal("data.c")},
+		{Name: "stats.views", Value: int64(2), Op: Exists("stats.views")},
+	}, conditions)
+
+	_, conditions, err = EntityConditions("", e, []QueryOp{Equal("data.c"), GreaterThan("data.missing")})
+	assert.NoError(t, err)
+	assert.Equal(t, []EntityCondition{
+		{Name: "id", Value: "a", KeyType: KeyTypePartition},
+		{Name: "name", Value: "n"},
+		{Name: "stats", Value: pathStats{Views: 2}},
+		{Name: "data.c", Value: 1, Op: Equal("data.c")},
+	}, conditions)
+
+	assert.NoError(t, ClearFields(e, "data.c", "stats.views"))
+	assert.Equal(t, map[string]interface{}{}, e.Data)
+	assert.Equal(t, pathStats{}, e.Stats)
+}
+
+func TestCompositeConditions(t *testing.T) {
+	e := &pathEntity{ID: "a", Name: "n", Stats: pathStats{Views: 2}}
+	name, views := Equal("name"), GreaterThan("stats.views")
+	or := Or(name, Not(views))
+	_, conditions, err := EntityConditions("", e, []QueryOp{or})
+	assert.NoError(t, err)
+	assert.Equal(t, []EntityCondition{
+		{Name: "id", Value: "a", KeyType: KeyTypePartition},
+		{Op: or, Conditions: []EntityCondition{
+			{Name: "name", Value: "n", Op: name},
+			{Op: Not(views), Conditions: []EntityCondition{{Name: "stats.views", Value: int64(2), Op: views}}},
+		}},
+	}, conditions)
+
+	updates, err := EntityUpdates(e, []UpdateOp{or})
+	assert.NoError(t, err)
+	if assert.Len(t, updates, 1) {
+		assert.Equal(t, or, updates[0].Op)
+		assert.Equal(t, []string{"name", "stats.views"}, updates[0].Value.(EntityCondition).Fields())
+	}
+
+	_, err = EntityPreconditions(e, []Condition{And(name, Equal("missing"))})
+	assert.ErrorIs(t, err, ErrInvalidFieldPath)
+}
+
+func TestEmptyListConditions(t *testing.T) {
+	e := &pathEntity{ID: "a", Name: "n"}
+	_, _, err := EntityConditions("", e, []QueryOp{In("name")})
+	assert.ErrorIs(t, err, ErrInvalidCondition)
+	_, _, err = EntityConditions("", e, []QueryOp{Where("name", "not-in", []string{})})
+	assert.ErrorIs(t, err, ErrInvalidCondition)
+	_, err = EntityPreconditions(e, []Condition{Or(Equal("name"), NotIn("name"))})
+	assert.ErrorIs(t, err, ErrInvalidCondition)
+	_, err = EntityUpdates(e, []UpdateOp{Not(In("name"))})
+	assert.ErrorIs(t, err, ErrInvalidCondition)
+}
+
+func TestValueConditions(t *testing.T) {
+	e := &pathEntity{ID: "a", Name: "n", Stats: pathStats{Views: 2}}
+	zero, between := Where("stats.views", "=", 0), Between("name", "a", "m")
+	_, conditions, err := EntityConditions("", e, []QueryOp{zero, between, Where("id", ">", "0")})
+	assert.NoError(t, err)
+	assert.Equal(t, []EntityCondition{
+		{Name: "id", Value: "a", KeyType: KeyTypePartition},
+		{Name: "name", Value: "n"},
+		{Name: "stats", Value: pathStats{Views: 2}},
+		{Name: "stats.views", Value: 0, Op: Equal("stats.views")},
+		{Name: "name", Op: between},
+		{Name: "id", Value: "0", KeyType: KeyTypePartition, Op: GreaterThan("id")},
+	}, conditions)
+
+	updates, err := EntityUpdates(e, []UpdateOp{Where("name", "!=", "n")})
+	assert.NoError(t, err)
+	assert.Equal(t, []Update{
+		{Name: "name", Value: "n"},
+		{Name: "stats", Value: pathStats{Views: 2}},
+		{Value: EntityCondition{Name: "name", Value: "n", Op: NotEqual("name")}, Op: Where("name", "!=", "n")},
+	}, updates)
+
+	_, err = EntityPreconditions(e, []Condition{Where("missing", "=", 1)})
+	assert.ErrorIs(t, err, ErrInvalidFieldPath)
+	_, err = EntityPreconditions(e, []Condition{Where("name", "~", 1)})
+	assert.ErrorIs(t, err, ErrInvalidCondition)
+}
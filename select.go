@@ -0,0 +1,85 @@
+package depot
+
+import "reflect"
+
+// Selected returns the fields named by the Select among ops, or nil when there
+// is none. A Select of no fields gives an empty list.
+func Selected[O any](ops []O) []string {
+	for _, op := range ops {
+		if s, ok := any(op).(*SelectQueryDirective); ok {
+			return append([]string{}, s.Fields...)
+		}
+	}
+	return nil
+}
+
+// Projection returns the fields to load for a Select of fields on entities of
+// the given kind: the fields themselves and the key fields of the table and the
+// index. It fails with ErrInvalidFieldPath for a field the entity lacks.
+func Projection(kind string, entity interface{}, fields []string) (projection []string, err error) {
+	var (
+		s Struct
+		v = reflect.ValueOf(entity)
+	)
+	if s, v, err = GetStruct(v); err != nil {
+		return
+	}
+	for _, f := range s {
+		switch {
+		case f.Mode == FieldModeExclude:
+		case isKeyMode(f.Mode), isKeyMode(GetMode(kind, f)):
+			projection = append(projection, f.Name)
+		}
+	}
+	for _, name := range fields {
+		if IsPath(name) {
+			if err = CheckPath(v.Type(), name); err != nil {
+				return nil, err
+			}
+		} else if _, ok := fieldIndex(s, name); !ok {
+			return nil, ErrInvalidFieldPath
+		}
+		if !contains(projection, name) {
+			projection = append(projection, name)
+		}
+	}
+	return
+}
+
+// ProjectMap returns the fields and dotted paths of the stored item m that the
+// projection names.
+func ProjectMap(m map[string]interface{}, projection []string) map[string]interface{} {
+	out := make(map[string]interface{}, len(projection))
+	for _, name := range projection {
+		if !IsPath(name) {
+			if v, ok := m[name]; ok {
+				out[name] = v
+			}
+		} else if v := PathValue(m, name); v != nil {
+			_ = SetPathValue(out, name, v)
+		}
+	}
+	return out
+}
+
+// ResetEntity sets the fields of entity other than its key to their zero
+// values, ready to load a projection into.
+func ResetEntity(entity interface{}) (err error) {
+	var (
+		s Struct
+		v = reflect.ValueOf(entity)
+	)
+	if s, v, err = GetStruct(v); err != nil {
+		return
+	}
+	for i, f := range s {
+		if f.Mode != FieldModeExclude && !isKeyMode(f.Mode) && v.Field(i).CanSet() {
+			v.Field(i).SetZero()
+		}
+	}
+	return
+}
+
+func isKeyMode(m FieldMode) bool {
+	return m == FieldModePartition || m == FieldModeSort
+}
@@ -0,0 +1,61 @@
+package depot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type selectEntity struct {
+	TenantID string                 `depot:"tenantId,pk,index:named:pk"`
+	ID       string                 `depot:"id,sk"`
+	Name     string                 `depot:"name,index:named:sk"`
+	Status   string                 `depot:"status"`
+	Data     map[string]interface{} `depot:"data"`
+	Skip     string                 `depot:"-"`
+}
+
+func TestSelected(t *testing.T) {
+	assert.Nil(t, Selected([]QueryOp{Limit(1)}))
+	assert.Equal(t, []string{"a", "b"}, Selected([]QueryOp{Limit(1), Select("a", "b")}))
+	assert.Equal(t, []string{"a"}, Selected([]GetOp{Select("a")}))
+	assert.Equal(t, []string{}, Selected([]GetOp{Select()}))
+}
+
+func TestProjection(t *testing.T) {
+	p, err := Projection("", &selectEntity{}, []string{"status", "id", "data.c"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tenantId", "id", "status", "data.c"}, p)
+
+	p, err = Projection("", &selectEntity{}, Selected([]QueryOp{Select()}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tenantId", "id"}, p)
+
+	p, err = Projection("named", selectEntity{}, []string{"status"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tenantId", "id", "name", "status"}, p)
+
+	_, err = Projection("", &selectEntity{}, []string{"missing"})
+	assert.ErrorIs(t, err, ErrInvalidFieldPath)
+	_, err = Projection("", &selectEntity{}, []string{"status.x"})
+	assert.ErrorIs(t, err, ErrInvalidFieldPath)
+}
+
+func TestProjectMap(t *testing.T) {
+	m := map[string]interface{}{
+		"tenantId": "t",
+		"status":   "active",
+		"data":     map[string]interface{}{"c": 1, "d": 2},
+	}
+	assert.Equal(t, map[string]interface{}{
+		"tenantId": "t",
+		"data":     map[string]interface{}{"c": 1},
+	}, ProjectMap(m, []string{"tenantId", "id", "data.c", "data.e"}))
+}
+
+func TestResetEntity(t *testing.T) {
+	e := selectEntity{TenantID: "t", ID: "i", Name: "n", Status: "s", Data: map[string]interface{}{"c": 1}, Skip: "k"}
+	assert.NoError(t, ResetEntity(&e))
+	assert.Equal(t, selectEntity{TenantID: "t", ID: "i", Skip: "k"}, e)
+	assert.ErrorIs(t, ResetEntity("entity"), ErrInvalidEntityType)
+}
@@ -0,0 +1,142 @@
+package depot
+
+import (
+	"reflect"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Timestamps names the time.Time fields of an entity tagged with the created
+// and updated options and holds the times a write stamps them with. Create
+// stamps both, Put stamps updated and keeps the stored created time, and
+// Update stamps updated alone.
+type Timestamps struct {
+	Created   string
+	Updated   string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// EntityTimestamps returns the timestamp fields of entity, with CreatedAt
+// holding the created time it already has.
+func EntityTimestamps(entity interface{}) (ts Timestamps, err error) {
+	var (
+		s  Struct
+		sv reflect.Value
+	)
+	if s, sv, err = GetStruct(reflect.ValueOf(entity)); err != nil {
+		return
+	}
+	for i, f := range s {
+		if !f.Created && !f.Updated {
+			continue
+		}
+		fv := sv.Field(i)
+		if fv.Type() != timeType && fv.Type() != reflect.PtrTo(timeType) {
+			return ts, ErrInvalidEntityType
+		}
+		if f.Updated {
+			ts.Updated = f.Name
+		}
+		if f.Created {
+			ts.Created = f.Name
+			if t, ok := Normalize(fv.Interface()).(time.Time); ok {
+				ts.CreatedAt = t
+			}
+		}
+	}
+	return
+}
+
+// Stamped reports whether the entity has a created or updated field.
+func (ts Timestamps) Stamped() bool {
+	return ts.Created != "" || ts.Updated != ""
+}
+
+// Create stamps both fields with now.
+func (ts *Timestamps) Create(now time.Time) {
+	ts.CreatedAt, ts.UpdatedAt = now, now
+}
+
+// Put stamps the updated field with now and the created field with the time
+// stored in existing, falling back to the entity's own and then to now. Stored
+// times may be held as RFC 3339 strings.
+func (ts *Timestamps) Put(now time.Time, existing map[string]interface{}) {
+	if t, ok := StoredTime(existing[ts.Created]); ok {
+		ts.CreatedAt = t
+	} else if ts.CreatedAt.IsZero() {
+		ts.CreatedAt = now
+	}
+	ts.UpdatedAt = now
+}
+
+// Update stamps the updated field alone with now.
+func (ts *Timestamps) Update(now time.Time) {
+	ts.CreatedAt, ts.UpdatedAt = time.Time{}, now
+}
+
+// Updates returns the stamped fields as updates that set them.
+func (ts Timestamps) Updates() (updates []Update) {
+	if ts.Created != "" && !ts.CreatedAt.IsZero() {
+		updates = append(updates, Update{Name: ts.Created, Value: ts.CreatedAt})
+	}
+	if ts.Updated != "" && !ts.UpdatedAt.IsZero() {
+		updates = append(updates, Update{Name: ts.Updated, Value: ts.UpdatedAt})
+	}
+	return
+}
+
+// Write stores the stamped fields in m.
+func (ts Timestamps) Write(m map[string]interface{}) {
+	for _, u := range ts.Updates() {
+		m[u.Name] = u.Value
+	}
+}
+
+// Set stores the stamped fields in entity. Entities that are not pointers
+// cannot be filled in and are left alone.
+func (ts Timestamps) Set(entity interface{}) (err error) {
+	var (
+		s  Struct
+		v  = reflect.ValueOf(entity)
+		sv reflect.Value
+	)
+	if v.Kind() != reflect.Ptr || !ts.Stamped() {
+		return
+	}
+	if s, sv, err = GetStruct(v); err != nil {
+		return
+	}
+	for _, u := range ts.Updates() {
+		for i, f := range s {
+			if f.Name != u.Name {
+				continue
+			}
+			fv := sv.Field(i)
+			t := reflect.ValueOf(u.Value)
+			if fv.Kind() == reflect.Ptr {
+				fv.Set(reflect.New(timeType))
+				fv = fv.Elem()
+			}
+			fv.Set(t)
+		}
+	}
+	return
+}
+
+// StoredTime returns the time held by a stored value, which may be a time.Time,
+// a pointer to one or an RFC 3339 string. ok is false for a missing or zero
+// time.
+func StoredTime(v interface{}) (t time.Time, ok bool) {
+	switch s := Normalize(v).(type) {
+	case time.Time:
+		t = s
+	case string:
+		var err error
+		if t, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			return t, false
+		}
+	}
+	return t, !t.IsZero()
+}
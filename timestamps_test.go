@@ -0,0 +1,111 @@
+package depot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stamped struct {
+	ID        string     `depot:"id,pk"`
+	Name      string     `depot:"name"`
+	CreatedAt time.Time  `depot:"createdAt,created"`
+	UpdatedAt *time.Time `depot:"updatedAt,updated"`
+}
+
+func TestEntityTimestamps(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	ts, err := EntityTimestamps(&stamped{ID: "a", CreatedAt: created})
+	assert.NoError(t, err)
+	assert.Equal(t, Timestamps{Created: "createdAt", Updated: "updatedAt", CreatedAt: created}, ts)
+	assert.True(t, ts.Stamped())
+
+	ts, err = EntityTimestamps(struct {
+		ID string `depot:"id,pk"`
+	}{})
+	assert.NoError(t, err)
+	assert.False(t, ts.Stamped())
+
+	_, err = EntityTimestamps(struct {
+		CreatedAt int64 `depot:"createdAt,created"`
+	}{})
+	assert.ErrorIs(t, err, ErrInvalidEntityType)
+}
+
+func TestTimestampsPut(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	stored := now.Add(-time.Hour)
+	own := now.Add(-time.Minute)
+
+	for _, tc := range []struct {
+		name     string
+		own      time.Time
+		existing map[string]interface{}
+		expected time.Time
+	}{
+		{"new", time.Time{}, nil, now},
+		{"own", own, nil, own},
+		{"stored", own, map[string]interface{}{"createdAt": stored}, stored},
+		{"stored-string", time.Time{}, map[string]interface{}{"createdAt": stored.Format(time.RFC3339Nano)}, stored},
+		{"stored-invalid", time.Time{}, map[string]interface{}{"createdAt": "yesterday"}, now},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := Timestamps{Created: "createdAt", Updated: "updatedAt", CreatedAt: tc.own}
+			ts.Put(now, tc.existing)
+			assert.True(t, tc.expected.Equal(ts.CreatedAt))
+			assert.Equal(t, now, ts.UpdatedAt)
+		})
+	}
+}
+
+func TestTimestampsUpdates(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	ts := Timestamps{Created: "createdAt", Updated: "updatedAt"}
+	ts.Create(now)
+	assert.Equal(t, []Update{{Name: "createdAt", Value: now}, {Name: "updatedAt", Value: now}}, ts.Updates())
+
+	ts.Update(now)
+	assert.Equal(t, []Update{{Name: "updatedAt", Value: now}}, ts.Updates())
+
+	m := map[string]interface{}{"name": "n"}
+	ts.Write(m)
+	assert.Equal(t, map[string]interface{}{"name": "n", "updatedAt": now}, m)
+
+	assert.Empty(t, Timestamps{}.Updates())
+}
+
+func TestTimestampsSet(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	ts := Timestamps{Created: "createdAt", Updated: "updatedAt"}
+	ts.Create(now)
+
+	s := stamped{ID: "a"}
+	assert.NoError(t, ts.Set(&s))
+	assert.Equal(t, now, s.CreatedAt)
+	if assert.NotNil(t, s.UpdatedAt) {
+		assert.Equal(t, now, *s.UpdatedAt)
+	}
+
+	// Entities passed by value are left alone.
+	v := stamped{ID: "b"}
+	assert.NoError(t, ts.Set(v))
+	assert.True(t, v.CreatedAt.IsZero())
+}
+
+func TestEntityUpdatesSkipsTimestamps(t *testing.T) {
+	now := time.Now()
+	updates, err := EntityUpdates(&stamped{ID: "a", Name: "n", CreatedAt: now, UpdatedAt: &now}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Update{{Name: "name", Value: "n"}}, updates)
+}
+
+func TestWithClock(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	o := NewOptions(WithClock(func() time.Time { return now }))
+	assert.Equal(t, now, o.Clock())
+
+	d := NewOptions().Clock()
+	assert.Equal(t, time.UTC, d.Location())
+	assert.Zero(t, d.Nanosecond()%int(time.Microsecond))
+}
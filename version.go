@@ -0,0 +1,114 @@
+package depot
+
+import "reflect"
+
+// Version is the optimistic locking version of an entity, held by the integer
+// field tagged with the version option. Put, Update and Delete require the
+// stored version to equal it, where a missing version counts as 0, and writes
+// store Next. Batch writes neither check nor bump versions.
+type Version struct {
+	Name  string
+	Value int64
+}
+
+// Next is the version stored by a successful write.
+func (v Version) Next() int64 { return v.Value + 1 }
+
+// EntityVersion returns the version of entity. ok is false when entity has no
+// version field.
+func EntityVersion(entity interface{}) (v Version, ok bool, err error) {
+	var (
+		s  Struct
+		sv reflect.Value
+	)
+	if s, sv, err = GetStruct(reflect.ValueOf(entity)); err != nil {
+		return
+	}
+	for i, f := range s {
+		if !f.Version {
+			continue
+		}
+		fv := sv.Field(i)
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return Version{Name: f.Name, Value: fv.Int()}, true, nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return Version{Name: f.Name, Value: int64(fv.Uint())}, true, nil
+		default:
+			return v, false, ErrInvalidEntityType
+		}
+	}
+	return
+}
+
+// IsVersioned reports whether entity has a version field.
+func IsVersioned(entity interface{}) bool {
+	_, ok, _ := EntityVersion(entity)
+	return ok
+}
+
+// SetEntityVersion stores value in the version field of entity, which must be
+// a pointer to a struct.
+func SetEntityVersion(entity interface{}, value int64) (err error) {
+	var (
+		s  Struct
+		v  = reflect.ValueOf(entity)
+		sv reflect.Value
+	)
+	if v.Kind() != reflect.Ptr {
+		return ErrInvalidEntityType
+	}
+	if s, sv, err = GetStruct(v); err != nil {
+		return
+	}
+	for i, f := range s {
+		if !f.Version {
+			continue
+		}
+		fv := sv.Field(i)
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			fv.SetInt(value)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			fv.SetUint(uint64(value))
+		default:
+			return ErrInvalidEntityType
+		}
+	}
+	return
+}
+
+// CheckVersion returns ErrVersionConflict unless the version stored in
+// existing equals v. A missing version counts as 0.
+func CheckVersion(v Version, existing map[string]interface{}) error {
+	stored := Normalize(existing[v.Name])
+	if stored == nil {
+		stored = int64(0)
+	}
+	if !ValuesEqual(stored, v.Value) {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// VersionBumps collects the versions written inside a transaction so they can
+// be set on their entities once it has committed.
+type VersionBumps []versionBump
+
+type versionBump struct {
+	entity interface{}
+	value  int64
+}
+
+func (b *VersionBumps) Add(entity interface{}, value int64) {
+	*b = append(*b, versionBump{entity: entity, value: value})
+}
+
+func (b VersionBumps) Apply() (err error) {
+	for _, bump := range b {
+		if err = SetEntityVersion(bump.entity, bump.value); err != nil {
+			return
+		}
+	}
+	return
+}